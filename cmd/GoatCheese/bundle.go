@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/hansingt/GoatCheese/internal/mirror"
+	"log"
+	"os"
+)
+
+/*
+exportCommand implements the "export" subcommand.
+It writes the given projects or all projects of a repository into a bundle and returns the exit code.
+*/
+func exportCommand(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(flags.Output(), "Usage: %s export [options] [project...]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	configurationFile := flags.String(
+		"config",
+		"config.yaml",
+		"Path to the YAML file to read the configuration from")
+	repositoryName := flags.String(
+		"repository",
+		"",
+		"Name of the repository to export")
+	outputFile := flags.String(
+		"output",
+		"",
+		"Path of the bundle to write")
+	_ = flags.Parse(args)
+	if *repositoryName == "" || *outputFile == "" {
+		log.Print("the repository and the bundle to write are required")
+		flags.Usage()
+		return 2
+	}
+
+	db, repo, err := openRepository(*configurationFile, *repositoryName)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	//noinspection GoUnhandledErrorResult
+	defer db.Close()
+	output, err := os.Create(*outputFile)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	manifest, err := mirror.Export(output, repo, flags.Args())
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Printf("unable to export '%s': %s", repo.Name(), err)
+		_ = os.Remove(*outputFile)
+		return 1
+	}
+	files := 0
+	for _, project := range manifest.Projects {
+		files += len(project.Files)
+	}
+	log.Printf("exported %d files of %d projects", files, len(manifest.Projects))
+	return 0
+}
+
+/*
+importCommand implements the "import" subcommand.
+It adds the files of a bundle to a repository and returns the exit code.
+*/
+func importCommand(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(flags.Output(), "Usage: %s import [options] bundle\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	configurationFile := flags.String(
+		"config",
+		"config.yaml",
+		"Path to the YAML file to read the configuration from")
+	repositoryName := flags.String(
+		"repository",
+		"",
+		"Name of the repository to import into")
+	_ = flags.Parse(args)
+	if *repositoryName == "" || flags.NArg() != 1 {
+		log.Print("the repository and exactly one bundle are required")
+		flags.Usage()
+		return 2
+	}
+
+	db, repo, err := openRepository(*configurationFile, *repositoryName)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	//noinspection GoUnhandledErrorResult
+	defer db.Close()
+	input, err := os.Open(flags.Arg(0))
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	//noinspection GoUnhandledErrorResult
+	defer input.Close()
+	result, err := mirror.Import(input, repo)
+	if err != nil {
+		log.Printf("unable to import '%s': %s", flags.Arg(0), err)
+		return 1
+	}
+	log.Printf("%d files imported, %d files up to date, %d failures", result.Added, result.Skipped, result.Failed)
+	if result.Failed > 0 {
+		return 1
+	}
+	return 0
+}
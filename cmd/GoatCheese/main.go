@@ -6,9 +6,29 @@ import (
 	"github.com/hansingt/GoatCheese/internal/web"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"os"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "mirror":
+			os.Exit(mirrorCommand(os.Args[2:]))
+		case "export":
+			os.Exit(exportCommand(os.Args[2:]))
+		case "import":
+			os.Exit(importCommand(os.Args[2:]))
+		case "promote":
+			os.Exit(promoteCommand(os.Args[2:]))
+		}
+	}
+	serve()
+}
+
+/*
+serve runs the package server.
+*/
+func serve() {
 	configurationFile := flag.String(
 		"config",
 		"config.yaml",
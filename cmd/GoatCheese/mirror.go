@@ -0,0 +1,149 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/hansingt/GoatCheese/internal/datastore"
+	"github.com/hansingt/GoatCheese/internal/mirror"
+	"github.com/hansingt/GoatCheese/internal/simple"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultUpstream is the index mirrored from, if neither given nor configured for the repository
+const defaultUpstream = "https://pypi.org/simple/"
+
+/*
+openRepository opens the data store and returns the repository with the given name.
+*/
+func openRepository(configurationFile string, repositoryName string) (datastore.Datastore, datastore.Repository, error) {
+	db, err := datastore.New(configurationFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	repo, err := db.GetRepository(repositoryName)
+	if err != nil {
+		_ = db.Close()
+		return nil, nil, fmt.Errorf("unable to get the repository '%s': %s", repositoryName, err)
+	}
+	return db, repo, nil
+}
+
+/*
+listFlag is a flag, which might be given multiple times or as a comma separated list.
+*/
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+/*
+mirrorCommand implements the "mirror" subcommand.
+It syncs the given projects and the projects of the requirements file
+from an upstream index into a repository and returns the exit code.
+*/
+func mirrorCommand(args []string) int {
+	flags := flag.NewFlagSet("mirror", flag.ExitOnError)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(flags.Output(), "Usage: %s mirror [options] [project...]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	configurationFile := flags.String(
+		"config",
+		"config.yaml",
+		"Path to the YAML file to read the configuration from")
+	repositoryName := flags.String(
+		"repository",
+		"",
+		"Name of the repository to mirror into")
+	upstream := flags.String(
+		"upstream",
+		"",
+		"URL of the simple index to mirror from (default: the upstream of the repository or "+defaultUpstream+")")
+	requirementsFile := flags.String(
+		"requirements",
+		"",
+		"Path to a pip requirements file listing the projects to mirror")
+	timeout := flags.Int(
+		"timeout",
+		600,
+		"Timeout in seconds for each request to the upstream index. Downloads are only limited until the response starts, not while the file is transferred")
+	var filter mirror.Filter
+	flags.Var((*listFlag)(&filter.Platforms), "platform",
+		"Platform tag of the wheels to mirror, e.g. manylinux2014_x86_64 (repeatable, default: all)")
+	flags.Var((*listFlag)(&filter.PythonVersions), "python",
+		"Python version to mirror files for, e.g. 3.8 (repeatable, default: all)")
+	_ = flags.Parse(args)
+
+	if *repositoryName == "" {
+		log.Print("no repository to mirror into given")
+		flags.Usage()
+		return 2
+	}
+	var requirements []mirror.Requirement
+	for _, projectName := range flags.Args() {
+		requirement, err := mirror.ParseRequirement(projectName)
+		if err != nil {
+			log.Print(err)
+			return 2
+		}
+		requirements = append(requirements, requirement)
+	}
+	if *requirementsFile != "" {
+		file, err := os.Open(*requirementsFile)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		fileRequirements, err := mirror.ReadRequirements(file)
+		_ = file.Close()
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		requirements = append(requirements, fileRequirements...)
+	}
+	if len(requirements) == 0 {
+		log.Print("neither projects nor a requirements file given")
+		flags.Usage()
+		return 2
+	}
+
+	db, repo, err := openRepository(*configurationFile, *repositoryName)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	//noinspection GoUnhandledErrorResult
+	defer db.Close()
+	upstreamURL := *upstream
+	if upstreamURL == "" {
+		upstreamURL = repo.Upstream()
+	}
+	if upstreamURL == "" {
+		upstreamURL = defaultUpstream
+	}
+	m := &mirror.Mirror{
+		Upstream:   simple.NewClient(upstreamURL, time.Duration(*timeout)*time.Second),
+		Repository: repo,
+		Filter:     filter,
+	}
+	result := m.Sync(requirements)
+	log.Printf("%d files mirrored, %d files up to date, %d failures", result.Added, result.Skipped, result.Failed)
+	if result.Failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+/*
+promoteCommand implements the "promote" subcommand.
+It copies or moves a release of a project from one repository into another and returns the exit code.
+*/
+func promoteCommand(args []string) int {
+	flags := flag.NewFlagSet("promote", flag.ExitOnError)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(flags.Output(), "Usage: %s promote [options] project version\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	configurationFile := flags.String(
+		"config",
+		"config.yaml",
+		"Path to the YAML file to read the configuration from")
+	sourceName := flags.String(
+		"from",
+		"",
+		"Name of the repository containing the release")
+	targetName := flags.String(
+		"to",
+		"",
+		"Name of the repository to promote the release to")
+	move := flags.Bool(
+		"move",
+		false,
+		"Delete the release from the source repository after promoting it")
+	_ = flags.Parse(args)
+	if *sourceName == "" || *targetName == "" || flags.NArg() != 2 {
+		log.Print("the source and target repositories, the project and the version are required")
+		flags.Usage()
+		return 2
+	}
+
+	db, source, err := openRepository(*configurationFile, *sourceName)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	//noinspection GoUnhandledErrorResult
+	defer db.Close()
+	target, err := db.GetRepository(*targetName)
+	if err != nil {
+		log.Printf("unable to get the repository '%s': %s", *targetName, err)
+		return 1
+	}
+	release, err := source.Promote(flags.Arg(0), flags.Arg(1), target, *move)
+	if err != nil {
+		log.Printf("unable to promote '%s %s': %s", flags.Arg(0), flags.Arg(1), err)
+		return 1
+	}
+	files, err := release.ProjectFiles()
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	log.Printf("promoted '%s %s' with %d files to '%s'", flags.Arg(0), release.Version(), len(files), target.Name())
+	return 0
+}
@@ -6,5 +6,7 @@ require (
 	github.com/jinzhu/gorm v1.9.12
 	github.com/labstack/echo/v4 v4.1.14
 	github.com/stretchr/testify v1.4.0
+	golang.org/x/crypto v0.0.0-20191227163750-53104e6ec876
+	golang.org/x/net v0.0.0-20191209160850-c0dbc17a3553
 	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,180 @@
+package datastore
+
+import (
+	"github.com/jinzhu/gorm"
+	"log"
+	"os"
+	"path"
+	"time"
+)
+
+/*
+blob is the content of one or more project files stored once in the blob store.
+
+Blobs are addressed by the sha256 checksum of their content. Thus, identical
+files uploaded into several projects or repositories are stored only once.
+The blob is removed, as soon as no project file references it anymore.
+
+While a blob is removed from the storage, its row is claimed by setting DeletingAt.
+A claimed blob is not referenced again until the removal finished, so that an instance
+storing the same content concurrently never references a blob removed afterwards.
+*/
+type blob struct {
+	Checksum   string `gorm:"primary_key"`
+	RefCount   int    `gorm:"NOT NULL"`
+	DeletingAt *time.Time
+}
+
+// blobPollInterval is the time to wait for another instance to finish removing a blob
+const blobPollInterval = 50 * time.Millisecond
+
+/*
+blobKey returns the key of the blob with the given checksum in the storage backend.
+*/
+func blobKey(checksum string) string {
+	return path.Join("blobs", checksum[:2], checksum)
+}
+
+/*
+createTempFile creates a temporary file, which can be moved into the blob store.
+*/
+func (db *datastore) createTempFile(pattern string) (*os.File, error) {
+	return db.storage.TempFile(pattern)
+}
+
+/*
+storeBlob moves the temporary file into the blob store and adds a reference to the blob.
+The reference is added first, so that the blob can not be removed while it is imported.
+*/
+func (db *datastore) storeBlob(tempPath string, checksum string) error {
+	if err := db.referenceBlob(checksum); err != nil {
+		return err
+	}
+	// Replacing an existing blob is fine, as it has the same content
+	if err := db.storage.Import(blobKey(checksum), tempPath); err != nil {
+		_ = db.releaseBlob(checksum)
+		return err
+	}
+	return nil
+}
+
+/*
+referenceBlob increments the reference count of the blob, creating it if required.
+If the blob is currently removed by another instance, it waits for the removal to finish.
+Removals not finished within the lock timeout have been interrupted and are taken over.
+*/
+func (db *datastore) referenceBlob(checksum string) error {
+	increment := func() *gorm.DB {
+		return db.Model(&blob{}).Where("checksum = ? AND deleting_at IS NULL", checksum).
+			UpdateColumn("ref_count", gorm.Expr("ref_count + 1"))
+	}
+	for {
+		if updated := increment(); updated.Error != nil || updated.RowsAffected > 0 {
+			return updated.Error
+		}
+		err := db.Create(&blob{Checksum: checksum, RefCount: 1}).Error
+		if err == nil {
+			return nil
+		}
+		// The blob might have been created concurrently
+		if updated := increment(); updated.Error != nil || updated.RowsAffected > 0 {
+			return updated.Error
+		}
+		var deleting int
+		if countErr := db.Model(&blob{}).Where("checksum = ? AND deleting_at IS NOT NULL", checksum).
+			Count(&deleting).Error; countErr != nil || deleting == 0 {
+			return err
+		}
+		stale := time.Now().UTC().Add(-db.lockTimeout)
+		if err = db.Delete(&blob{}, "checksum = ? AND deleting_at < ?", checksum, stale).Error; err != nil {
+			return err
+		}
+		time.Sleep(blobPollInterval)
+	}
+}
+
+/*
+releaseBlob decrements the reference count of the blob and removes it, if it is not referenced anymore.
+*/
+func (db *datastore) releaseBlob(checksum string) error {
+	if checksum == "" {
+		return nil
+	}
+	var claimed bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&blob{}).Where("checksum = ?", checksum).
+			UpdateColumn("ref_count", gorm.Expr("ref_count - 1")).Error
+		if err != nil {
+			return err
+		}
+		claim := tx.Model(&blob{}).Where("checksum = ? AND ref_count <= 0 AND deleting_at IS NULL", checksum).
+			UpdateColumn("deleting_at", time.Now().UTC())
+		claimed = claim.RowsAffected > 0
+		return claim.Error
+	})
+	if err != nil || !claimed {
+		return err
+	}
+	return db.removeBlob(checksum)
+}
+
+/*
+removeBlob removes a claimed blob from the storage and deletes its row afterwards.
+*/
+func (db *datastore) removeBlob(checksum string) error {
+	if err := db.storage.Delete(blobKey(checksum)); err != nil {
+		return err
+	}
+	return db.Delete(&blob{}, "checksum = ? AND deleting_at IS NOT NULL", checksum).Error
+}
+
+/*
+recoverInterruptedRemovals finishes removing the blobs claimed by instances, which crashed while removing them.
+*/
+func (db *datastore) recoverInterruptedRemovals() error {
+	var blobs []blob
+	err := db.Find(&blobs, "deleting_at < ?", time.Now().UTC().Add(-db.lockTimeout)).Error
+	if err != nil {
+		return err
+	}
+	for _, b := range blobs {
+		if err = db.removeBlob(b.Checksum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+migrateToBlobs moves files stored in the project directories by earlier versions into the blob store.
+*/
+func (db *datastore) migrateToBlobs() error {
+	var files []*projectFile
+	err := db.Where("blob_checksum = ? OR blob_checksum IS NULL", "").Where("file_checksum <> ?", "").Find(&files).Error
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		file.db = db
+		filePath := file.legacyPath()
+		content, err := os.Open(filePath)
+		if os.IsNotExist(err) {
+			// Files of upstream projects not fetched yet
+			continue
+		} else if err != nil {
+			return err
+		}
+		checksum, err := contentChecksum(content)
+		_ = content.Close()
+		if err != nil {
+			return err
+		} else if checksum != file.Checksum() {
+			log.Printf("not moving '%s' into the blob store, the checksum does not match", filePath)
+			continue
+		}
+		if err = file.setBlob(filePath, checksum, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package datastore
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type blobTestSuite struct {
+	TestSuiteWithDatastore
+}
+
+func TestBlob(t *testing.T) {
+	suite.Run(t, new(blobTestSuite))
+}
+
+func (suite *blobTestSuite) TestDeduplication() {
+	require := suite.Require()
+	content := []byte("identical content")
+	var files []ProjectFile
+	for _, repositoryName := range []string{"base", "test"} {
+		repo, err := newRepository(suite.db, repositoryName, nil, suite.storagePath)
+		require.Nil(err, "unable to create the repository")
+		project, err := repo.AddProject("test-app")
+		require.Nil(err, "unable to create the project")
+		require.Nil(project.AddFile("test-app-1.0.tar.gz", bytes.NewReader(content)), "unable to add the file")
+		file, err := project.GetFile("test-app-1.0.tar.gz")
+		require.Nil(err, "unable to get the file")
+		files = append(files, file)
+	}
+	require.Equal(files[0].(*projectFile).BlobChecksum, files[1].(*projectFile).BlobChecksum, "the content has been stored twice")
+	require.Equal(2, suite.refCount(files[0].Checksum()))
+
+	require.Nil(files[0].Delete(), "unable to delete the file")
+	require.Equal(1, suite.refCount(files[0].Checksum()))
+	stored, err := readContent(files[1])
+	require.Nil(err, "the blob has been removed while still being referenced")
+	require.Equal(content, stored)
+
+	require.Nil(files[1].Delete(), "unable to delete the file")
+	require.Equal(0, suite.refCount(files[1].Checksum()))
+	_, err = suite.db.storage.Open(blobKey(files[1].Checksum()))
+	require.True(os.IsNotExist(err), "the unreferenced blob has not been removed")
+}
+
+func (suite *blobTestSuite) TestReplaceContent() {
+	require := suite.Require()
+	file, err := newProjectFile(suite.db, 0, "test-app-1.0.tar.gz", suite.storagePath)
+	require.Nil(err, "unable to create the file")
+	require.Nil(file.Write(bytes.NewReader([]byte("old content"))), "unable to write the file")
+	oldChecksum := file.Checksum()
+
+	require.Nil(file.Write(bytes.NewReader([]byte("new content"))), "unable to replace the file")
+	require.Equal(0, suite.refCount(oldChecksum), "the replaced blob is still referenced")
+	_, err = suite.db.storage.Open(blobKey(oldChecksum))
+	require.True(os.IsNotExist(err), "the replaced blob has not been removed")
+	require.Equal(1, suite.refCount(file.Checksum()))
+
+	// Writing the same content again does not add references
+	require.Nil(file.Write(bytes.NewReader([]byte("new content"))), "unable to write the file")
+	require.Equal(1, suite.refCount(file.Checksum()))
+}
+
+func (suite *blobTestSuite) TestMigrateToBlobs() {
+	require := suite.Require()
+	content := []byte("stored by an earlier version")
+	file, err := newProjectFile(suite.db, 0, "test-app-1.0.tar.gz", suite.storagePath)
+	require.Nil(err, "unable to create the file")
+	legacyPath := filepath.Join(suite.storagePath, "test-app-1.0.tar.gz")
+	require.Nil(ioutil.WriteFile(legacyPath, content, 0640), "unable to write the file")
+	checksum, err := contentChecksum(bytes.NewReader(content))
+	require.Nil(err, "unable to compute the checksum")
+	require.Nil(file.SetChecksum(checksum), "unable to set the checksum")
+
+	require.Nil(suite.db.migrateToBlobs(), "unable to migrate the files")
+	migrated := &projectFile{db: suite.db}
+	require.Nil(suite.db.First(migrated, file.(*projectFile).ID).Error, "unable to load the file")
+	require.Equal(checksum, migrated.BlobChecksum, "the file has not been moved into the blob store")
+	stored, err := readContent(migrated)
+	require.Nil(err, "unable to read the blob")
+	require.Equal(content, stored)
+	_, err = os.Stat(legacyPath)
+	require.True(os.IsNotExist(err), "the file has been copied")
+}
+
+func (suite *blobTestSuite) TestClaimedBlob() {
+	require := suite.Require()
+	file, err := newProjectFile(suite.db, 0, "test-app-1.0.tar.gz", suite.storagePath)
+	require.Nil(err, "unable to create the file")
+	require.Nil(file.Write(bytes.NewReader([]byte("content"))), "unable to write the file")
+	checksum := file.Checksum()
+
+	// Blobs claimed for removal by another instance are not referenced again until it finished
+	suite.db.lockTimeout = 4 * blobPollInterval
+	claim := func(claimedAt time.Time) {
+		require.Nil(suite.db.Model(&blob{}).Where("checksum = ?", checksum).
+			Updates(map[string]interface{}{"ref_count": 0, "deleting_at": claimedAt}).Error, "unable to claim the blob")
+	}
+	claim(time.Now().UTC())
+	started := time.Now()
+	require.Nil(suite.db.referenceBlob(checksum), "unable to take over the interrupted removal")
+	require.True(time.Since(started) >= suite.db.lockTimeout, "a blob being removed has been referenced")
+	var stored blob
+	require.Nil(suite.db.First(&stored, "checksum = ?", checksum).Error, "unable to load the blob")
+	require.Equal(1, stored.RefCount, "the reference has not been added")
+	require.Nil(stored.DeletingAt, "the blob is still claimed")
+
+	// Removals interrupted by a crash are finished on the next start
+	claim(time.Now().UTC().Add(-time.Hour))
+	require.Nil(suite.db.recoverInterruptedRemovals(), "unable to finish the removal")
+	require.Equal(0, suite.refCount(checksum), "the claimed blob has not been deleted")
+	_, err = suite.db.storage.Open(blobKey(checksum))
+	require.True(os.IsNotExist(err), "the claimed blob has not been removed")
+}
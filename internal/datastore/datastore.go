@@ -4,12 +4,20 @@ Package datastore implements the database backend classes required by the GoatCh
 package datastore
 
 import (
+	"errors"
 	"fmt"
+	"github.com/hansingt/GoatCheese/internal/simple"
+	"github.com/hansingt/GoatCheese/internal/storage"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres" // Simply import it to be usable as a database backend
 	_ "github.com/jinzhu/gorm/dialects/sqlite"   // Simply import it to be usable as a database backend
 	"gopkg.in/yaml.v2"
+	"log"
+	"net/http"
 	"os"
+	"strings"
+	"sync"
+	"time"
 )
 
 /*
@@ -22,19 +30,82 @@ database and the files to download in the storage path on disk.
 type Datastore interface {
 	// AllRepositories returns a slice of all repositories defined in the data store.
 	AllRepositories() ([]Repository, error)
-	// GetRepository returns the Repository for a given name.
+	// GetRepository returns the Repository for a given name or ErrRepositoryNotFound.
 	GetRepository(repositoryName string) (Repository, error)
+	// MatchRepository returns the repository with the longest name the slash-separated path starts with,
+	// followed by another slash. It returns nil, if no repository matches.
+	MatchRepository(path string) (Repository, error)
+	// CreateRepository creates a new repository. The bases are given by the names of other
+	// repositories or the URLs of remote simple indexes. Without permissions, the defaults apply.
+	CreateRepository(repositoryName string, bases []string, permissions map[Permission][]string) (Repository, error)
+	// RenameRepository changes the name of a repository
+	RenameRepository(repositoryName string, newName string) error
+	// RebaseRepository replaces the bases of a repository
+	RebaseRepository(repositoryName string, bases []string) error
+	// UpdateRepository renames a repository, if the new name is not empty, and replaces its bases,
+	// if they are not nil. Either both changes are applied or none of them.
+	UpdateRepository(repositoryName string, newName string, bases []string) error
+	// DeleteRepository deletes a repository including all of its projects
+	DeleteRepository(repositoryName string) error
+	// Authenticate checks the credentials of a user and returns the user's name
+	Authenticate(userName string, secret string) (string, error)
+	// IsAdmin checks whether a user is allowed to manage the repositories
+	IsAdmin(userName string) bool
 	// Close closes the database connection
 	Close() error
 }
 
+// repositoryNamesLifetime defines how long the cached names of the repositories are used to match request paths
+const repositoryNamesLifetime = time.Minute
+
 type datastore struct {
 	*gorm.DB
+	httpClient *http.Client
+	// downloadClient downloads files from upstream indexes without limiting the transfer time
+	downloadClient *http.Client
+	users          map[string]*userConfig
+	storagePath    string
+	storage        storage.Backend
+	instanceID     string
+	lockTimeout    time.Duration
+	// redirectLifetime is the lifetime of signed URLs downloads are redirected to.
+	// It is zero, if downloads are not redirected.
+	redirectLifetime time.Duration
+	// remotes are the remote simple indexes used as bases, by their URL
+	remotes       map[string]*remoteIndex
+	remotesLock   sync.Mutex
+	remoteConfigs map[string]remoteConfig
+	// configured are the names of the repositories defined in the configuration file
+	configured map[string]bool
+	// configuredBases are the names of the repositories used as bases in the configuration file
+	configuredBases map[string]bool
+	// repositoryNames caches the names of all repositories to match request paths.
+	// It is nil, if the names have to be loaded again.
+	repositoryNames       map[string]bool
+	repositoryNamesLoaded time.Time
+	repositoryNamesLock   sync.Mutex
+	// admins are the names of the users allowed to manage the repositories
+	admins         []string
+	managementLock sync.Mutex
 }
 
 type indexConfig struct {
-	Name  string   `yaml:"name"`
-	Bases []string `yaml:"bases"`
+	Name           string             `yaml:"name"`
+	Bases          []string           `yaml:"bases"`
+	Upstream       string             `yaml:"upstream"`
+	Permissions    *permissionsConfig `yaml:"permissions"`
+	AllowOverwrite bool               `yaml:"allowOverwrite"`
+	MaxUploadSize  int64              `yaml:"maxUploadSize"` // in bytes
+	Shadowing      string             `yaml:"shadowing"`     // shadow (default), merge or deny
+	Volatile       *bool              `yaml:"volatile"`      // true, if not given
+}
+
+/*
+isVolatile checks whether the files of the index might be deleted or replaced.
+Indexes are volatile, unless configured otherwise.
+*/
+func (c indexConfig) isVolatile() bool {
+	return c.Volatile == nil || *c.Volatile
 }
 
 type databaseConfig struct {
@@ -43,9 +114,15 @@ type databaseConfig struct {
 }
 
 type config struct {
-	StoragePath string         `yaml:"storagePath"`
-	Indexes     []indexConfig  `yaml:"indexes"`
-	Database    databaseConfig `yaml:"database"`
+	StoragePath     string         `yaml:"storagePath"`
+	Storage         storage.Config `yaml:"storage"`
+	Indexes         []indexConfig  `yaml:"indexes"`
+	Database        databaseConfig `yaml:"database"`
+	UpstreamTimeout int            `yaml:"upstreamTimeout"` // in seconds
+	LockTimeout     int            `yaml:"lockTimeout"`     // in seconds
+	Users           []userConfig   `yaml:"users"`
+	Remotes         []remoteConfig `yaml:"remotes"`
+	Admins          []string       `yaml:"admins"`
 }
 
 func readConfigurationFile(configFile string) (*config, error) {
@@ -70,28 +147,58 @@ func setupDatabase(cfg *config) (*datastore, error) {
 	if err != nil {
 		return nil, err
 	}
+	timeout := time.Duration(cfg.UpstreamTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = simple.DefaultTimeout
+	}
+	lockTimeout := time.Duration(cfg.LockTimeout) * time.Second
+	if lockTimeout <= 0 {
+		lockTimeout = defaultLockTimeout
+	}
+	users := make(map[string]*userConfig, len(cfg.Users))
+	for i := range cfg.Users {
+		users[cfg.Users[i].Name] = &cfg.Users[i]
+	}
+	remoteConfigs := make(map[string]remoteConfig, len(cfg.Remotes))
+	for _, remote := range cfg.Remotes {
+		remoteConfigs[remoteURL(remote.URL)] = remote
+	}
+	store := &datastore{
+		DB:              db,
+		httpClient:      &http.Client{Timeout: timeout},
+		downloadClient:  simple.NewDownloadClient(timeout),
+		users:           users,
+		storagePath:     cfg.StoragePath,
+		instanceID:      newInstanceID(),
+		lockTimeout:     lockTimeout,
+		remotes:         make(map[string]*remoteIndex),
+		remoteConfigs:   remoteConfigs,
+		configured:      make(map[string]bool, len(cfg.Indexes)),
+		configuredBases: make(map[string]bool),
+		admins:          cfg.Admins,
+	}
 	// Migrate the Schema
-	return &datastore{db}, db.AutoMigrate(&projectFile{}).
+	return store, db.AutoMigrate(&projectFile{}).
+		AutoMigrate(&fileLock{}).
+		AutoMigrate(&blob{}).
+		AutoMigrate(&release{}).
 		AutoMigrate(&project{}).
 		AutoMigrate(&repository{}).
+		AutoMigrate(&repositoryBase{}).
+		AutoMigrate(&repositoryPermission{}).
+		AutoMigrate(&remoteBase{}).
 		Error
 }
 
+/*
+slicesEqual checks whether both slices contain the same values in the same order.
+*/
 func slicesEqual(a, b []string) bool {
-	if a == nil && b == nil || a == nil && len(b) == 0 || len(a) == 0 && b == nil {
-		return true
-	} else if len(a) != len(b) {
+	if len(a) != len(b) {
 		return false
 	}
-	for _, va := range a {
-		found := false
-		for _, vb := range b {
-			if va == vb {
-				found = true
-				break
-			}
-		}
-		if !found {
+	for i := range a {
+		if a[i] != b[i] {
 			return false
 		}
 	}
@@ -112,12 +219,9 @@ func New(configFile string) (Datastore, error) {
 		return nil, err
 	}
 	// create the storage path if it does not exist
-	_, err = os.Stat(cfg.StoragePath)
+	err = os.MkdirAll(cfg.StoragePath, 0750)
 	if err != nil {
-		err = os.MkdirAll(cfg.StoragePath, 0750)
-		if err != nil {
-			return nil, err
-		}
+		return nil, err
 	}
 	// initialize the database connection and tables
 	var db *datastore
@@ -125,12 +229,57 @@ func New(configFile string) (Datastore, error) {
 	if err != nil {
 		return nil, err
 	}
+	// connect to the storage backend
+	db.storage, err = storage.New(cfg.Storage, cfg.StoragePath)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	// redirect downloads to signed URLs, if configured
+	if cfg.Storage.Redirect {
+		signer, ok := db.storage.(storage.Signer)
+		if !ok {
+			_ = db.Close()
+			return nil, errors.New("redirects are not supported by the configured storage backend")
+		}
+		db.redirectLifetime = time.Duration(cfg.Storage.RedirectLifetime) * time.Second
+		if db.redirectLifetime < 0 || db.redirectLifetime > signer.MaxURLLifetime() {
+			_ = db.Close()
+			return nil, fmt.Errorf("the redirect lifetime needs to be between 1s and %s", signer.MaxURLLifetime())
+		} else if db.redirectLifetime == 0 {
+			db.redirectLifetime = storage.DefaultRedirectLifetime
+		}
+	}
+	// release the locks of uploads interrupted by a crash
+	err = db.recoverStaleLocks(cfg.StoragePath)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	// finish removing the blobs, whose removal has been interrupted by a crash
+	err = db.recoverInterruptedRemovals()
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
 	// add the repositories from the configuration
 	err = db.addRepositories(cfg)
 	if err != nil {
 		_ = db.Close()
 		return nil, err
 	}
+	// move files stored by earlier versions into the blob store
+	err = db.migrateToBlobs()
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	// read the metadata of files uploaded before it has been stored
+	err = db.backfillMetadata()
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
 	return db, nil
 }
 
@@ -153,18 +302,79 @@ func (db *datastore) GetRepository(repositoryName string) (Repository, error) {
 	err := db.Model(&repo).First(&repo, &repository{
 		RepositoryName: repositoryName,
 	}).Error
-	if err != nil {
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrRepositoryNotFound
+	} else if err != nil {
 		return nil, err
 	}
 	repo.db = db
 	return &repo, nil
 }
 
+func (db *datastore) MatchRepository(path string) (Repository, error) {
+	names, err := db.loadRepositoryNames()
+	if err != nil {
+		return nil, err
+	}
+	// The last segment follows the name of the repository
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i := len(segments) - 1; i > 0; i-- {
+		name := strings.Join(segments[:i], "/")
+		if !names[name] {
+			continue
+		}
+		repo, err := db.GetRepository(name)
+		if err == ErrRepositoryNotFound {
+			// The repository has been deleted by another instance
+			db.invalidateRepositoryNames()
+			continue
+		}
+		return repo, err
+	}
+	return nil, nil
+}
+
+/*
+loadRepositoryNames returns the names of all repositories. The names are cached until a repository is
+created, renamed or deleted. Changes made by other instances are noticed after repositoryNamesLifetime.
+*/
+func (db *datastore) loadRepositoryNames() (map[string]bool, error) {
+	db.repositoryNamesLock.Lock()
+	defer db.repositoryNamesLock.Unlock()
+	if db.repositoryNames != nil && time.Since(db.repositoryNamesLoaded) < repositoryNamesLifetime {
+		return db.repositoryNames, nil
+	}
+	var names []string
+	if err := db.Model(&repository{}).Pluck("repository_name", &names).Error; err != nil {
+		return nil, err
+	}
+	db.repositoryNames = make(map[string]bool, len(names))
+	for _, name := range names {
+		db.repositoryNames[name] = true
+	}
+	db.repositoryNamesLoaded = time.Now()
+	return db.repositoryNames, nil
+}
+
+// invalidateRepositoryNames forces loading the names of the repositories again
+func (db *datastore) invalidateRepositoryNames() {
+	db.repositoryNamesLock.Lock()
+	defer db.repositoryNamesLock.Unlock()
+	db.repositoryNames = nil
+}
+
 func (db *datastore) Close() error {
 	return db.DB.Close()
 }
 
 func (db *datastore) addRepositories(cfg *config) error {
+	// Reject configurations, which would make resolving projects through the bases fail
+	graph, err := db.inheritanceGraph(cfg)
+	if err != nil {
+		return err
+	} else if err = graph.validate(); err != nil {
+		return err
+	}
 	dbRepos, err := db.AllRepositories()
 	if err != nil {
 		return err
@@ -173,10 +383,26 @@ func (db *datastore) addRepositories(cfg *config) error {
 	for _, repo := range dbRepos {
 		existingRepos[repo.Name()] = repo
 	}
-	for _, repo := range cfg.Indexes {
+	indexes := make(map[string]indexConfig, len(cfg.Indexes))
+	for _, index := range cfg.Indexes {
+		indexes[index.Name] = index
+		db.configured[index.Name] = true
+		baseNames, _ := splitBases(index.Bases)
+		for _, baseName := range baseNames {
+			db.configuredBases[baseName] = true
+		}
+	}
+	// Create the bases before the indexes inheriting from them
+	for _, name := range graph.sorted() {
+		repo, configured := indexes[name]
+		if !configured {
+			continue
+		}
+		baseNames, remoteURLs := splitBases(repo.Bases)
 		dbRepo, exists := existingRepos[repo.Name]
 		if !exists {
-			if _, err := newRepository(db, repo.Name, repo.Bases, cfg.StoragePath); err != nil {
+			dbRepo, err = newRepository(db, repo.Name, baseNames, cfg.StoragePath)
+			if err != nil {
 				return err
 			}
 		} else {
@@ -190,13 +416,13 @@ func (db *datastore) addRepositories(cfg *config) error {
 			if err != nil {
 				return err
 			}
-			baseNames := make([]string, len(bases))
+			currentNames := make([]string, len(bases))
 			for i, base := range bases {
-				baseNames[i] = base.Name()
+				currentNames[i] = base.Name()
 			}
-			if !slicesEqual(baseNames, repo.Bases) {
+			if !slicesEqual(currentNames, baseNames) {
 				var bases []Repository
-				for _, baseName := range repo.Bases {
+				for _, baseName := range baseNames {
 					base, err := db.GetRepository(baseName)
 					if err != nil {
 						return err
@@ -208,6 +434,88 @@ func (db *datastore) addRepositories(cfg *config) error {
 				}
 			}
 		}
+		if err = dbRepo.SetRemoteBases(remoteURLs); err != nil {
+			return err
+		}
+		if dbRepo.Upstream() != repo.Upstream {
+			if err = dbRepo.SetUpstream(repo.Upstream); err != nil {
+				return err
+			}
+		}
+		if repo.AllowOverwrite && !repo.isVolatile() {
+			return fmt.Errorf("invalid configuration of '%s': overwriting files requires a volatile index", repo.Name)
+		} else if dbRepo.IsVolatile() != repo.isVolatile() {
+			if err = dbRepo.SetVolatile(repo.isVolatile()); err != nil {
+				return err
+			}
+		}
+		if dbRepo.AllowsOverwrite() != repo.AllowOverwrite {
+			if err = dbRepo.SetAllowOverwrite(repo.AllowOverwrite); err != nil {
+				return err
+			}
+		}
+		shadowing, err := parseShadowingPolicy(repo.Shadowing)
+		if err != nil {
+			return fmt.Errorf("invalid configuration of '%s': %s", repo.Name, err)
+		} else if dbRepo.ShadowingPolicy() != shadowing {
+			if err = dbRepo.SetShadowingPolicy(shadowing); err != nil {
+				return err
+			}
+		}
+		if dbRepo.MaxUploadSize() != repo.MaxUploadSize {
+			if err = dbRepo.SetMaxUploadSize(repo.MaxUploadSize); err != nil {
+				return err
+			}
+		}
+		permissions := repo.Permissions
+		if permissions == nil {
+			permissions = &defaultPermissions
+		}
+		if err = dbRepo.SetPermissions(permissions.toMap()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+backfillMetadata reads the metadata of all files stored without a release
+from the archives on disk and adds them to the corresponding release.
+Files not readable are skipped, because they might be no python distributions at all.
+Each file is only read once, the attempt is stored even if it failed.
+*/
+func (db *datastore) backfillMetadata() error {
+	var files []*projectFile
+	err := db.Where("(release_id IS NULL OR release_id = 0) AND (upstream_url IS NULL OR upstream_url = '')").
+		Where("metadata_attempted = ?", false).
+		Find(&files).Error
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		file.db = db
+		metadata, readErr := file.readMetadata()
+		if err = db.Model(file).Update("MetadataAttempted", true).Error; err != nil {
+			return err
+		} else if readErr != nil {
+			log.Printf("unable to read the metadata of '%s': %s", file.Name(), readErr)
+			continue
+		}
+		prj := &project{}
+		if err = db.First(prj, file.ProjectID).Error; err != nil {
+			return err
+		}
+		prj.db = db
+		release, err := prj.AddRelease(*metadata)
+		if err != nil {
+			return err
+		}
+		if err = file.SetRequiresPython(metadata.RequiresPython); err != nil {
+			return err
+		}
+		if err = file.SetRelease(release); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -137,6 +137,47 @@ func (suite *DatastoreTestSuite) TestNew() {
 	suite.Require().Nil(db.Close(), "unable to close the database connection")
 }
 
+// appendConfiguration appends the given lines to the configuration file
+func (suite *DatastoreTestSuite) appendConfiguration(content string) {
+	configFile, err := os.OpenFile(suite.configurationFile, os.O_APPEND|os.O_WRONLY, 0)
+	suite.Require().Nil(err, "unable to open the configuration file")
+	_, err = configFile.WriteString(content)
+	suite.Require().Nil(err, "unable to write the configuration file")
+	suite.Require().Nil(configFile.Close(), "unable to close the configuration file")
+}
+
+func (suite *DatastoreTestSuite) TestRedirectRequiresSigner() {
+	suite.appendConfiguration("storage:\n  type: local\n  redirect: true\n")
+	_, err := New(suite.configurationFile)
+	suite.Require().NotNil(err, "redirects have been enabled for the local storage")
+}
+
+func (suite *DatastoreTestSuite) TestRedirectLifetime() {
+	require := suite.Require()
+	suite.appendConfiguration(`storage:
+  type: s3
+  redirect: true
+  s3:
+    endpoint: "http://127.0.0.1:9000"
+    bucket: "packages"
+    accessKey: "access"
+    secretKey: "secret"
+`)
+	original, err := ioutil.ReadFile(suite.configurationFile)
+	require.Nil(err, "unable to read the configuration file")
+	for _, lifetime := range []string{"-60", "604801"} {
+		require.Nil(ioutil.WriteFile(suite.configurationFile, original, 0600), "unable to reset the configuration file")
+		suite.appendConfiguration("  redirectLifetime: " + lifetime + "\n")
+		_, err = New(suite.configurationFile)
+		require.NotNil(err, "the redirect lifetime %s has been accepted", lifetime)
+	}
+	require.Nil(ioutil.WriteFile(suite.configurationFile, original, 0600), "unable to reset the configuration file")
+	suite.appendConfiguration("  redirectLifetime: 604800\n")
+	db, err := New(suite.configurationFile)
+	require.Nil(err, "the maximum redirect lifetime has been rejected")
+	require.Nil(db.Close(), "unable to close the database connection")
+}
+
 func (suite *DatastoreTestSuite) TestGetRepository() {
 	db, err := New(suite.configurationFile)
 	suite.Require().Nil(err, "unable to create a new data store")
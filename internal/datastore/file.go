@@ -3,6 +3,11 @@ package datastore
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/hansingt/GoatCheese/internal/distribution"
+	"github.com/hansingt/GoatCheese/internal/simple"
+	"github.com/hansingt/GoatCheese/internal/storage"
 	"github.com/jinzhu/gorm"
 	"io"
 	"log"
@@ -16,7 +21,7 @@ It defines that a project file needs to have the following properties:
 
 - Name
 - Checksum
-- FilePath
+- Content
 - Lock
 
 Additionally, a file needs to be lockable, can be written and deleted.
@@ -28,19 +33,54 @@ type ProjectFile interface {
 	IsLocked() bool                    // IsLocked checks whether this file is currently locked by another thread
 	Lock() error                       // Lock locks this project file for writing or deletion
 	Unlock() error                     // Unlock unlocks this project file for the other threads
-	FilePath() string                  // FilePath returns the file path of the project file on the data storage
+	Open() (storage.Object, error)     // Open opens the content of the project file for reading
+	SignedURL() (string, error)        // SignedURL returns a time-limited URL of the content, or "" if downloads are not redirected
 	Write(content io.Reader) error     // Write writes the contents from the given io.Reader to the file
-	Delete() error                     // Delete deletes the project file from the database
+	Delete() error                     // Delete deletes the project file from the database and the disk
+	Fetch() error                      // Fetch downloads the file from the upstream index, if it is not cached yet
+	Project() (Project, error)         // Project returns the project storing the file
+	Release() (Release, error)         // Release returns the release the file belongs to, or nil if unknown
+	SetRelease(release Release) error  // SetRelease sets the release the file belongs to
+	RequiresPython() string            // RequiresPython returns the Requires-Python specifier of the file
+	SetRequiresPython(string) error    // SetRequiresPython sets the Requires-Python specifier of the file
+	IsYanked() bool                    // IsYanked checks whether the file has been yanked as defined in PEP 592
+	YankedReason() string              // YankedReason returns the reason given for yanking the file
+	Yank(reason string) error          // Yank marks the file as yanked
+	Unyank() error                     // Unyank reverts yanking the file
 }
 
+// ErrFileExists is returned, if a file with the same name but different contents already exists
+var ErrFileExists = errors.New("file already exists")
+
+// ErrLocked is returned, if a file can not be modified, because it is currently locked for uploading
+var ErrLocked = errors.New("the file is currently locked for uploading")
+
 type projectFile struct {
 	gorm.Model
 	db           *datastore `gorm:"-"`
 	ProjectID    uint       `gorm:"unique_index:idx_project_file;NOT NULL"`
+	ReleaseID    uint       `gorm:"index"`
 	FileName     string     `gorm:"unique_index:idx_project_file;NOT NULL"`
 	FileChecksum string
-	Locked       bool `gorm:"NOT NULL"`
-	ProjectPath  string
+	// BlobChecksum is the checksum of the blob containing the content of the file.
+	// It is empty, if the content has not been stored yet.
+	BlobChecksum string `gorm:"index"`
+	// Locked is not used anymore, files are locked using leases stored as fileLock.
+	// The column is kept, because older databases define it as NOT NULL.
+	Locked    bool   `gorm:"NOT NULL"`
+	lockOwner string `gorm:"-"`
+	// project is the project the file has been listed of, if any
+	project     *project `gorm:"-"`
+	ProjectPath string
+	UpstreamURL string
+	// RequiresPythonSpecifier is the Requires-Python metadata of the file.
+	// It is stored per file, because a release might contain files for different python versions.
+	RequiresPythonSpecifier string
+	Yanked                  bool `gorm:"NOT NULL"`
+	YankReason              string
+	// MetadataAttempted is true, if reading the metadata of a file stored without a release has been tried.
+	// Files, which are no python distributions, are not read again on every start.
+	MetadataAttempted bool `gorm:"NOT NULL;default:false"`
 }
 
 func newProjectFile(db *datastore, projectID uint, fileName string, projectPath string) (ProjectFile, error) {
@@ -49,7 +89,6 @@ func newProjectFile(db *datastore, projectID uint, fileName string, projectPath
 		ProjectID:   projectID,
 		FileName:    fileName,
 		ProjectPath: projectPath,
-		Locked:      false,
 	}
 	return file, db.Create(file).Error
 }
@@ -63,58 +102,343 @@ func (f *projectFile) Checksum() string {
 }
 
 func (f *projectFile) SetChecksum(checksum string) error {
+	if err := f.checkReplaceable(); err != nil {
+		return err
+	}
 	f.FileChecksum = checksum
 	return f.db.Model(f).Updates(f).Error
 }
 
 func (f *projectFile) IsLocked() bool {
-	return f.Locked
+	locked, err := f.db.isLocked(f.ID)
+	if err != nil {
+		log.Printf("unable to check the lock of '%s': %s", f.Name(), err)
+		// Rather deny modifications than allowing concurrent ones
+		return true
+	}
+	return locked
 }
 
 func (f *projectFile) Lock() error {
-	return f.db.Model(f).Update("Locked", true).Error
+	owner, err := f.db.acquireLock(f.ID)
+	if err != nil {
+		return err
+	}
+	f.lockOwner = owner
+	return nil
 }
 
 func (f *projectFile) Unlock() error {
-	return f.db.Model(f).Update("Locked", false).Error
+	if f.lockOwner == "" {
+		return fmt.Errorf("the file '%s' has not been locked", f.Name())
+	}
+	err := f.db.releaseLock(f.ID, f.lockOwner)
+	if err == nil {
+		f.lockOwner = ""
+	}
+	return err
+}
+
+func (f *projectFile) Open() (storage.Object, error) {
+	if f.BlobChecksum == "" {
+		return nil, &os.PathError{Op: "open", Path: f.Name(), Err: os.ErrNotExist}
+	}
+	return f.db.storage.Open(blobKey(f.BlobChecksum))
+}
+
+func (f *projectFile) SignedURL() (string, error) {
+	if f.db.redirectLifetime <= 0 || f.BlobChecksum == "" {
+		return "", nil
+	}
+	signer, ok := f.db.storage.(storage.Signer)
+	if !ok {
+		return "", nil
+	}
+	return signer.SignedURL(blobKey(f.BlobChecksum), f.Name(), f.db.redirectLifetime)
 }
 
-func (f *projectFile) FilePath() string {
+/*
+legacyPath returns the path the file has been stored at before the blob store has been introduced.
+*/
+func (f *projectFile) legacyPath() string {
 	return filepath.Join(f.ProjectPath, f.FileName)
 }
 
 func (f *projectFile) Write(content io.Reader) error {
-	var outputFile *os.File
-	var err error
-	if outputFile, err = os.OpenFile(f.FilePath(), os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0640); err != nil {
+	if err := f.checkReplaceable(); err != nil {
+		return err
+	}
+	return f.write(content, "")
+}
+
+/*
+write atomically replaces the content of the file and updates the checksum.
+If an expected checksum is given, the content is only replaced if it matches.
+*/
+func (f *projectFile) write(content io.Reader, expectedChecksum string) error {
+	tempFile, err := f.db.createTempFile(".write-*")
+	if err != nil {
 		return err
 	}
 	defer func() {
-		if err = outputFile.Close(); err != nil {
-			log.Fatalf("Error while closing the output file: %s", err)
-		}
+		// Closing fails, if the file has been closed already
+		_ = tempFile.Close()
+		_ = removeFile(tempFile.Name())
 	}()
 
-	var n int
-	buffer := make([]byte, 100*1024*1024) // 100MiB
 	hashBuilder := sha256.New()
-	for {
-		if n, err = content.Read(buffer); err != nil {
-			if err != io.EOF {
+	if _, err = io.Copy(io.MultiWriter(tempFile, hashBuilder), content); err != nil {
+		return err
+	}
+	checksum := hex.EncodeToString(hashBuilder.Sum(nil))
+	if expectedChecksum != "" && checksum != expectedChecksum {
+		return fmt.Errorf("the checksum of '%s' does not match: '%s' != '%s'", f.Name(), checksum, expectedChecksum)
+	}
+	if err = syncAndVerify(tempFile, checksum); err != nil {
+		return err
+	}
+	return f.setBlob(tempFile.Name(), checksum, nil)
+}
+
+/*
+setBlob moves the temporary file into the blob store and replaces the content of the file with it.
+If the file is locked, its lease is renewed together with the update. The content is not replaced,
+if the lease expired while the file has been imported and another owner took it over.
+The update, if any, is applied within the same transaction as replacing the content.
+*/
+func (f *projectFile) setBlob(tempPath string, checksum string, update func(tx *gorm.DB) error) error {
+	if err := f.db.storeBlob(tempPath, checksum); err != nil {
+		return err
+	}
+	previous := f.BlobChecksum
+	err := f.db.Transaction(func(tx *gorm.DB) error {
+		if f.lockOwner != "" {
+			if err := f.db.renewLock(tx, f.ID, f.lockOwner); err != nil {
 				return err
 			}
-			break
 		}
-		if _, err = hashBuilder.Write(buffer[:n]); err != nil {
+		err := tx.Model(f).Updates(map[string]interface{}{
+			"FileChecksum": checksum,
+			"BlobChecksum": checksum,
+		}).Error
+		if err != nil || update == nil {
+			return err
+		}
+		return update(tx)
+	})
+	if err != nil {
+		_ = f.db.releaseBlob(checksum)
+		return err
+	}
+	f.FileChecksum = checksum
+	f.BlobChecksum = checksum
+	return f.db.releaseBlob(previous)
+}
+
+/*
+removeContent removes the content of a deleted file from the data storage.
+*/
+func (f *projectFile) removeContent() error {
+	if f.BlobChecksum != "" {
+		return f.db.releaseBlob(f.BlobChecksum)
+	}
+	return removeFile(f.legacyPath())
+}
+
+func (f *projectFile) Delete() error {
+	if err := f.db.checkProjectVolatile(f.ProjectID); err != nil {
+		return err
+	}
+	return f.remove()
+}
+
+/*
+remove deletes this file regardless of the repository being volatile.
+It is used to clean up files, which have not been added completely.
+*/
+func (f *projectFile) remove() error {
+	// Delete the row first. A crash in between leaves an orphaned file on disk,
+	// but never a row pointing to a missing file.
+	err := f.db.Transaction(func(tx *gorm.DB) error {
+		// Files locked by other owners are not removed
+		if f.lockOwner != "" {
+			if err := f.db.renewLock(tx, f.ID, f.lockOwner); err != nil {
+				return err
+			}
+		} else if err := checkUnlocked(tx, "id = ?", f.ID); err != nil {
 			return err
 		}
-		if _, err = outputFile.Write(buffer[:n]); err != nil {
+		if err := deleteLocks(tx, "id = ?", f.ID); err != nil {
 			return err
 		}
+		return tx.Unscoped().Delete(f).Error
+	})
+	if err != nil {
+		return err
 	}
-	return f.SetChecksum(hex.EncodeToString(hashBuilder.Sum(nil)))
+	return f.removeContent()
 }
 
-func (f *projectFile) Delete() error {
-	return f.db.Delete(f).Error
+/*
+removeFile removes a file from the disk. Files already removed are ignored.
+*/
+func removeFile(filePath string) error {
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (f *projectFile) Fetch() error {
+	if f.UpstreamURL == "" {
+		return nil
+	} else if f.BlobChecksum != "" {
+		return nil
+	}
+	client := &simple.Client{HTTP: f.db.httpClient, Downloads: f.db.downloadClient}
+	content, err := client.Download(f.UpstreamURL)
+	if err != nil {
+		return err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer content.Close()
+
+	if err = f.write(content, f.Checksum()); err != nil {
+		return fmt.Errorf("unable to fetch '%s': %s", f.UpstreamURL, err)
+	}
+	return nil
+}
+
+func (f *projectFile) Project() (Project, error) {
+	if f.project != nil {
+		return f.project, nil
+	}
+	prj := &project{}
+	if err := f.db.First(prj, f.ProjectID).Error; err != nil {
+		return nil, err
+	}
+	prj.db = f.db
+	return prj, nil
+}
+
+func (f *projectFile) Release() (Release, error) {
+	if f.ReleaseID == 0 {
+		return nil, nil
+	}
+	release := &release{}
+	err := f.db.First(release, f.ReleaseID).Error
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			return nil, err
+		}
+		return nil, nil
+	}
+	release.db = f.db
+	return release, nil
+}
+
+func (f *projectFile) SetRelease(rel Release) error {
+	f.ReleaseID = rel.(*release).ID
+	return f.db.Model(f).Update("ReleaseID", f.ReleaseID).Error
+}
+
+func (f *projectFile) RequiresPython() string {
+	return f.RequiresPythonSpecifier
+}
+
+func (f *projectFile) SetRequiresPython(specifier string) error {
+	f.RequiresPythonSpecifier = specifier
+	return f.db.Model(f).Update("RequiresPythonSpecifier", specifier).Error
+}
+
+/*
+readMetadata reads the metadata from the distribution archive stored on disk.
+*/
+func (f *projectFile) readMetadata() (*distribution.Metadata, error) {
+	object, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer object.Close()
+	if content, ok := object.(io.ReaderAt); ok {
+		return distribution.ReadMetadata(f.Name(), content, object.Size())
+	}
+	// Archives need random access, thus copy objects not supporting it to a local file
+	tempFile, err := f.db.createTempFile(".read-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tempFile.Close()
+		_ = removeFile(tempFile.Name())
+	}()
+	size, err := io.Copy(tempFile, object)
+	if err != nil {
+		return nil, err
+	}
+	return distribution.ReadMetadata(f.Name(), tempFile, size)
+}
+
+func (f *projectFile) IsYanked() bool {
+	return f.Yanked
+}
+
+func (f *projectFile) YankedReason() string {
+	return f.YankReason
+}
+
+func (f *projectFile) Yank(reason string) error {
+	f.Yanked = true
+	f.YankReason = reason
+	return f.db.Model(f).Updates(map[string]interface{}{
+		"Yanked":     f.Yanked,
+		"YankReason": f.YankReason,
+	}).Error
+}
+
+func (f *projectFile) Unyank() error {
+	f.Yanked = false
+	f.YankReason = ""
+	return f.db.Model(f).Updates(map[string]interface{}{
+		"Yanked":     f.Yanked,
+		"YankReason": f.YankReason,
+	}).Error
+}
+
+/*
+syncAndVerify flushes the file to the disk, closes it and verifies that
+its contents on the disk match the checksum.
+*/
+func syncAndVerify(file *os.File, checksum string) error {
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	written, err := os.Open(file.Name())
+	if err != nil {
+		return err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer written.Close()
+	actualChecksum, err := contentChecksum(written)
+	if err != nil {
+		return err
+	} else if actualChecksum != checksum {
+		return fmt.Errorf("the file '%s' has not been written correctly", file.Name())
+	}
+	return nil
+}
+
+/*
+contentChecksum calculates the sha256 checksum of the content.
+*/
+func contentChecksum(content io.Reader) (string, error) {
+	hashBuilder := sha256.New()
+	if _, err := io.Copy(hashBuilder, content); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hashBuilder.Sum(nil)), nil
 }
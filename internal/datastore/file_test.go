@@ -5,9 +5,11 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"github.com/stretchr/testify/suite"
+	"io/ioutil"
 	"os"
-	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -52,12 +54,17 @@ func (suite *projectFileTestSuite) TestLocking() {
 	require.False(suite.file.IsLocked(), "the file is still locked")
 }
 
-func (suite *projectFileTestSuite) TestFilePath() {
+func (suite *projectFileTestSuite) TestOpen() {
 	require := suite.Require()
-	require.Equal(
-		suite.file.FilePath(),
-		filepath.Join(suite.storagePath, suite.file.Name()),
-		"the filepath is not valid")
+	_, err := suite.file.Open()
+	require.True(os.IsNotExist(err), "the content of an empty file has been opened")
+
+	require.Nil(suite.file.Write(bytes.NewReader([]byte("content"))), "unable to write the file")
+	object, err := suite.file.Open()
+	require.Nil(err, "unable to open the file")
+	//noinspection GoUnhandledErrorResult
+	defer object.Close()
+	require.Equal(int64(7), object.Size(), "the size of the file is not valid")
 }
 
 func (suite *projectFileTestSuite) TestDelete() {
@@ -72,6 +79,15 @@ func (suite *projectFileTestSuite) TestDelete() {
 
 	// And re-check that it does not exist
 	require.NotNil(suite.db.Find(&check, suite.file).Error, "Found the file in the database")
+	require.NotNil(suite.db.Unscoped().Find(&check, suite.file).Error, "the file has only been soft deleted")
+}
+
+func (suite *projectFileTestSuite) TestDeleteRemovesFile() {
+	require := suite.Require()
+	require.Nil(suite.file.Write(bytes.NewReader([]byte("content"))), "unable to write the file")
+	require.Nil(suite.file.Delete(), "could not delete the file")
+	_, err := readContent(suite.file)
+	require.True(os.IsNotExist(err), "the file has not been removed from the disk")
 }
 
 func (suite *projectFileTestSuite) TestWrite() {
@@ -90,14 +106,7 @@ func (suite *projectFileTestSuite) TestWrite() {
 	require.Nil(suite.file.Write(bytes.NewReader(content)), "unable to write the contents to the file")
 
 	// And then read them to check the content
-	var outputFile *os.File
-	outputFile, err = os.Open(suite.file.FilePath())
-	require.Nil(err, "unable to open the target file for reading")
-	//noinspection GoUnhandledErrorResult
-	defer outputFile.Close()
-
-	check := make([]byte, len(content))
-	_, err = outputFile.Read(check)
+	check, err := readContent(suite.file)
 	require.Nil(err, "unable to read the output file contents")
 
 	for i, b := range content {
@@ -106,3 +115,63 @@ func (suite *projectFileTestSuite) TestWrite() {
 	// Also check, that the checksum has been calculated
 	require.Equal(suite.file.Checksum(), contentChecksum, "the content checksums don't match")
 }
+
+// failingReader returns an error after returning the content
+type failingReader struct {
+	content []byte
+}
+
+func (r *failingReader) Read(data []byte) (int, error) {
+	if len(r.content) == 0 {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(data, r.content)
+	r.content = r.content[n:]
+	return n, nil
+}
+
+func (suite *projectFileTestSuite) TestWriteIsAtomic() {
+	require := suite.Require()
+	content := []byte("original content")
+	require.Nil(suite.file.Write(bytes.NewReader(content)), "unable to write the file")
+	checksum := suite.file.Checksum()
+
+	// A failing write leaves the original file in place
+	require.NotNil(suite.file.Write(&failingReader{content: []byte("truncated")}), "no error has been raised")
+	stored, err := readContent(suite.file)
+	require.Nil(err, "unable to read the file")
+	require.Equal(content, stored, "the file has been modified")
+	require.Equal(checksum, suite.file.Checksum(), "the checksum has been modified")
+
+	// Contents not matching the expected checksum are not moved into place
+	require.NotNil(suite.file.(*projectFile).write(bytes.NewReader([]byte("other content")), checksum))
+	stored, err = readContent(suite.file)
+	require.Nil(err, "unable to read the file")
+	require.Equal(content, stored, "the file has been modified")
+
+	entries, err := ioutil.ReadDir(suite.storagePath)
+	require.Nil(err, "unable to list the storage directory")
+	for _, entry := range entries {
+		require.False(strings.HasPrefix(entry.Name(), ".write-"), "the temporary file '%s' has been left behind", entry.Name())
+	}
+}
+
+func (suite *projectFileTestSuite) TestYank() {
+	require := suite.Require()
+	require.False(suite.file.IsYanked(), "the file is unexpected yanked")
+
+	require.Nil(suite.file.Yank("broken"), "could not yank the file")
+	require.True(suite.file.IsYanked(), "the file is not yanked")
+	require.Equal("broken", suite.file.YankedReason())
+
+	var check projectFile
+	require.Nil(suite.db.First(&check, suite.file.(*projectFile).ID).Error, "could not find the file in the database")
+	require.True(check.IsYanked(), "the yanked state has not been stored")
+	require.Equal("broken", check.YankedReason(), "the reason has not been stored")
+
+	require.Nil(suite.file.Unyank(), "could not un-yank the file")
+	require.False(suite.file.IsYanked(), "the file is still yanked")
+	require.Equal("", suite.file.YankedReason(), "the reason has not been reset")
+	require.Nil(suite.db.First(&check, suite.file.(*projectFile).ID).Error, "could not find the file in the database")
+	require.False(check.IsYanked(), "the un-yanked state has not been stored")
+}
@@ -0,0 +1,138 @@
+package datastore
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+inheritanceGraph maps the name of each index to the names of its local bases.
+*/
+type inheritanceGraph map[string][]string
+
+/*
+inheritanceGraph builds the graph of the indexes defined in the configuration.
+Repositories only defined in the database are included with their stored bases,
+as configured indexes might inherit from them.
+*/
+func (db *datastore) inheritanceGraph(cfg *config) (inheritanceGraph, error) {
+	graph := make(inheritanceGraph, len(cfg.Indexes))
+	for _, index := range cfg.Indexes {
+		if _, exists := graph[index.Name]; exists {
+			return nil, fmt.Errorf("the index '%s' is defined more than once", index.Name)
+		}
+		graph[index.Name], _ = splitBases(index.Bases)
+	}
+	repos, err := db.AllRepositories()
+	if err != nil {
+		return nil, err
+	}
+	for _, repo := range repos {
+		if _, exists := graph[repo.Name()]; exists {
+			continue
+		}
+		bases, err := repo.Bases()
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, len(bases))
+		for i, base := range bases {
+			names[i] = base.Name()
+		}
+		graph[repo.Name()] = names
+	}
+	return graph, nil
+}
+
+/*
+names returns the names of all indexes of the graph in a stable order.
+*/
+func (g inheritanceGraph) names() []string {
+	names := make([]string, 0, len(g))
+	for name := range g {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+validate checks that all bases are defined and that no index inherits from itself.
+*/
+func (g inheritanceGraph) validate() error {
+	var undefined []string
+	for _, name := range g.names() {
+		for _, base := range g[name] {
+			if _, defined := g[base]; !defined {
+				undefined = append(undefined, fmt.Sprintf("'%s' (base of '%s')", base, name))
+			}
+		}
+	}
+	if len(undefined) > 0 {
+		return fmt.Errorf("undefined base indexes: %s", strings.Join(undefined, ", "))
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(g))
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			// The path contains the cycle starting at the first occurrence of the index
+			for i, previous := range path {
+				if previous == name {
+					cycle := append(append([]string{}, path[i:]...), name)
+					return fmt.Errorf("inheritance cycle between indexes: %s", strings.Join(cycle, " -> "))
+				}
+			}
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, base := range g[name] {
+			if err := visit(base); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, name := range g.names() {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+sorted returns the names of all indexes ordered such that each index follows its bases.
+The graph has to be valid.
+*/
+func (g inheritanceGraph) sorted() []string {
+	result := make([]string, 0, len(g))
+	added := make(map[string]bool, len(g))
+	var add func(name string)
+	add = func(name string) {
+		if added[name] {
+			return
+		}
+		added[name] = true
+		for _, base := range g[name] {
+			add(base)
+		}
+		result = append(result, name)
+	}
+	for _, name := range g.names() {
+		add(name)
+	}
+	return result
+}
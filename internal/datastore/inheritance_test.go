@@ -0,0 +1,118 @@
+package datastore
+
+import (
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type inheritanceTestSuite struct {
+	TestSuiteWithDatastore
+}
+
+func TestInheritance(t *testing.T) {
+	suite.Run(t, new(inheritanceTestSuite))
+}
+
+// configuration returns a configuration of indexes with the given bases
+func (suite *inheritanceTestSuite) configuration(indexes map[string][]string) *config {
+	cfg := &config{StoragePath: suite.storagePath}
+	for name, bases := range indexes {
+		cfg.Indexes = append(cfg.Indexes, indexConfig{Name: name, Bases: bases})
+	}
+	return cfg
+}
+
+func (suite *inheritanceTestSuite) TestValidConfiguration() {
+	cfg := suite.configuration(map[string][]string{
+		"base":   {},
+		"test":   {"base", "https://remote.example/simple/"},
+		"team":   {"test", "base"},
+		"remote": {"http://remote.example/simple/"},
+	})
+	suite.Require().Nil(suite.db.addRepositories(cfg), "a valid configuration has been rejected")
+}
+
+func (suite *inheritanceTestSuite) TestUndefinedBase() {
+	cfg := suite.configuration(map[string][]string{
+		"base": {},
+		"test": {"bsae"},
+	})
+	err := suite.db.addRepositories(cfg)
+	suite.Require().NotNil(err, "an undefined base has been accepted")
+	suite.Require().Contains(err.Error(), "'bsae' (base of 'test')")
+}
+
+func (suite *inheritanceTestSuite) TestCycle() {
+	cfg := suite.configuration(map[string][]string{
+		"a": {"b"},
+		"b": {"c"},
+		"c": {"a"},
+		"d": {"a"},
+	})
+	err := suite.db.addRepositories(cfg)
+	suite.Require().NotNil(err, "an inheritance cycle has been accepted")
+	suite.Require().Contains(err.Error(), "a -> b -> c -> a")
+
+	repos, err := suite.db.AllRepositories()
+	suite.Require().Nil(err, "unable to get the repositories")
+	suite.Require().Empty(repos, "repositories of an invalid configuration have been added")
+}
+
+func (suite *inheritanceTestSuite) TestSelfReference() {
+	err := suite.db.addRepositories(suite.configuration(map[string][]string{"a": {"a"}}))
+	suite.Require().NotNil(err, "an index inheriting from itself has been accepted")
+	suite.Require().Contains(err.Error(), "a -> a")
+}
+
+func (suite *inheritanceTestSuite) TestDuplicateIndex() {
+	cfg := &config{StoragePath: suite.storagePath, Indexes: []indexConfig{{Name: "a"}, {Name: "a"}}}
+	suite.Require().NotNil(suite.db.addRepositories(cfg), "an index defined twice has been accepted")
+}
+
+func (suite *inheritanceTestSuite) TestStoredRepositories() {
+	// Repositories stored in the database are valid bases
+	_, err := newRepository(suite.db, "stored", nil, suite.storagePath)
+	suite.Require().Nil(err, "unable to create the repository")
+	cfg := suite.configuration(map[string][]string{"test": {"stored"}})
+	suite.Require().Nil(suite.db.addRepositories(cfg), "a stored repository has been rejected as base")
+}
+
+func (suite *inheritanceTestSuite) TestCreationOrder() {
+	require := suite.Require()
+	cfg := &config{StoragePath: suite.storagePath, Indexes: []indexConfig{
+		{Name: "team", Bases: []string{"test", "base"}},
+		{Name: "test", Bases: []string{"base"}},
+		{Name: "base"},
+	}}
+	require.Nil(suite.db.addRepositories(cfg), "unable to add the repositories")
+	suite.requireBases("team", "test", "base")
+	suite.requireBases("test", "base")
+
+	// Reordering the bases is stored as well
+	cfg.Indexes[0].Bases = []string{"base", "test"}
+	require.Nil(suite.db.addRepositories(cfg), "unable to update the repositories")
+	suite.requireBases("team", "base", "test")
+}
+
+// requireBases requires the repository to have the given bases in the given order
+func (suite *inheritanceTestSuite) requireBases(repositoryName string, baseNames ...string) {
+	repo, err := suite.db.GetRepository(repositoryName)
+	suite.Require().Nil(err, "unable to get the repository '%s'", repositoryName)
+	bases, err := repo.Bases()
+	suite.Require().Nil(err, "unable to get the bases of '%s'", repositoryName)
+	names := make([]string, len(bases))
+	for i, base := range bases {
+		names[i] = base.Name()
+	}
+	suite.Require().Equal(baseNames, names, "the bases of '%s' differ", repositoryName)
+}
+
+func (suite *inheritanceTestSuite) TestSorted() {
+	graph := inheritanceGraph{
+		"a": {"b", "c"},
+		"b": {"c"},
+		"c": {},
+		"d": {},
+	}
+	suite.Require().Equal([]string{"c", "b", "a", "d"}, graph.sorted())
+}
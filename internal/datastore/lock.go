@@ -0,0 +1,165 @@
+package datastore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/hansingt/GoatCheese/internal/storage"
+	"github.com/jinzhu/gorm"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultLockTimeout is the time after which locks are considered stale, if no other timeout is configured
+const defaultLockTimeout = 5 * time.Minute
+
+/*
+fileLock is a lease on a project file held while the file is modified.
+
+Leases are stored in the database, so that they are shared between all GoatCheese
+instances using the same database. A lease expires after the lock timeout. Thus,
+locks held by crashed instances are not kept forever, but can be taken over.
+*/
+type fileLock struct {
+	ProjectFileID uint      `gorm:"primary_key;auto_increment:false"`
+	Owner         string    `gorm:"NOT NULL"`
+	ExpiresAt     time.Time `gorm:"index;NOT NULL"`
+}
+
+/*
+newInstanceID creates an identifier of this GoatCheese instance used to name the owners of locks.
+*/
+func newInstanceID() string {
+	hostName, err := os.Hostname()
+	if err != nil {
+		hostName = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostName, os.Getpid())
+}
+
+/*
+acquireLock acquires the lease on a project file and returns its owner.
+It returns ErrLocked, if another unexpired lease exists.
+*/
+func (db *datastore) acquireLock(projectFileID uint) (string, error) {
+	now := time.Now().UTC()
+	// Take over expired leases
+	err := db.Delete(&fileLock{}, "project_file_id = ? AND expires_at < ?", projectFileID, now).Error
+	if err != nil {
+		return "", err
+	}
+	token := make([]byte, 8)
+	if _, err = rand.Read(token); err != nil {
+		return "", err
+	}
+	lock := &fileLock{
+		ProjectFileID: projectFileID,
+		Owner:         db.instanceID + "/" + hex.EncodeToString(token),
+		ExpiresAt:     now.Add(db.lockTimeout),
+	}
+	// Creating the lease fails, if another instance holds it
+	if err = db.Create(lock).Error; err != nil {
+		if locked, lockErr := db.isLocked(projectFileID); lockErr == nil && locked {
+			return "", ErrLocked
+		}
+		return "", err
+	}
+	return lock.Owner, nil
+}
+
+/*
+renewLock extends the lease on a project file held by the owner.
+It returns ErrLocked, if the lease expired and has been taken over by another owner meanwhile.
+*/
+func (db *datastore) renewLock(tx *gorm.DB, projectFileID uint, owner string) error {
+	renewed := tx.Model(&fileLock{}).Where("project_file_id = ? AND owner = ?", projectFileID, owner).
+		UpdateColumn("expires_at", time.Now().UTC().Add(db.lockTimeout))
+	if renewed.Error != nil {
+		return renewed.Error
+	} else if renewed.RowsAffected == 0 {
+		return ErrLocked
+	}
+	return nil
+}
+
+/*
+releaseLock releases the lease on a project file, if it is held by the owner.
+*/
+func (db *datastore) releaseLock(projectFileID uint, owner string) error {
+	return db.Delete(&fileLock{}, "project_file_id = ? AND owner = ?", projectFileID, owner).Error
+}
+
+/*
+isLocked checks whether an unexpired lease on the project file exists.
+*/
+func (db *datastore) isLocked(projectFileID uint) (bool, error) {
+	var count int
+	err := db.Model(&fileLock{}).
+		Where("project_file_id = ? AND expires_at >= ?", projectFileID, time.Now().UTC()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+/*
+lockedFiles selects the leases of the files matching the condition.
+*/
+func lockedFiles(db *gorm.DB, condition string, values ...interface{}) *gorm.DB {
+	files := db.Model(&projectFile{}).Select("id").Where(condition, values...).SubQuery()
+	return db.Model(&fileLock{}).Where("project_file_id IN (?)", files)
+}
+
+/*
+checkUnlocked returns ErrLocked, if any of the files is currently locked.
+*/
+func checkUnlocked(db *gorm.DB, condition string, values ...interface{}) error {
+	var count int
+	err := lockedFiles(db, condition, values...).
+		Where("expires_at >= ?", time.Now().UTC()).
+		Count(&count).Error
+	if err != nil {
+		return err
+	} else if count > 0 {
+		return ErrLocked
+	}
+	return nil
+}
+
+/*
+deleteLocks deletes the leases of the files matching the condition.
+It has to be called before the files are deleted.
+*/
+func deleteLocks(db *gorm.DB, condition string, values ...interface{}) error {
+	return lockedFiles(db, condition, values...).Delete(&fileLock{}).Error
+}
+
+/*
+recoverStaleLocks removes the leases expired while no instance has been running
+and the temporary files left behind by uploads interrupted by a crash.
+*/
+func (db *datastore) recoverStaleLocks(storagePath string) error {
+	expired := db.Delete(&fileLock{}, "expires_at < ?", time.Now().UTC())
+	if expired.Error != nil {
+		return expired.Error
+	} else if expired.RowsAffected > 0 {
+		log.Printf("Removed %d stale file locks", expired.RowsAffected)
+	}
+	// Temporary files not modified within the lock timeout are not written anymore
+	deadline := time.Now().Add(-db.lockTimeout)
+	return filepath.Walk(filepath.Join(storagePath, storage.TempDirectory), func(filePath string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		name := info.Name()
+		if info.Mode().IsRegular() && info.ModTime().Before(deadline) &&
+			(strings.HasPrefix(name, ".upload-") || strings.HasPrefix(name, ".write-") || strings.HasPrefix(name, ".read-")) {
+			log.Printf("Removing the temporary file '%s' of an interrupted upload", filePath)
+			return removeFile(filePath)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,134 @@
+package datastore
+
+import (
+	"bytes"
+	"github.com/hansingt/GoatCheese/internal/storage"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type lockTestSuite struct {
+	TestSuiteWithDatastore
+	file ProjectFile
+}
+
+func (suite *lockTestSuite) SetupTest() {
+	suite.TestSuiteWithDatastore.SetupTest()
+	file, err := newProjectFile(suite.db, 0, "test_app-1.0-py3-none-any.whl", suite.storagePath)
+	suite.Require().Nil(err, "unable to create a new project file")
+	suite.file = file
+}
+
+func TestLock(t *testing.T) {
+	suite.Run(t, new(lockTestSuite))
+}
+
+// otherInstance returns the file as loaded by another GoatCheese instance
+func (suite *lockTestSuite) otherInstance() ProjectFile {
+	other := &projectFile{}
+	suite.Require().Nil(suite.db.First(other, suite.file.(*projectFile).ID).Error, "unable to load the file")
+	other.db = suite.db
+	return other
+}
+
+func (suite *lockTestSuite) TestExclusive() {
+	require := suite.Require()
+	other := suite.otherInstance()
+	require.Nil(suite.file.Lock(), "unable to lock the file")
+	require.True(other.IsLocked(), "the lock is not visible to other instances")
+	require.Equal(ErrLocked, other.Lock(), "the file has been locked twice")
+	require.NotNil(other.Unlock(), "the lock has been released by another owner")
+	require.True(suite.file.IsLocked(), "the lock has been released by another owner")
+
+	require.Nil(suite.file.Unlock(), "unable to unlock the file")
+	require.False(other.IsLocked(), "the file is still locked")
+	require.Nil(other.Lock(), "unable to lock the released file")
+}
+
+func (suite *lockTestSuite) TestTakeOverExpiredLock() {
+	require := suite.Require()
+	suite.db.lockTimeout = -time.Second
+	require.Nil(suite.file.Lock(), "unable to lock the file")
+	require.False(suite.file.IsLocked(), "the expired lock is still active")
+
+	suite.db.lockTimeout = time.Minute
+	other := suite.otherInstance()
+	require.Nil(other.Lock(), "the expired lock has not been taken over")
+	require.True(suite.file.IsLocked(), "the file is not locked")
+	// The previous owner can not release the lock anymore
+	require.Nil(suite.file.Unlock(), "unable to unlock the file")
+	require.True(other.IsLocked(), "the lock of the new owner has been released")
+}
+
+func (suite *lockTestSuite) TestDeleteReleasesLock() {
+	require := suite.Require()
+	require.Nil(suite.file.Lock(), "unable to lock the file")
+	require.Nil(suite.file.Delete(), "unable to delete the file")
+	var count int
+	require.Nil(suite.db.Model(&fileLock{}).Count(&count).Error, "unable to count the locks")
+	require.Equal(0, count, "the lock of the deleted file has not been removed")
+}
+
+func (suite *lockTestSuite) TestRecoverStaleLocks() {
+	require := suite.Require()
+	suite.db.lockTimeout = -time.Second
+	require.Nil(suite.file.Lock(), "unable to lock the file")
+
+	stale := filepath.Join(suite.storagePath, storage.TempDirectory, ".upload-1234")
+	active := filepath.Join(suite.storagePath, storage.TempDirectory, ".upload-5678")
+	// Only the temporary directory contains temporary files
+	other := filepath.Join(suite.storagePath, ".upload-1234")
+	for _, fileName := range []string{stale, active, other} {
+		require.Nil(ioutil.WriteFile(fileName, []byte("partial"), 0640), "unable to create the temporary file")
+	}
+	past := time.Now().Add(-time.Hour)
+	require.Nil(os.Chtimes(stale, past, past), "unable to modify the temporary file")
+	require.Nil(os.Chtimes(other, past, past), "unable to modify the file")
+
+	suite.db.lockTimeout = time.Minute
+	require.Nil(suite.db.recoverStaleLocks(suite.storagePath), "unable to recover the stale locks")
+	var count int
+	require.Nil(suite.db.Model(&fileLock{}).Count(&count).Error, "unable to count the locks")
+	require.Equal(0, count, "the stale lock has not been removed")
+	_, err := os.Stat(stale)
+	require.True(os.IsNotExist(err), "the stale temporary file has not been removed")
+	_, err = os.Stat(active)
+	require.Nil(err, "the active temporary file has been removed")
+	_, err = os.Stat(other)
+	require.Nil(err, "a file outside of the temporary directory has been removed")
+}
+
+func (suite *lockTestSuite) TestExpiredLease() {
+	require := suite.Require()
+	suite.db.lockTimeout = -time.Second
+	require.Nil(suite.file.Lock(), "unable to lock the file")
+	suite.db.lockTimeout = time.Minute
+	// The lease is renewed, as long as it has not been taken over
+	require.Nil(suite.file.Write(bytes.NewReader([]byte("content"))), "unable to write the file")
+	require.True(suite.file.IsLocked(), "the lease has not been renewed")
+	require.Nil(suite.file.Unlock(), "unable to unlock the file")
+
+	suite.db.lockTimeout = -time.Second
+	require.Nil(suite.file.Lock(), "unable to lock the file")
+	suite.db.lockTimeout = time.Minute
+	other := suite.otherInstance()
+	require.Nil(other.Lock(), "the expired lock has not been taken over")
+	require.Equal(ErrLocked, suite.file.Write(bytes.NewReader([]byte("replaced"))),
+		"the file has been written without holding the lease")
+	require.Equal(ErrLocked, suite.file.Delete(), "the file has been deleted without holding the lease")
+	content, err := readContent(other)
+	require.Nil(err, "unable to read the file")
+	require.Equal([]byte("content"), content, "the content has been replaced")
+}
+
+func (suite *lockTestSuite) TestRemoveLocked() {
+	require := suite.Require()
+	require.Nil(suite.file.Lock(), "unable to lock the file")
+	other := suite.otherInstance()
+	require.Equal(ErrLocked, other.Delete(), "a file locked by another owner has been deleted")
+	require.Nil(suite.file.Delete(), "unable to delete the locked file")
+}
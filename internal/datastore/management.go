@@ -0,0 +1,305 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ErrRepositoryNotFound is returned, if a repository does not exist
+var ErrRepositoryNotFound = errors.New("repository not found")
+
+// ErrRepositoryExists is returned, if a repository can not be created or renamed, because the name is taken
+var ErrRepositoryExists = errors.New("a repository with the same name exists already")
+
+// ErrRepositoryConfigured is returned, if a repository defined in the configuration file should be modified
+var ErrRepositoryConfigured = errors.New("the repository is defined in the configuration file and can only be changed there")
+
+// ErrRepositoryInUse is returned, if a repository can not be deleted or renamed, because other repositories inherit from it
+var ErrRepositoryInUse = errors.New("the repository is a base of other repositories")
+
+/*
+ConfigurationError is returned, if a change would result in an invalid setup of repositories,
+like an invalid name, an undefined base or an inheritance cycle.
+*/
+type ConfigurationError struct {
+	message string
+}
+
+func (e *ConfigurationError) Error() string {
+	return e.message
+}
+
+/*
+repositoryNameRegExp matches the names of repositories created at runtime.
+Names consist of slash-separated segments, which must not start with a "+",
+as those are reserved for the paths of the API.
+*/
+var repositoryNameRegExp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*(/[A-Za-z0-9][A-Za-z0-9._-]*)*$`)
+
+/*
+checkManageable checks, that the repository with the given name is not defined in the
+configuration file, as changes to it would be reverted with the next start.
+*/
+func (db *datastore) checkManageable(repositoryName string) error {
+	if db.configured[repositoryName] {
+		return ErrRepositoryConfigured
+	}
+	return nil
+}
+
+/*
+findRepository returns the repository with the given name or ErrRepositoryNotFound.
+*/
+func (db *datastore) findRepository(repositoryName string) (*repository, error) {
+	repo, err := db.GetRepository(repositoryName)
+	if err != nil {
+		return nil, err
+	}
+	return repo.(*repository), nil
+}
+
+/*
+checkOverlap checks, that the name neither starts with the name of another repository followed by a slash,
+nor that another name starts with it. Request paths are matched by the longest repository name,
+thus the projects of one of the repositories would not be accessible. The repository named
+except is ignored, as it is renamed.
+*/
+func (db *datastore) checkOverlap(repositoryName string, except string) error {
+	names, err := db.loadRepositoryNames()
+	if err != nil {
+		return err
+	}
+	for name := range names {
+		if name == except {
+			continue
+		} else if strings.HasPrefix(repositoryName, name+"/") || strings.HasPrefix(name, repositoryName+"/") {
+			return &ConfigurationError{
+				message: fmt.Sprintf("the name '%s' overlaps with the repository '%s'", repositoryName, name),
+			}
+		}
+	}
+	return nil
+}
+
+/*
+checkBases validates the bases of a repository against all stored repositories.
+It returns the base repositories and the URLs of the remote bases.
+*/
+func (db *datastore) checkBases(repositoryName string, bases []string) ([]Repository, []string, error) {
+	baseNames, remoteURLs := splitBases(bases)
+	graph, err := db.inheritanceGraph(&config{})
+	if err != nil {
+		return nil, nil, err
+	}
+	graph[repositoryName] = baseNames
+	if err = graph.validate(); err != nil {
+		return nil, nil, &ConfigurationError{message: err.Error()}
+	}
+	baseRepos := make([]Repository, len(baseNames))
+	for i, baseName := range baseNames {
+		if baseRepos[i], err = db.GetRepository(baseName); err != nil {
+			return nil, nil, err
+		}
+	}
+	return baseRepos, remoteURLs, nil
+}
+
+func (db *datastore) CreateRepository(repositoryName string, bases []string, permissions map[Permission][]string) (Repository, error) {
+	db.managementLock.Lock()
+	defer db.managementLock.Unlock()
+	if !repositoryNameRegExp.MatchString(repositoryName) {
+		return nil, &ConfigurationError{message: fmt.Sprintf("invalid repository name '%s'", repositoryName)}
+	}
+	if _, err := db.findRepository(repositoryName); err == nil {
+		return nil, ErrRepositoryExists
+	} else if err != ErrRepositoryNotFound {
+		return nil, err
+	} else if err = db.checkOverlap(repositoryName, ""); err != nil {
+		return nil, err
+	}
+	baseRepos, remoteURLs, err := db.checkBases(repositoryName, bases)
+	if err != nil {
+		return nil, err
+	}
+	if permissions == nil {
+		permissions = defaultPermissions.toMap()
+	}
+
+	// The repository is not accessible, before its bases and permissions are set
+	repo := &repository{db: db, RepositoryName: repositoryName, Storage: db.storagePath}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(repo).Error; err != nil {
+			return err
+		} else if err = repo.setBases(tx, baseRepos); err != nil {
+			return err
+		} else if err = repo.setRemoteBases(tx, remoteURLs); err != nil {
+			return err
+		}
+		return repo.setPermissions(tx, permissions)
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.invalidateRepositoryNames()
+	return repo, nil
+}
+
+func (db *datastore) RenameRepository(repositoryName string, newName string) error {
+	return db.updateRepository(repositoryName, newName, nil, false)
+}
+
+func (db *datastore) RebaseRepository(repositoryName string, bases []string) error {
+	return db.updateRepository(repositoryName, "", bases, true)
+}
+
+func (db *datastore) UpdateRepository(repositoryName string, newName string, bases []string) error {
+	return db.updateRepository(repositoryName, newName, bases, bases != nil)
+}
+
+/*
+updateRepository renames a repository, if a new name is given, and replaces its bases, if rebase is true.
+Both changes are validated before any of them is applied, and they are applied within a single transaction.
+*/
+func (db *datastore) updateRepository(repositoryName string, newName string, bases []string, rebase bool) error {
+	db.managementLock.Lock()
+	defer db.managementLock.Unlock()
+	if err := db.checkManageable(repositoryName); err != nil {
+		return err
+	}
+	rename := newName != "" && newName != repositoryName
+	if rename && db.configuredBases[repositoryName] {
+		// The configuration file refers to the bases by their names
+		return ErrRepositoryInUse
+	} else if rename && !repositoryNameRegExp.MatchString(newName) {
+		return &ConfigurationError{message: fmt.Sprintf("invalid repository name '%s'", newName)}
+	}
+	repo, err := db.findRepository(repositoryName)
+	if err != nil {
+		return err
+	}
+	if rename {
+		if _, err = db.findRepository(newName); err == nil {
+			return ErrRepositoryExists
+		} else if err != ErrRepositoryNotFound {
+			return err
+		} else if err = db.checkOverlap(newName, repositoryName); err != nil {
+			return err
+		}
+	}
+	var baseRepos []Repository
+	var remoteURLs []string
+	if rebase {
+		if baseRepos, remoteURLs, err = db.checkBases(repositoryName, bases); err != nil {
+			return err
+		}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if rebase {
+			if err := repo.setBases(tx, baseRepos); err != nil {
+				return err
+			} else if err = repo.setRemoteBases(tx, remoteURLs); err != nil {
+				return err
+			}
+		}
+		if rename {
+			// Projects and bases reference the repository by its ID, thus only the name changes.
+			// The contents are kept in the blob store, which does not depend on the repository path.
+			return tx.Model(repo).Update("RepositoryName", newName).Error
+		}
+		return nil
+	})
+	if rename {
+		db.invalidateRepositoryNames()
+	}
+	return err
+}
+
+func (db *datastore) DeleteRepository(repositoryName string) error {
+	db.managementLock.Lock()
+	defer db.managementLock.Unlock()
+	if err := db.checkManageable(repositoryName); err != nil {
+		return err
+	}
+	repo, err := db.findRepository(repositoryName)
+	if err != nil {
+		return err
+	}
+	var inheriting int
+	if err = db.Model(&repositoryBase{}).Where("parent_id = ?", repo.ID).Count(&inheriting).Error; err != nil {
+		return err
+	} else if inheriting > 0 {
+		return ErrRepositoryInUse
+	}
+
+	// The whole repository is checked before any of its rows is deleted
+	var projects []*project
+	var files []*projectFile
+	err = db.Transaction(func(tx *gorm.DB) error {
+		projectIDs := tx.Model(&project{}).Select("id").Where("repository_id = ?", repo.ID).SubQuery()
+		if err := tx.Find(&projects, "repository_id = ?", repo.ID).Error; err != nil {
+			return err
+		} else if err = tx.Find(&files, "project_id IN (?)", projectIDs).Error; err != nil {
+			return err
+		} else if len(files) > 0 && !repo.IsVolatile() {
+			return ErrImmutable
+		} else if err = checkUnlocked(tx, "project_id IN (?)", projectIDs); err != nil {
+			return err
+		} else if err = deleteLocks(tx, "project_id IN (?)", projectIDs); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&projectFile{}, "project_id IN (?)", projectIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&release{}, "project_id IN (?)", projectIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&project{}, "repository_id = ?", repo.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&repositoryBase{}, "repository_id = ?", repo.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&remoteBase{}, "repository_id = ?", repo.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&repositoryPermission{}, "repository_id = ?", repo.ID).Error; err != nil {
+			return err
+		}
+		// The name has to be available for new repositories again
+		return tx.Unscoped().Delete(repo).Error
+	})
+	if err != nil {
+		return err
+	}
+	db.invalidateRepositoryNames()
+	// The rows are deleted, remove the files from the disk
+	for _, file := range files {
+		file.db = db
+		if err = file.removeContent(); err != nil {
+			return err
+		}
+	}
+	for _, prj := range projects {
+		if err = os.RemoveAll(prj.ProjectPath()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *datastore) IsAdmin(userName string) bool {
+	if userName == "" {
+		return false
+	}
+	for _, admin := range db.admins {
+		if admin == userName {
+			return true
+		}
+	}
+	return false
+}
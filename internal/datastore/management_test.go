@@ -0,0 +1,272 @@
+package datastore
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type managementTestSuite struct {
+	TestSuiteWithDatastore
+}
+
+func TestManagement(t *testing.T) {
+	suite.Run(t, new(managementTestSuite))
+}
+
+func (suite *managementTestSuite) SetupTest() {
+	suite.TestSuiteWithDatastore.SetupTest()
+	cfg := &config{StoragePath: suite.storagePath, Indexes: []indexConfig{{Name: "base"}}}
+	suite.Require().Nil(suite.db.addRepositories(cfg), "unable to add the configured repositories")
+}
+
+// requireConfigurationError checks, that the error is a ConfigurationError
+func (suite *managementTestSuite) requireConfigurationError(err error, msgAndArgs ...interface{}) {
+	suite.Require().NotNil(err, msgAndArgs...)
+	suite.Require().IsType(&ConfigurationError{}, err, msgAndArgs...)
+}
+
+func (suite *managementTestSuite) TestCreate() {
+	require := suite.Require()
+	repo, err := suite.db.CreateRepository("team/app", []string{"base", "https://remote.example/simple"}, nil)
+	require.Nil(err, "unable to create the repository")
+	require.Equal("team/app", repo.Name(), "the name is not correct")
+	suite.requireBases("team/app", "base")
+	remotes, err := repo.RemoteBases()
+	require.Nil(err, "unable to get the remote bases")
+	require.Equal([]string{"https://remote.example/simple/"}, remotes, "the remote bases are not correct")
+	allowed, err := repo.IsAllowed("", PermissionUpload)
+	require.Nil(err, "unable to check the permissions")
+	require.True(allowed, "the default permissions have not been applied")
+
+	_, err = suite.db.CreateRepository("team/app", nil, nil)
+	require.Equal(ErrRepositoryExists, err, "an existing repository has been created again")
+}
+
+func (suite *managementTestSuite) TestCreateInvalid() {
+	for _, name := range []string{"", "+api", "team//app", "../app", "team/", "team app"} {
+		_, err := suite.db.CreateRepository(name, nil, nil)
+		suite.requireConfigurationError(err, "the invalid name '%s' has been accepted", name)
+	}
+	_, err := suite.db.CreateRepository("app", []string{"undefined"}, nil)
+	suite.requireConfigurationError(err, "an undefined base has been accepted")
+	_, err = suite.db.CreateRepository("app", []string{"app"}, nil)
+	suite.requireConfigurationError(err, "a repository inheriting from itself has been accepted")
+}
+
+func (suite *managementTestSuite) TestRename() {
+	require := suite.Require()
+	repo, err := suite.db.CreateRepository("app", []string{"base"}, nil)
+	require.Nil(err, "unable to create the repository")
+	prj, err := repo.AddProject("fuubar")
+	require.Nil(err, "unable to add the project")
+	require.Nil(prj.AddFile("fuubar-1.0.tar.gz", bytes.NewReader([]byte("content"))), "unable to add the file")
+	_, err = suite.db.CreateRepository("team", []string{"app"}, nil)
+	require.Nil(err, "unable to create the repository")
+
+	require.Nil(suite.db.RenameRepository("app", "apps/app"), "unable to rename the repository")
+	_, err = suite.db.GetRepository("app")
+	require.Equal(ErrRepositoryNotFound, err, "the repository is still available by its old name")
+	repo, err = suite.db.GetRepository("apps/app")
+	require.Nil(err, "the repository is not available by its new name")
+	prj, err = repo.GetProject("fuubar")
+	require.Nil(err, "unable to get the project")
+	require.NotNil(prj, "the projects have not been kept")
+	file, err := prj.GetFile("fuubar-1.0.tar.gz")
+	require.Nil(err, "unable to get the file")
+	content, err := readContent(file)
+	require.Nil(err, "unable to read the file")
+	require.Equal("content", string(content), "the content of the file has changed")
+	suite.requireBases("team", "apps/app")
+
+	require.Equal(ErrRepositoryExists, suite.db.RenameRepository("apps/app", "team"), "a repository has been replaced")
+	require.Equal(ErrRepositoryNotFound, suite.db.RenameRepository("app", "other"), "a missing repository has been renamed")
+	suite.requireConfigurationError(suite.db.RenameRepository("apps/app", "+app"), "an invalid name has been accepted")
+}
+
+func (suite *managementTestSuite) TestRenameConfiguredBase() {
+	require := suite.Require()
+	_, err := suite.db.CreateRepository("app", nil, nil)
+	require.Nil(err, "unable to create the repository")
+	cfg := &config{StoragePath: suite.storagePath, Indexes: []indexConfig{{Name: "team", Bases: []string{"app"}}}}
+	require.Nil(suite.db.addRepositories(cfg), "unable to add the configured repositories")
+	require.Equal(ErrRepositoryInUse, suite.db.RenameRepository("app", "apps/app"),
+		"a base of a configured repository has been renamed")
+}
+
+func (suite *managementTestSuite) TestOverlappingNames() {
+	require := suite.Require()
+	_, err := suite.db.CreateRepository("team/app", nil, nil)
+	require.Nil(err, "unable to create the repository")
+	_, err = suite.db.CreateRepository("team", nil, nil)
+	suite.requireConfigurationError(err, "the beginning of the name of a repository has been accepted")
+	_, err = suite.db.CreateRepository("team/app/test", nil, nil)
+	suite.requireConfigurationError(err, "a name starting with the name of a repository has been accepted")
+	_, err = suite.db.CreateRepository("base/app", nil, nil)
+	suite.requireConfigurationError(err, "a name starting with the name of a repository has been accepted")
+	_, err = suite.db.CreateRepository("team/apps", nil, nil)
+	require.Nil(err, "a name sharing only characters with a repository has been rejected")
+
+	_, err = suite.db.CreateRepository("other", nil, nil)
+	require.Nil(err, "unable to create the repository")
+	suite.requireConfigurationError(suite.db.RenameRepository("other", "team"), "an overlapping name has been accepted")
+	require.Nil(suite.db.RenameRepository("team/app", "team/app/test"), "the repository overlaps with itself")
+}
+
+func (suite *managementTestSuite) TestMatchRepository() {
+	require := suite.Require()
+	repo, err := suite.db.MatchRepository("/base/fuubar/")
+	require.Nil(err, "unable to match the repository")
+	require.NotNil(repo, "the repository has not been matched")
+	require.Equal("base", repo.Name())
+	repo, err = suite.db.MatchRepository("/base")
+	require.Nil(err, "unable to match the repository")
+	require.Nil(repo, "a path without a slash after the name has been matched")
+
+	// The names are loaded again after changing the repositories
+	_, err = suite.db.CreateRepository("team/app", nil, nil)
+	require.Nil(err, "unable to create the repository")
+	repo, err = suite.db.MatchRepository("/team/app/fuubar/")
+	require.Nil(err, "unable to match the repository")
+	require.NotNil(repo, "the created repository has not been matched")
+	require.Equal("team/app", repo.Name())
+	require.Nil(suite.db.RenameRepository("team/app", "apps"), "unable to rename the repository")
+	repo, err = suite.db.MatchRepository("/team/app/fuubar/")
+	require.Nil(err, "unable to match the repository")
+	require.Nil(repo, "the repository has been matched by its old name")
+	require.Nil(suite.db.DeleteRepository("apps"), "unable to delete the repository")
+	repo, err = suite.db.MatchRepository("/apps/fuubar/")
+	require.Nil(err, "unable to match the repository")
+	require.Nil(repo, "a deleted repository has been matched")
+}
+
+func (suite *managementTestSuite) TestRebase() {
+	require := suite.Require()
+	_, err := suite.db.CreateRepository("app", []string{"base"}, nil)
+	require.Nil(err, "unable to create the repository")
+	_, err = suite.db.CreateRepository("team", []string{"app"}, nil)
+	require.Nil(err, "unable to create the repository")
+
+	err = suite.db.RebaseRepository("app", []string{"team"})
+	suite.requireConfigurationError(err, "an inheritance cycle has been accepted")
+	require.Contains(err.Error(), "app -> team -> app")
+	suite.requireBases("app", "base")
+
+	require.Nil(suite.db.RebaseRepository("team", []string{"base", "app"}), "unable to replace the bases")
+	suite.requireBases("team", "base", "app")
+	require.Nil(suite.db.RebaseRepository("team", nil), "unable to remove the bases")
+	suite.requireBases("team")
+}
+
+func (suite *managementTestSuite) TestDelete() {
+	require := suite.Require()
+	repo, err := suite.db.CreateRepository("app", []string{"base"}, nil)
+	require.Nil(err, "unable to create the repository")
+	prj, err := repo.AddProject("fuubar")
+	require.Nil(err, "unable to add the project")
+	require.Nil(prj.AddFile("fuubar-1.0.tar.gz", bytes.NewReader([]byte("content"))), "unable to add the file")
+	_, err = suite.db.CreateRepository("team", []string{"app"}, nil)
+	require.Nil(err, "unable to create the repository")
+
+	require.Equal(ErrRepositoryInUse, suite.db.DeleteRepository("app"), "a base has been deleted")
+	require.Nil(suite.db.DeleteRepository("team"), "unable to delete the repository")
+	require.Nil(suite.db.DeleteRepository("app"), "unable to delete the repository")
+	require.Equal(ErrRepositoryNotFound, suite.db.DeleteRepository("app"), "a missing repository has been deleted")
+	var files int
+	require.Nil(suite.db.Model(&projectFile{}).Count(&files).Error, "unable to count the files")
+	require.Zero(files, "the files have not been deleted")
+
+	// The name is available again
+	repo, err = suite.db.CreateRepository("app", nil, nil)
+	require.Nil(err, "unable to create a repository with the name of a deleted one")
+	projects, err := repo.AllProjects()
+	require.Nil(err, "unable to get the projects")
+	require.Empty(projects, "the projects of the deleted repository have been kept")
+}
+
+func (suite *managementTestSuite) TestCreateWithPermissions() {
+	require := suite.Require()
+	repo, err := suite.db.CreateRepository("app", nil, map[Permission][]string{PermissionRead: {"alice"}})
+	require.Nil(err, "unable to create the repository")
+	allowed, err := repo.IsAllowed("", PermissionRead)
+	require.Nil(err, "unable to check the permissions")
+	require.False(allowed, "the default permissions have been applied")
+	allowed, err = repo.IsAllowed("alice", PermissionRead)
+	require.Nil(err, "unable to check the permissions")
+	require.True(allowed, "the permissions have not been applied")
+}
+
+func (suite *managementTestSuite) TestUpdate() {
+	require := suite.Require()
+	_, err := suite.db.CreateRepository("app", nil, nil)
+	require.Nil(err, "unable to create the repository")
+	_, err = suite.db.CreateRepository("team", nil, nil)
+	require.Nil(err, "unable to create the repository")
+
+	// A rejected rename does not replace the bases
+	require.Equal(ErrRepositoryExists, suite.db.UpdateRepository("app", "team", []string{"base"}),
+		"a repository has been replaced")
+	suite.requireBases("app")
+	require.Nil(suite.db.UpdateRepository("app", "apps/app", []string{"base"}), "unable to update the repository")
+	suite.requireBases("apps/app", "base")
+	require.Nil(suite.db.UpdateRepository("apps/app", "", nil), "unable to keep the repository")
+	suite.requireBases("apps/app", "base")
+}
+
+func (suite *managementTestSuite) TestDeleteLocked() {
+	require := suite.Require()
+	repo, err := suite.db.CreateRepository("app", nil, nil)
+	require.Nil(err, "unable to create the repository")
+	for _, projectName := range []string{"fuu", "bar"} {
+		prj, err := repo.AddProject(projectName)
+		require.Nil(err, "unable to add the project")
+		require.Nil(prj.AddFile(projectName+"-1.0.tar.gz", bytes.NewReader([]byte(projectName))), "unable to add the file")
+	}
+	prj, err := repo.GetLocalProject("bar")
+	require.Nil(err, "unable to get the project")
+	file, err := prj.GetFile("bar-1.0.tar.gz")
+	require.Nil(err, "unable to get the file")
+	require.Nil(file.Lock(), "unable to lock the file")
+
+	require.Equal(ErrLocked, suite.db.DeleteRepository("app"), "a repository with a locked file has been deleted")
+	projects, err := repo.Projects()
+	require.Nil(err, "unable to get the projects")
+	require.Len(projects, 2, "the repository has been deleted partially")
+	require.Nil(file.Unlock(), "unable to unlock the file")
+
+	require.Nil(repo.SetVolatile(false), "unable to make the repository immutable")
+	require.Equal(ErrImmutable, suite.db.DeleteRepository("app"), "an immutable repository has been deleted")
+	projects, err = repo.Projects()
+	require.Nil(err, "unable to get the projects")
+	require.Len(projects, 2, "the repository has been deleted partially")
+}
+
+func (suite *managementTestSuite) TestConfigured() {
+	require := suite.Require()
+	require.Equal(ErrRepositoryConfigured, suite.db.RenameRepository("base", "other"))
+	require.Equal(ErrRepositoryConfigured, suite.db.RebaseRepository("base", nil))
+	require.Equal(ErrRepositoryConfigured, suite.db.DeleteRepository("base"))
+	_, err := suite.db.CreateRepository("base", nil, nil)
+	require.Equal(ErrRepositoryExists, err)
+}
+
+func (suite *managementTestSuite) TestIsAdmin() {
+	require := suite.Require()
+	suite.db.admins = []string{"alice"}
+	require.True(suite.db.IsAdmin("alice"), "the admin has not been accepted")
+	require.False(suite.db.IsAdmin("bob"), "a user has been accepted as admin")
+	require.False(suite.db.IsAdmin(""), "an anonymous user has been accepted as admin")
+}
+
+// requireBases requires the repository to have the given bases in the given order
+func (suite *managementTestSuite) requireBases(repositoryName string, baseNames ...string) {
+	repo, err := suite.db.GetRepository(repositoryName)
+	suite.Require().Nil(err, "unable to get the repository '%s'", repositoryName)
+	bases, err := repo.Bases()
+	suite.Require().Nil(err, "unable to get the bases of '%s'", repositoryName)
+	names := make([]string, 0, len(bases))
+	for _, base := range bases {
+		names = append(names, base.Name())
+	}
+	suite.Require().Equal(append([]string{}, baseNames...), names, "the bases of '%s' differ", repositoryName)
+}
@@ -0,0 +1,72 @@
+package datastore
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+)
+
+/*
+Permission defines the level of access a user has on a repository.
+Each permission includes all lower permissions, e.g. an user allowed
+to upload files is allowed to read them as well.
+*/
+type Permission uint8
+
+const (
+	// PermissionRead allows listing the projects and downloading files
+	PermissionRead Permission = iota + 1
+	// PermissionUpload allows uploading new files
+	PermissionUpload
+	// PermissionAdmin allows administrative tasks like deleting files
+	PermissionAdmin
+)
+
+// AnyUser grants a permission to every user, including anonymous ones
+const AnyUser = "*"
+
+func (p Permission) String() string {
+	switch p {
+	case PermissionRead:
+		return "read"
+	case PermissionUpload:
+		return "upload"
+	case PermissionAdmin:
+		return "admin"
+	default:
+		return fmt.Sprintf("Permission(%d)", p)
+	}
+}
+
+/*
+permissionsConfig defines the users granted each permission on an index.
+Users are given by name, or AnyUser to grant the permission to everyone.
+*/
+type permissionsConfig struct {
+	Read   []string `yaml:"read"`
+	Upload []string `yaml:"upload"`
+	Admin  []string `yaml:"admin"`
+}
+
+/*
+defaultPermissions are used for indexes without a permissions configuration.
+They allow everyone to read and upload files, but no one to administrate.
+*/
+var defaultPermissions = permissionsConfig{
+	Read:   []string{AnyUser},
+	Upload: []string{AnyUser},
+}
+
+func (c *permissionsConfig) toMap() map[Permission][]string {
+	return map[Permission][]string{
+		PermissionRead:   c.Read,
+		PermissionUpload: c.Upload,
+		PermissionAdmin:  c.Admin,
+	}
+}
+
+type repositoryPermission struct {
+	gorm.Model
+	RepositoryID uint       `gorm:"index;NOT NULL"`
+	UserName     string     `gorm:"NOT NULL"`
+	Permission   Permission `gorm:"NOT NULL"`
+}
@@ -2,10 +2,13 @@ package datastore
 
 import (
 	"fmt"
+	"github.com/hansingt/GoatCheese/internal/distribution"
+	"github.com/hansingt/GoatCheese/internal/simple"
 	"github.com/jinzhu/gorm"
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 /*
@@ -20,11 +23,18 @@ Additionally, it defines, that project files can be added to a project and,
 given a filename one can get a specific project file from it.
 */
 type Project interface {
-	Name() string                                     // Name returns the name of the project
-	ProjectPath() string                              // ProjectPath returns the path on the data storage
-	ProjectFiles() ([]ProjectFile, error)             // ProjectFiles returns a slice of all files contained
-	GetFile(fileName string) (ProjectFile, error)     // GetFile returns a single file given it's file name
-	AddFile(fileName string, content io.Reader) error // AddFile adds a new file to the project
+	Name() string                                      // Name returns the name of the project
+	ProjectPath() string                               // ProjectPath returns the path on the data storage
+	ProjectFiles() ([]ProjectFile, error)              // ProjectFiles returns a slice of all files contained
+	GetFile(fileName string) (ProjectFile, error)      // GetFile returns a single file given it's file name
+	AddFile(fileName string, content io.Reader) error  // AddFile adds a new file to the project
+	NewUpload(fileName string) (Upload, error)         // NewUpload starts streaming a new file into the project
+	IsReadOnly() bool                                  // IsReadOnly checks whether this project is a cache of an upstream project
+	Repository() (Repository, error)                   // Repository returns the repository storing the project, or nil if not stored locally
+	Releases() ([]Release, error)                      // Releases returns a slice of all releases of the project
+	GetRelease(version string) (Release, error)        // GetRelease returns a single release given it's version
+	AddRelease(distribution.Metadata) (Release, error) // AddRelease adds a new release or updates the metadata of an existing one
+	Delete() error                                     // Delete deletes the project including all releases and files
 }
 
 type project struct {
@@ -33,6 +43,7 @@ type project struct {
 	RepositoryID   uint       `gorm:"unique_index:idx_project;NOT NULL"`
 	ProjectName    string     `gorm:"unique_index:idx_project;NOT NULL"`
 	RepositoryPath string
+	ReadOnly       bool `gorm:"NOT NULL"`
 }
 
 func newProject(db *datastore, repositoryID uint, projectName string, repositoryPath string) (Project, error) {
@@ -42,11 +53,6 @@ func newProject(db *datastore, repositoryID uint, projectName string, repository
 		ProjectName:    projectName,
 		RepositoryPath: repositoryPath,
 	}
-	if _, err := os.Stat(project.ProjectPath()); err != nil {
-		if err = os.MkdirAll(project.ProjectPath(), 0750); err != nil {
-			return nil, err
-		}
-	}
 	return project, db.Create(project).Error
 }
 
@@ -66,6 +72,7 @@ func (p *project) ProjectFiles() ([]ProjectFile, error) {
 	result := make([]ProjectFile, len(projectFiles))
 	for i, file := range projectFiles {
 		file.db = p.db
+		file.project = p
 		result[i] = file
 	}
 	return result, err
@@ -87,40 +94,206 @@ func (p *project) GetFile(fileName string) (ProjectFile, error) {
 	return file, nil
 }
 
-func (p *project) AddFile(fileName string, content io.Reader) error {
-	var newFile ProjectFile
-	file, err := p.GetFile(fileName)
+func (p *project) Releases() ([]Release, error) {
+	var releases []*release
+	err := p.db.Find(&releases, &release{
+		ProjectID: p.ID,
+	}).Error
+	result := make([]Release, len(releases))
+	for i, release := range releases {
+		release.db = p.db
+		result[i] = release
+	}
+	return result, err
+}
+
+func (p *project) GetRelease(version string) (Release, error) {
+	release := &release{
+		ProjectID:      p.ID,
+		ReleaseVersion: version,
+	}
+	err := p.db.First(release, release).Error
 	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			return nil, err
+		}
+		return nil, nil
+	}
+	release.db = p.db
+	return release, nil
+}
+
+func (p *project) AddRelease(metadata distribution.Metadata) (Release, error) {
+	var rel *release
+	err := p.db.Transaction(func(tx *gorm.DB) (err error) {
+		rel, err = p.saveRelease(tx, metadata)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	if file != nil && file.IsLocked() {
-		return fmt.Errorf("file '%s' is currently locked for uploading", fileName)
-	} else if file == nil {
-		newFile, err = newProjectFile(p.db, p.ID, fileName, p.ProjectPath())
-		if err != nil {
-			return err
-		}
+	return rel, nil
+}
+
+/*
+saveRelease adds a new release or updates the metadata of an existing one within the transaction.
+*/
+func (p *project) saveRelease(tx *gorm.DB, metadata distribution.Metadata) (*release, error) {
+	if metadata.Version == "" {
+		return nil, fmt.Errorf("no version given for the release of '%s'", p.Name())
+	}
+	rel := &release{}
+	err := tx.First(rel, "project_id = ? AND release_version = ?", p.ID, metadata.Version).Error
+	if err == gorm.ErrRecordNotFound {
+		rel = &release{ProjectID: p.ID, ReleaseVersion: metadata.Version}
+		rel.setMetadata(metadata)
+	} else if err != nil {
+		return nil, err
 	} else {
-		newFile = file
+		// Metadata of later uploads complete the known metadata
+		known := rel.Metadata()
+		known.Merge(&metadata)
+		rel.setMetadata(known)
+	}
+	if err = tx.Save(rel).Error; err != nil {
+		return nil, err
+	}
+	rel.db = p.db
+	return rel, nil
+}
+
+func (p *project) IsReadOnly() bool {
+	return p.ReadOnly
+}
+
+func (p *project) Repository() (Repository, error) {
+	repo, err := p.loadRepository(p.db.DB)
+	if err != nil || repo == nil {
+		return nil, err
 	}
-	// Lock the file for uploading
-	if err = newFile.Lock(); err != nil {
-		if newFile != file {
-			_ = newFile.Delete()
+	return repo, nil
+}
+
+/*
+setReadOnly marks the project as a cache of an upstream project and
+stores the time it has been refreshed from the upstream index.
+*/
+func (p *project) setReadOnly() error {
+	p.ReadOnly = true
+	p.UpdatedAt = time.Now()
+	return p.db.Model(p).Updates(map[string]interface{}{
+		"ReadOnly":  p.ReadOnly,
+		"UpdatedAt": p.UpdatedAt,
+	}).Error
+}
+
+/*
+addUpstreamFile registers a file of the upstream index in this project.
+The file is downloaded lazily on the first request, if the upstream index
+publishes its checksum. Otherwise, it is downloaded immediately to compute it.
+*/
+func (p *project) addUpstreamFile(upstreamFile simple.File) error {
+	file, err := p.GetFile(upstreamFile.Name)
+	if err != nil || file != nil {
+		return err
+	}
+	file, err = newProjectFile(p.db, p.ID, upstreamFile.Name, p.ProjectPath())
+	if err != nil {
+		return err
+	}
+	newFile := file.(*projectFile)
+	newFile.UpstreamURL = upstreamFile.URL
+	newFile.FileChecksum = upstreamFile.SHA256
+	newFile.RequiresPythonSpecifier = upstreamFile.RequiresPython
+	newFile.Yanked = upstreamFile.Yanked
+	newFile.YankReason = upstreamFile.YankedReason
+	if err = p.db.Model(newFile).Updates(newFile).Error; err != nil {
+		return err
+	}
+	if newFile.FileChecksum == "" {
+		if err = newFile.Fetch(); err != nil {
+			_ = newFile.remove()
+			return err
 		}
+	}
+	return nil
+}
+
+/*
+loadRepository loads the repository of this project using the given database connection or transaction.
+It returns nil, if the repository does not exist anymore.
+*/
+func (p *project) loadRepository(tx *gorm.DB) (*repository, error) {
+	repo := &repository{}
+	err := tx.First(repo, p.RepositoryID).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	repo.db = p.db
+	return repo, nil
+}
+
+/*
+allowsOverwrite checks whether the repository of this project allows overwriting existing files.
+Files of repositories, which are not volatile, are never overwritten.
+*/
+func (p *project) allowsOverwrite() (bool, error) {
+	repo, err := p.loadRepository(p.db.DB)
+	if err != nil || repo == nil {
+		return false, err
+	}
+	return repo.AllowsOverwrite() && repo.IsVolatile(), nil
+}
+
+func (p *project) AddFile(fileName string, content io.Reader) error {
+	upload, err := p.NewUpload(fileName)
+	if err != nil {
 		return err
 	}
-	// Write the contents to the disk
-	if err = newFile.Write(content); err != nil {
-		if newFile == file {
-			// We did modify the file, just unlock it
-			_ = file.Unlock()
-		} else {
-			// We are creating a new file, delete it
-			_ = newFile.Delete()
+	if _, err = io.Copy(upload, content); err != nil {
+		_ = upload.Discard()
+		return err
+	}
+	return upload.Commit()
+}
+
+func (p *project) Delete() error {
+	// The files are listed within the transaction, so that the contents of all deleted rows are removed
+	var files []*projectFile
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Find(&files, "project_id = ?", p.ID).Error; err != nil {
+			return err
+		} else if len(files) > 0 {
+			// Projects without files can be removed from immutable repositories
+			if err = p.checkVolatile(tx); err != nil {
+				return err
+			}
+		}
+		if err := checkUnlocked(tx, "project_id = ?", p.ID); err != nil {
+			return err
+		}
+		if err := deleteLocks(tx, "project_id = ?", p.ID); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&projectFile{}, "project_id = ?", p.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&release{}, "project_id = ?", p.ID).Error; err != nil {
+			return err
 		}
+		return tx.Unscoped().Delete(p).Error
+	})
+	if err != nil {
 		return err
 	}
-	// Unlock the file again
-	return newFile.Unlock()
+	// The rows are deleted, remove the files from the disk
+	for _, file := range files {
+		file.db = p.db
+		if err = file.removeContent(); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(p.ProjectPath())
 }
@@ -2,6 +2,8 @@ package datastore
 
 import (
 	"bytes"
+	"github.com/hansingt/GoatCheese/internal/distribution"
+	"github.com/hansingt/GoatCheese/internal/testutil"
 	"github.com/stretchr/testify/suite"
 	"math/rand"
 	"os"
@@ -27,6 +29,36 @@ func TestProject(t *testing.T) {
 	suite.Run(t, new(projectTestSuite))
 }
 
+// overwritableProject creates a project in a repository allowing to overwrite files
+func (suite *projectTestSuite) overwritableProject() Project {
+	repo, err := newRepository(suite.db, "scratch", nil, suite.storagePath)
+	suite.Require().Nil(err, "unable to create the repository")
+	suite.Require().Nil(repo.SetAllowOverwrite(true), "unable to allow overwriting files")
+	project, err := repo.AddProject(suite.projectName)
+	suite.Require().Nil(err, "unable to create the project")
+	return project
+}
+
+func (suite *projectTestSuite) TestOwner() {
+	require := suite.Require()
+	project := suite.overwritableProject()
+	require.Nil(project.AddFile("test_app-1.0.tar.gz", bytes.NewReader([]byte("content"))), "unable to add the file")
+	file, err := project.GetFile("test_app-1.0.tar.gz")
+	require.Nil(err, "unable to get the file")
+
+	owner, err := file.Project()
+	require.Nil(err, "unable to get the project of the file")
+	require.Equal(project.Name(), owner.Name(), "the file is not owned by the project")
+	repo, err := owner.Repository()
+	require.Nil(err, "unable to get the repository of the project")
+	require.Equal("scratch", repo.Name(), "the project is not owned by the repository")
+
+	// Projects of repositories not existing anymore are not owned by any repository
+	repo, err = suite.project.Repository()
+	require.Nil(err, "unable to look up the missing repository")
+	require.Nil(repo, "the project is owned by a missing repository")
+}
+
 func (suite *projectTestSuite) TestName() {
 	suite.Require().Equal(
 		suite.projectName,
@@ -62,6 +94,9 @@ func (suite *projectTestSuite) TestProjectFiles() {
 	require.Nil(err, "error requesting project files")
 	require.Greater(len(projectFiles), 0, "unexpected files found on the project")
 	require.Equal(fileName, projectFiles[0].Name(), "the file names don't match")
+	owner, err := projectFiles[0].Project()
+	require.Nil(err, "unable to get the project of the file")
+	require.Equal(suite.project, owner, "the listed file does not refer to its project")
 }
 
 func (suite *projectTestSuite) TestGetFileNotFound() {
@@ -113,28 +148,53 @@ func (suite *projectTestSuite) TestOverwriteFile() {
 	var file ProjectFile
 	var newFile ProjectFile
 	require := suite.Require()
+	project := suite.overwritableProject()
 
 	// Add a new file
 	content := make([]byte, 512)
 	_, err := rand.Read(content)
 	require.Nil(err, "Error creating random file content")
-	require.Nil(suite.project.AddFile(fileName, bytes.NewReader(content)), "error adding the project file")
-	file, err = suite.project.GetFile(fileName)
+	require.Nil(project.AddFile(fileName, bytes.NewReader(content)), "error adding the project file")
+	file, err = project.GetFile(fileName)
 	require.Nil(err, "error getting the project file")
 	require.NotNil(file, "the file has not been found")
 
 	// Now overwrite it with new content
 	_, err = rand.Read(content)
 	require.Nil(err, "Error creating random file content")
-	require.Nil(suite.project.AddFile(fileName, bytes.NewReader(content)), "error adding the project file")
+	require.Nil(project.AddFile(fileName, bytes.NewReader(content)), "error adding the project file")
 
 	// And check that the new file has been stored
-	newFile, err = suite.project.GetFile(fileName)
+	newFile, err = project.GetFile(fileName)
 	require.Nil(err, "error getting the project file")
 	require.NotNil(newFile, "the file has not been found")
 	require.NotEqual(newFile.Checksum(), file.Checksum(), "the file contents have not been replaced")
 }
 
+func (suite *projectTestSuite) TestOverwriteFileForbidden() {
+	fileName := "test.app-15.13.37.42-py2.7.egg"
+	require := suite.Require()
+
+	content := make([]byte, 512)
+	_, err := rand.Read(content)
+	require.Nil(err, "Error creating random file content")
+	require.Nil(suite.project.AddFile(fileName, bytes.NewReader(content)), "error adding the project file")
+	file, err := suite.project.GetFile(fileName)
+	require.Nil(err, "error getting the project file")
+
+	// Uploading the same content again succeeds
+	require.Nil(suite.project.AddFile(fileName, bytes.NewReader(content)), "the identical file has been rejected")
+
+	// But different contents are rejected
+	newContent := make([]byte, 512)
+	_, err = rand.Read(newContent)
+	require.Nil(err, "Error creating random file content")
+	require.Equal(ErrFileExists, suite.project.AddFile(fileName, bytes.NewReader(newContent)), "the file has been overwritten")
+	newFile, err := suite.project.GetFile(fileName)
+	require.Nil(err, "error getting the project file")
+	require.Equal(file.Checksum(), newFile.Checksum(), "the file contents have been replaced")
+}
+
 func (suite *projectTestSuite) TestDeleteFileOnError() {
 	var file ProjectFile
 	fileName := "test.app-15.13.37.42-py2.7.egg"
@@ -157,12 +217,13 @@ func (suite *projectTestSuite) TestDontDeleteFileOnModifyError() {
 	var file ProjectFile
 	fileName := "test.app-15.13.37.42-py2.7.egg"
 	require := suite.Require()
+	project := suite.overwritableProject()
 
 	// Try to add a new file
 	content := make([]byte, 512)
 	_, err := rand.Read(content)
 	require.Nil(err, "Error creating random file content")
-	require.Nil(suite.project.AddFile(fileName, bytes.NewReader(content)), "error adding the project file")
+	require.Nil(project.AddFile(fileName, bytes.NewReader(content)), "error adding the project file")
 
 	// Delete the storage directory to provoke an error
 	require.Nil(os.RemoveAll(suite.storagePath), "could not delete the storage directory")
@@ -170,9 +231,66 @@ func (suite *projectTestSuite) TestDontDeleteFileOnModifyError() {
 	// Try to add a new file
 	_, err = rand.Read(content)
 	require.Nil(err, "Error creating random file content")
-	require.NotNil(suite.project.AddFile(fileName, bytes.NewReader(content)), "no error has been raised")
-	file, err = suite.project.GetFile(fileName)
+	require.NotNil(project.AddFile(fileName, bytes.NewReader(content)), "no error has been raised")
+	file, err = project.GetFile(fileName)
 	require.Nil(err, "error getting the project file")
 	require.NotNil(file, "the file has not been found")
 	require.False(file.IsLocked(), "the file has not been unlocked")
 }
+
+func (suite *projectTestSuite) TestBackfillMetadata() {
+	require := suite.Require()
+	fileName := "test_app-1.0-py3-none-any.whl"
+	require.Nil(suite.project.AddFile(fileName, bytes.NewReader(testutil.Wheel("test-app", "1.0", "Requires-Python: >=3.6"))))
+	require.Nil(suite.project.AddFile("test.app-15.13.37.42-py2.7.egg", bytes.NewReader([]byte("no egg"))))
+
+	file, err := suite.project.GetFile(fileName)
+	require.Nil(err, "unable to get the file")
+	release, err := file.Release()
+	require.Nil(err, "unable to get the release")
+	require.Nil(release, "the release has already been set")
+
+	require.Nil(suite.db.backfillMetadata(), "unable to backfill the metadata")
+	file, err = suite.project.GetFile(fileName)
+	require.Nil(err, "unable to get the file")
+	require.Equal(">=3.6", file.RequiresPython(), "the Requires-Python has not been set")
+	release, err = file.Release()
+	require.Nil(err, "unable to get the release")
+	require.NotNil(release, "the release has not been set")
+	require.Equal("1.0", release.Version())
+
+	// Files without metadata are not read again on the next start
+	egg, err := suite.project.GetFile("test.app-15.13.37.42-py2.7.egg")
+	require.Nil(err, "unable to get the file")
+	require.True(egg.(*projectFile).MetadataAttempted, "the attempt to read the metadata has not been stored")
+	var pending int
+	require.Nil(suite.db.Model(&projectFile{}).Where("metadata_attempted = ?", false).Count(&pending).Error)
+	require.Equal(0, pending, "files are read again on the next start")
+}
+
+func (suite *projectTestSuite) TestDelete() {
+	require := suite.Require()
+	fileName := "test_app-1.0-py3-none-any.whl"
+	require.Nil(suite.project.AddFile(fileName, bytes.NewReader(testutil.Wheel("test-app", "1.0"))))
+	rel, err := suite.project.AddRelease(distribution.Metadata{Version: "1.0"})
+	require.Nil(err, "unable to add the release")
+	file, err := suite.project.GetFile(fileName)
+	require.Nil(err, "unable to get the file")
+	require.Nil(file.SetRelease(rel), "unable to set the release")
+
+	// Locked files prevent the deletion
+	require.Nil(file.Lock(), "unable to lock the file")
+	require.Equal(ErrLocked, suite.project.Delete(), "a project with locked files has been deleted")
+	require.Nil(file.Unlock(), "unable to unlock the file")
+
+	require.Nil(suite.project.Delete(), "unable to delete the project")
+	_, err = os.Stat(suite.project.ProjectPath())
+	require.True(os.IsNotExist(err), "the project path has not been removed")
+	var count int
+	require.Nil(suite.db.Unscoped().Model(&projectFile{}).Count(&count).Error)
+	require.Equal(0, count, "the file has not been deleted from the database")
+	require.Nil(suite.db.Unscoped().Model(&release{}).Count(&count).Error)
+	require.Equal(0, count, "the release has not been deleted from the database")
+	require.Nil(suite.db.Unscoped().Model(&project{}).Count(&count).Error)
+	require.Equal(0, count, "the project has not been deleted from the database")
+}
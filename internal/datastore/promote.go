@@ -0,0 +1,195 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+)
+
+// ErrProjectNotFound is returned, if a project to promote is not stored in the repository
+var ErrProjectNotFound = errors.New("project not found")
+
+// ErrReleaseNotFound is returned, if a release to promote does not exist
+var ErrReleaseNotFound = errors.New("release not found")
+
+/*
+MoveError is returned, if a release has been promoted, but could not be deleted from the source repository
+afterwards. The release is available in both repositories then and moving it again removes it from the source.
+*/
+type MoveError struct {
+	err error
+}
+
+func (e *MoveError) Error() string {
+	return fmt.Sprintf("the release has been copied, but could not be deleted from the source: %s", e.err)
+}
+
+func (r *repository) Promote(projectName string, version string, target Repository, move bool) (Release, error) {
+	targetRepo, ok := target.(*repository)
+	if !ok {
+		return nil, fmt.Errorf("unable to promote into the repository '%s'", target.Name())
+	} else if targetRepo.ID == r.ID {
+		return nil, fmt.Errorf("unable to promote '%s' into the repository it is stored in", projectName)
+	}
+	source, err := r.localProject(projectName)
+	if err != nil {
+		return nil, err
+	} else if source == nil {
+		return nil, ErrProjectNotFound
+	} else if move && source.IsReadOnly() {
+		return nil, fmt.Errorf("the project '%s' is a cache of an upstream project and can not be moved", projectName)
+	} else if move && !r.IsVolatile() {
+		return nil, ErrImmutable
+	}
+	sourceRelease, err := source.GetRelease(version)
+	if err != nil {
+		return nil, err
+	} else if sourceRelease == nil {
+		return nil, ErrReleaseNotFound
+	}
+	files, err := sourceRelease.ProjectFiles()
+	if err != nil {
+		return nil, err
+	}
+	// Keep the files from being replaced or deleted while they are copied
+	for i, file := range files {
+		if err = file.Fetch(); err == nil {
+			err = file.Lock()
+		}
+		if err != nil {
+			for _, locked := range files[:i] {
+				_ = locked.Unlock()
+			}
+			return nil, err
+		}
+	}
+
+	promoted, err := targetRepo.addRelease(source.Name(), sourceRelease, files)
+	for _, file := range files {
+		if unlockErr := file.Unlock(); err == nil {
+			err = unlockErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	} else if move {
+		if err = sourceRelease.Delete(); err != nil {
+			return promoted, &MoveError{err: err}
+		}
+	}
+	return promoted, nil
+}
+
+/*
+addRelease adds the release with the given files of a project of another repository to this repository.
+The files reference the same blobs as the given ones, thus their content is not copied. Files existing
+with the same content are kept and added to the release, while files existing with a different content
+reject the whole release. The project, the release and its files are added within a single transaction.
+*/
+func (r *repository) addRelease(projectName string, sourceRelease Release, files []ProjectFile) (Release, error) {
+	prj, err := r.prepareProject(projectName)
+	if err != nil {
+		return nil, err
+	} else if prj.IsReadOnly() {
+		return nil, fmt.Errorf("the project '%s' of '%s' is a cache of an upstream project", projectName, r.Name())
+	}
+	// A project, which has not been stored yet, neither contains files nor releases
+	created := prj.ID == 0
+	var missing, existing []*projectFile
+	for _, file := range files {
+		var stored ProjectFile
+		if !created {
+			if stored, err = prj.GetFile(file.Name()); err != nil {
+				return nil, err
+			}
+		}
+		if stored == nil {
+			if file.(*projectFile).BlobChecksum == "" {
+				return nil, fmt.Errorf("the content of '%s' is not stored", file.Name())
+			}
+			missing = append(missing, file.(*projectFile))
+		} else if stored.Checksum() != file.Checksum() {
+			return nil, ErrFileExists
+		} else {
+			existing = append(existing, stored.(*projectFile))
+		}
+	}
+
+	metadata := sourceRelease.Metadata()
+	rel := &release{db: r.db, ReleaseVersion: metadata.Version}
+	if !created {
+		known, err := prj.GetRelease(metadata.Version)
+		if err != nil {
+			return nil, err
+		} else if known != nil {
+			// Metadata of later promotions complete the known metadata
+			rel = known.(*release)
+			merged := rel.Metadata()
+			merged.Merge(&metadata)
+			metadata = merged
+		}
+	}
+	rel.setMetadata(metadata)
+
+	// The blobs are referenced first, thus they are not removed while the rows are added
+	var referenced []string
+	unreference := func() {
+		for _, checksum := range referenced {
+			_ = r.db.releaseBlob(checksum)
+		}
+	}
+	for _, file := range missing {
+		if err = r.db.referenceBlob(file.BlobChecksum); err != nil {
+			unreference()
+			return nil, err
+		}
+		referenced = append(referenced, file.BlobChecksum)
+	}
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if created {
+			if err := tx.Create(prj).Error; err != nil {
+				return err
+			}
+		}
+		rel.ProjectID = prj.ID
+		if err := tx.Save(rel).Error; err != nil {
+			return err
+		}
+		for _, file := range existing {
+			if err := tx.Model(file).Update("ReleaseID", rel.ID).Error; err != nil {
+				return err
+			}
+		}
+		for _, file := range missing {
+			if err := tx.Create(prj.copyOf(file, rel.ID)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// Do not leave a partially promoted release behind
+		unreference()
+		return nil, err
+	}
+	return rel, nil
+}
+
+/*
+copyOf returns a file of this project sharing the content and the metadata of the given file.
+*/
+func (p *project) copyOf(source *projectFile, releaseID uint) *projectFile {
+	return &projectFile{
+		db:                      p.db,
+		ProjectID:               p.ID,
+		ReleaseID:               releaseID,
+		FileName:                source.FileName,
+		FileChecksum:            source.FileChecksum,
+		BlobChecksum:            source.BlobChecksum,
+		ProjectPath:             p.ProjectPath(),
+		RequiresPythonSpecifier: source.RequiresPythonSpecifier,
+		Yanked:                  source.Yanked,
+		YankReason:              source.YankReason,
+		MetadataAttempted:       source.MetadataAttempted,
+	}
+}
@@ -0,0 +1,188 @@
+package datastore
+
+import (
+	"bytes"
+	"github.com/hansingt/GoatCheese/internal/distribution"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type promoteTestSuite struct {
+	TestSuiteWithDatastore
+	staging Repository
+	base    Repository
+	files   []ProjectFile
+}
+
+func TestPromote(t *testing.T) {
+	suite.Run(t, new(promoteTestSuite))
+}
+
+func (suite *promoteTestSuite) SetupTest() {
+	var err error
+	require := suite.Require()
+	suite.TestSuiteWithDatastore.SetupTest()
+	suite.staging, err = newRepository(suite.db, "staging", nil, suite.storagePath)
+	require.Nil(err, "unable to create the repository")
+	suite.base, err = newRepository(suite.db, "base", nil, suite.storagePath)
+	require.Nil(err, "unable to create the repository")
+
+	prj, err := suite.staging.AddProject("fuubar")
+	require.Nil(err, "unable to add the project")
+	release, err := prj.AddRelease(distribution.Metadata{Name: "fuubar", Version: "1.0", Summary: "A test project"})
+	require.Nil(err, "unable to add the release")
+	suite.files = nil
+	for _, fileName := range []string{"fuubar-1.0.tar.gz", "fuubar-1.0-py3-none-any.whl"} {
+		require.Nil(prj.AddFile(fileName, bytes.NewReader([]byte(fileName))), "unable to add the file")
+		file, err := prj.GetFile(fileName)
+		require.Nil(err, "unable to get the file")
+		require.Nil(file.SetRelease(release), "unable to set the release")
+		require.Nil(file.SetRequiresPython(">=3.6"), "unable to set the Requires-Python specifier")
+		suite.files = append(suite.files, file)
+	}
+	require.Nil(suite.files[0].Yank("broken"), "unable to yank the file")
+	// Files of other releases are not promoted
+	require.Nil(prj.AddFile("fuubar-2.0.tar.gz", bytes.NewReader([]byte("2.0"))), "unable to add the file")
+}
+
+// requirePromoted checks, that the target repository contains the promoted release
+func (suite *promoteTestSuite) requirePromoted(release Release) {
+	require := suite.Require()
+	require.Equal("1.0", release.Version(), "the version differs")
+	require.Equal("A test project", release.Metadata().Summary, "the metadata has not been promoted")
+	files, err := release.ProjectFiles()
+	require.Nil(err, "unable to get the promoted files")
+	require.Len(files, len(suite.files), "the number of promoted files differs")
+
+	prj, err := suite.base.GetLocalProject("fuubar")
+	require.Nil(err, "unable to get the project")
+	require.NotNil(prj, "the project has not been created")
+	for _, source := range suite.files {
+		file, err := prj.GetFile(source.Name())
+		require.Nil(err, "unable to get the file")
+		require.NotNil(file, "the file '%s' has not been promoted", source.Name())
+		require.Equal(source.Checksum(), file.Checksum(), "the checksum differs")
+		require.Equal(source.IsYanked(), file.IsYanked(), "the yank state differs")
+		require.Equal(source.YankedReason(), file.YankedReason(), "the yank reason differs")
+		require.Equal(">=3.6", file.RequiresPython(), "the Requires-Python specifier differs")
+		content, err := readContent(file)
+		require.Nil(err, "unable to read the promoted file")
+		require.Equal(source.Name(), string(content), "the content differs")
+	}
+	file, err := prj.GetFile("fuubar-2.0.tar.gz")
+	require.Nil(err, "unable to get the file")
+	require.Nil(file, "a file of another release has been promoted")
+}
+
+func (suite *promoteTestSuite) TestCopy() {
+	require := suite.Require()
+	release, err := suite.staging.Promote("fuubar", "1.0", suite.base, false)
+	require.Nil(err, "unable to promote the release")
+	suite.requirePromoted(release)
+	for _, file := range suite.files {
+		require.Equal(2, suite.refCount(file.Checksum()), "the content has not been shared")
+		require.False(file.IsLocked(), "the source file is still locked")
+	}
+	check, err := suite.staging.GetLocalProject("fuubar")
+	require.Nil(err, "unable to get the project")
+	sourceRelease, err := check.GetRelease("1.0")
+	require.Nil(err, "unable to get the release")
+	require.NotNil(sourceRelease, "the copied release has been removed")
+
+	// Promoting the identical release again succeeds
+	release, err = suite.staging.Promote("fuubar", "1.0", suite.base, false)
+	require.Nil(err, "unable to promote the release again")
+	suite.requirePromoted(release)
+	require.Equal(2, suite.refCount(suite.files[0].Checksum()), "the content has been referenced again")
+}
+
+func (suite *promoteTestSuite) TestMove() {
+	require := suite.Require()
+	release, err := suite.staging.Promote("fuubar", "1.0", suite.base, true)
+	require.Nil(err, "unable to move the release")
+	suite.requirePromoted(release)
+	for _, file := range suite.files {
+		require.Equal(1, suite.refCount(file.Checksum()), "the content of the source has not been released")
+	}
+	check, err := suite.staging.GetLocalProject("fuubar")
+	require.Nil(err, "unable to get the project")
+	sourceRelease, err := check.GetRelease("1.0")
+	require.Nil(err, "unable to get the release")
+	require.Nil(sourceRelease, "the moved release has been kept")
+}
+
+func (suite *promoteTestSuite) TestExistingFiles() {
+	require := suite.Require()
+	prj, err := suite.base.AddProject("fuubar")
+	require.Nil(err, "unable to add the project")
+	require.Nil(prj.AddFile(suite.files[0].Name(), bytes.NewReader([]byte(suite.files[0].Name()))), "unable to add the file")
+
+	release, err := suite.staging.Promote("fuubar", "1.0", suite.base, false)
+	require.Nil(err, "unable to promote the release")
+	files, err := release.ProjectFiles()
+	require.Nil(err, "unable to get the promoted files")
+	require.Len(files, len(suite.files), "the existing file has not been added to the release")
+}
+
+func (suite *promoteTestSuite) TestFailedMove() {
+	require := suite.Require()
+	// The repository is made immutable after the move has been checked
+	staging, err := suite.db.GetRepository("staging")
+	require.Nil(err, "unable to get the repository")
+	require.Nil(staging.SetVolatile(false), "unable to make the repository immutable")
+
+	release, err := suite.staging.Promote("fuubar", "1.0", suite.base, true)
+	require.IsType(&MoveError{}, err, "the failed deletion has not been reported as such")
+	require.NotNil(release, "the promoted release has not been returned")
+	suite.requirePromoted(release)
+}
+
+func (suite *promoteTestSuite) TestFailedPromotion() {
+	require := suite.Require()
+	// A file without a stored content can not be promoted
+	require.Nil(suite.db.Model(suite.files[1]).Update("BlobChecksum", "").Error, "unable to remove the content")
+	_, err := suite.staging.Promote("fuubar", "1.0", suite.base, false)
+	require.NotNil(err, "a file without content has been promoted")
+	prj, err := suite.base.GetLocalProject("fuubar")
+	require.Nil(err, "unable to get the project")
+	require.Nil(prj, "the project of the failed promotion has been kept")
+}
+
+func (suite *promoteTestSuite) TestConflict() {
+	require := suite.Require()
+	prj, err := suite.base.AddProject("fuubar")
+	require.Nil(err, "unable to add the project")
+	require.Nil(prj.AddFile(suite.files[1].Name(), bytes.NewReader([]byte("different"))), "unable to add the file")
+
+	_, err = suite.staging.Promote("fuubar", "1.0", suite.base, true)
+	require.Equal(ErrFileExists, err, "a conflicting file has been replaced")
+	file, err := prj.GetFile(suite.files[0].Name())
+	require.Nil(err, "unable to get the file")
+	require.Nil(file, "the release has been promoted partially")
+	release, err := prj.GetRelease("1.0")
+	require.Nil(err, "unable to get the release")
+	require.Nil(release, "the release has been promoted partially")
+	require.Equal(1, suite.refCount(suite.files[0].Checksum()), "the content has been referenced")
+	for _, file := range suite.files {
+		require.False(file.IsLocked(), "the source file is still locked")
+	}
+}
+
+func (suite *promoteTestSuite) TestNotFound() {
+	require := suite.Require()
+	_, err := suite.staging.Promote("unknown", "1.0", suite.base, false)
+	require.Equal(ErrProjectNotFound, err)
+	_, err = suite.staging.Promote("fuubar", "3.0", suite.base, false)
+	require.Equal(ErrReleaseNotFound, err)
+	_, err = suite.staging.Promote("fuubar", "1.0", suite.staging, false)
+	require.NotNil(err, "a release has been promoted into its own repository")
+}
+
+func (suite *promoteTestSuite) TestShadowing() {
+	require := suite.Require()
+	strict, err := newRepository(suite.db, "strict", []string{"staging"}, suite.storagePath)
+	require.Nil(err, "unable to create the repository")
+	require.Nil(strict.SetShadowingPolicy(PolicyDeny), "unable to set the policy")
+	_, err = suite.staging.Promote("fuubar", "1.0", strict, false)
+	require.Equal(ErrShadowing, err, "a project of a base has been shadowed")
+}
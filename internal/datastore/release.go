@@ -0,0 +1,165 @@
+package datastore
+
+import (
+	"github.com/hansingt/GoatCheese/internal/distribution"
+	"github.com/jinzhu/gorm"
+	"strings"
+)
+
+/*
+Release defines the interface of a release of a project in the GoatCheese shop.
+
+A release is a single version of a project. It contains the metadata of this
+version and groups the files distributing it.
+*/
+type Release interface {
+	Version() string                         // Version returns the version of the release
+	Metadata() distribution.Metadata         // Metadata returns the core metadata of the release
+	ProjectFiles() ([]ProjectFile, error)    // ProjectFiles returns a slice of all files of this release
+	SetMetadata(distribution.Metadata) error // SetMetadata updates the metadata of the release
+	Yank(reason string) error                // Yank marks all files of the release as yanked
+	Unyank() error                           // Unyank reverts yanking all files of the release
+	Delete() error                           // Delete deletes the release and all its files
+}
+
+type release struct {
+	gorm.Model
+	db             *datastore `gorm:"-"`
+	ProjectID      uint       `gorm:"unique_index:idx_release;NOT NULL"`
+	ReleaseVersion string     `gorm:"unique_index:idx_release;NOT NULL"`
+	ProjectName    string
+	Summary        string
+	RequiresPython string
+	RequiresDist   string `gorm:"type:text"` // One requirement per line
+	Author         string
+	AuthorEmail    string
+	License        string `gorm:"type:text"`
+	Classifiers    string `gorm:"type:text"` // One classifier per line
+}
+
+func newRelease(db *datastore, projectID uint, metadata distribution.Metadata) (Release, error) {
+	release := &release{
+		db:             db,
+		ProjectID:      projectID,
+		ReleaseVersion: metadata.Version,
+	}
+	release.setMetadata(metadata)
+	return release, db.Create(release).Error
+}
+
+func joinLines(values []string) string {
+	return strings.Join(values, "\n")
+}
+
+func splitLines(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, "\n")
+}
+
+func (r *release) Version() string {
+	return r.ReleaseVersion
+}
+
+func (r *release) Metadata() distribution.Metadata {
+	return distribution.Metadata{
+		Name:           r.ProjectName,
+		Version:        r.ReleaseVersion,
+		Summary:        r.Summary,
+		RequiresPython: r.RequiresPython,
+		RequiresDist:   splitLines(r.RequiresDist),
+		Author:         r.Author,
+		AuthorEmail:    r.AuthorEmail,
+		License:        r.License,
+		Classifiers:    splitLines(r.Classifiers),
+	}
+}
+
+func (r *release) setMetadata(metadata distribution.Metadata) {
+	r.ProjectName = metadata.Name
+	r.Summary = metadata.Summary
+	r.RequiresPython = metadata.RequiresPython
+	r.RequiresDist = joinLines(metadata.RequiresDist)
+	r.Author = metadata.Author
+	r.AuthorEmail = metadata.AuthorEmail
+	r.License = metadata.License
+	r.Classifiers = joinLines(metadata.Classifiers)
+}
+
+func (r *release) SetMetadata(metadata distribution.Metadata) error {
+	r.setMetadata(metadata)
+	return r.db.Save(r).Error
+}
+
+func (r *release) ProjectFiles() ([]ProjectFile, error) {
+	var projectFiles []*projectFile
+	err := r.db.Find(&projectFiles, &projectFile{
+		ProjectID: r.ProjectID,
+		ReleaseID: r.ID,
+	}).Error
+	result := make([]ProjectFile, len(projectFiles))
+	for i, file := range projectFiles {
+		file.db = r.db
+		result[i] = file
+	}
+	return result, err
+}
+
+func (r *release) Yank(reason string) error {
+	files, err := r.ProjectFiles()
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err = file.Yank(reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *release) Unyank() error {
+	files, err := r.ProjectFiles()
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err = file.Unyank(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *release) Delete() error {
+	if err := r.db.checkProjectVolatile(r.ProjectID); err != nil {
+		return err
+	}
+	files, err := r.ProjectFiles()
+	if err != nil {
+		return err
+	}
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkUnlocked(tx, "release_id = ?", r.ID); err != nil {
+			return err
+		}
+		if err := deleteLocks(tx, "release_id = ?", r.ID); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&projectFile{}, "release_id = ?", r.ID).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(r).Error
+	})
+	if err != nil {
+		return err
+	}
+	// The rows are deleted, remove the files from the disk
+	for _, file := range files {
+		if err = file.(*projectFile).removeContent(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package datastore
+
+import (
+	"bytes"
+	"github.com/hansingt/GoatCheese/internal/distribution"
+	"github.com/stretchr/testify/suite"
+	"os"
+	"testing"
+)
+
+type releaseTestSuite struct {
+	TestSuiteWithDatastore
+	project Project
+}
+
+func (suite *releaseTestSuite) SetupTest() {
+	var err error
+	suite.TestSuiteWithDatastore.SetupTest()
+	suite.project, err = newProject(suite.db, 1, "test-app", suite.storagePath)
+	suite.Require().Nil(err, "unable to create a new project")
+}
+
+func TestRelease(t *testing.T) {
+	suite.Run(t, new(releaseTestSuite))
+}
+
+func (suite *releaseTestSuite) TestAddAndGetRelease() {
+	require := suite.Require()
+	metadata := distribution.Metadata{
+		Name:           "test-app",
+		Version:        "1.0",
+		Summary:        "A test app",
+		RequiresPython: ">=3.6",
+		RequiresDist:   []string{"requests", "six"},
+		Classifiers:    []string{"Programming Language :: Python :: 3"},
+	}
+	release, err := suite.project.AddRelease(metadata)
+	require.Nil(err, "unable to add the release")
+	require.Equal("1.0", release.Version())
+
+	check, err := suite.project.GetRelease("1.0")
+	require.Nil(err, "unable to get the release")
+	require.NotNil(check, "the release has not been found")
+	require.Equal(metadata, check.Metadata(), "the metadata has not been stored")
+
+	check, err = suite.project.GetRelease("2.0")
+	require.Nil(err, "unable to get the release")
+	require.Nil(check, "an unknown release has been found")
+
+	_, err = suite.project.AddRelease(distribution.Metadata{Name: "test-app"})
+	require.NotNil(err, "a release without version has been added")
+}
+
+func (suite *releaseTestSuite) TestAddExistingRelease() {
+	require := suite.Require()
+	_, err := suite.project.AddRelease(distribution.Metadata{Version: "1.0", Summary: "Summary"})
+	require.Nil(err, "unable to add the release")
+	_, err = suite.project.AddRelease(distribution.Metadata{Version: "1.0", Summary: "Other", License: "MIT"})
+	require.Nil(err, "unable to add the release again")
+
+	releases, err := suite.project.Releases()
+	require.Nil(err, "unable to get the releases")
+	require.Equal(1, len(releases), "the release has been added twice")
+	require.Equal("Summary", releases[0].Metadata().Summary, "the known metadata has been replaced")
+	require.Equal("MIT", releases[0].Metadata().License, "the metadata has not been completed")
+}
+
+func (suite *releaseTestSuite) TestReleaseFiles() {
+	require := suite.Require()
+	release, err := suite.project.AddRelease(distribution.Metadata{Version: "1.0"})
+	require.Nil(err, "unable to add the release")
+	require.Nil(suite.project.AddFile("test-app-1.0.tar.gz", bytes.NewReader([]byte("content"))))
+	require.Nil(suite.project.AddFile("test-app-2.0.tar.gz", bytes.NewReader([]byte("content"))))
+
+	file, err := suite.project.GetFile("test-app-1.0.tar.gz")
+	require.Nil(err, "unable to get the file")
+	check, err := file.Release()
+	require.Nil(err, "unable to get the release of the file")
+	require.Nil(check, "a release has been found for the file")
+
+	require.Nil(file.SetRelease(release), "unable to set the release")
+	check, err = file.Release()
+	require.Nil(err, "unable to get the release of the file")
+	require.Equal("1.0", check.Version())
+
+	files, err := release.ProjectFiles()
+	require.Nil(err, "unable to get the files of the release")
+	require.Equal(1, len(files), "wrong number of files in the release")
+	require.Equal(file.Name(), files[0].Name())
+}
+
+func (suite *releaseTestSuite) TestYankRelease() {
+	require := suite.Require()
+	release, err := suite.project.AddRelease(distribution.Metadata{Version: "1.0"})
+	require.Nil(err, "unable to add the release")
+	for _, fileName := range []string{"test-app-1.0.tar.gz", "test_app-1.0-py3-none-any.whl"} {
+		require.Nil(suite.project.AddFile(fileName, bytes.NewReader([]byte("content"))))
+		file, err := suite.project.GetFile(fileName)
+		require.Nil(err, "unable to get the file")
+		require.Nil(file.SetRelease(release), "unable to set the release")
+	}
+
+	require.Nil(release.Yank("broken"), "unable to yank the release")
+	files, err := release.ProjectFiles()
+	require.Nil(err, "unable to get the files of the release")
+	for _, file := range files {
+		require.True(file.IsYanked(), "the file '%s' has not been yanked", file.Name())
+		require.Equal("broken", file.YankedReason())
+	}
+
+	require.Nil(release.Unyank(), "unable to un-yank the release")
+	files, err = release.ProjectFiles()
+	require.Nil(err, "unable to get the files of the release")
+	for _, file := range files {
+		require.False(file.IsYanked(), "the file '%s' is still yanked", file.Name())
+	}
+}
+
+func (suite *releaseTestSuite) TestDeleteRelease() {
+	require := suite.Require()
+	release, err := suite.project.AddRelease(distribution.Metadata{Version: "1.0"})
+	require.Nil(err, "unable to add the release")
+	require.Nil(suite.project.AddFile("test-app-1.0.tar.gz", bytes.NewReader([]byte("content"))))
+	require.Nil(suite.project.AddFile("test-app-2.0.tar.gz", bytes.NewReader([]byte("other content"))))
+	file, err := suite.project.GetFile("test-app-1.0.tar.gz")
+	require.Nil(err, "unable to get the file")
+	require.Nil(file.SetRelease(release), "unable to set the release")
+
+	require.Nil(release.Delete(), "unable to delete the release")
+	_, err = readContent(file)
+	require.True(os.IsNotExist(err), "the file has not been removed from the disk")
+	check, err := suite.project.GetRelease("1.0")
+	require.Nil(err, "unable to get the release")
+	require.Nil(check, "the release has not been deleted")
+	files, err := suite.project.ProjectFiles()
+	require.Nil(err, "unable to get the project files")
+	require.Equal(1, len(files), "the files of other releases have been deleted")
+}
@@ -0,0 +1,466 @@
+package datastore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/hansingt/GoatCheese/internal/distribution"
+	"github.com/hansingt/GoatCheese/internal/simple"
+	"github.com/hansingt/GoatCheese/internal/storage"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultRemoteCacheTime defines how long the answers of a remote index are cached, if no other time is configured
+	defaultRemoteCacheTime = 5 * time.Minute
+	// remoteRetryInterval defines how long a failing remote index is not asked again
+	remoteRetryInterval = 30 * time.Second
+	// remoteMissCacheTime defines how long projects, which do not exist in a remote index, are cached at most
+	remoteMissCacheTime = 30 * time.Second
+	// remoteCacheSize defines how many projects of a remote index are cached at most
+	remoteCacheSize = 1000
+)
+
+/*
+remoteConfig defines the settings of a remote simple index used as a base of an index.
+*/
+type remoteConfig struct {
+	URL       string `yaml:"url"`
+	Timeout   int    `yaml:"timeout"`   // in seconds
+	CacheTime int    `yaml:"cacheTime"` // in seconds
+}
+
+/*
+isRemoteBase checks whether a base given in the configuration is the URL of a remote simple index.
+*/
+func isRemoteBase(base string) bool {
+	return strings.HasPrefix(base, "http://") || strings.HasPrefix(base, "https://")
+}
+
+/*
+remoteURL normalizes the URL of a remote simple index.
+*/
+func remoteURL(baseURL string) string {
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	return baseURL
+}
+
+/*
+splitBases splits the configured bases into the names of local indexes and the URLs of remote ones.
+*/
+func splitBases(bases []string) (names []string, remoteURLs []string) {
+	for _, base := range bases {
+		if isRemoteBase(base) {
+			remoteURLs = append(remoteURLs, remoteURL(base))
+		} else {
+			names = append(names, base)
+		}
+	}
+	return names, remoteURLs
+}
+
+/*
+remoteBase links a repository to a remote simple index used as its base.
+*/
+type remoteBase struct {
+	RepositoryID uint   `gorm:"primary_key;auto_increment:false"`
+	URL          string `gorm:"primary_key"`
+	Position     int    `gorm:"NOT NULL"`
+}
+
+/*
+remoteFiles are the cached files of a project of a remote index.
+The files are nil, if the project does not exist.
+*/
+type remoteFiles struct {
+	files     []simple.File
+	expiresAt time.Time
+}
+
+/*
+remoteIndex is a remote simple index used as a base of local indexes.
+
+The answers of the remote index are cached for the configured cache time, the absence of
+projects for remoteMissCacheTime at most. Expired answers are dropped, when other answers are
+cached, and at most remoteCacheSize projects are cached. If the remote index is not available,
+the cached answers are used even if they are outdated. Without cached answers, the remote index
+is treated as being empty. In both cases, the remote index is not asked again for the retry
+interval to not block every request.
+*/
+type remoteIndex struct {
+	sync.Mutex
+	client            *simple.Client
+	cacheTime         time.Duration
+	projectNames      []string
+	projectsFetchedAt time.Time
+	projects          map[string]*remoteFiles
+	failedAt          time.Time
+}
+
+/*
+remoteIndex returns the remote simple index with the given URL.
+The indexes are shared by all repositories, so that they share the cached answers.
+*/
+func (db *datastore) remoteIndex(baseURL string) *remoteIndex {
+	baseURL = remoteURL(baseURL)
+	db.remotesLock.Lock()
+	defer db.remotesLock.Unlock()
+	if remote, exists := db.remotes[baseURL]; exists {
+		return remote
+	}
+	cfg := db.remoteConfigs[baseURL]
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = db.httpClient.Timeout
+	}
+	cacheTime := time.Duration(cfg.CacheTime) * time.Second
+	if cacheTime <= 0 {
+		cacheTime = defaultRemoteCacheTime
+	}
+	remote := &remoteIndex{
+		client:    simple.NewClient(baseURL, timeout),
+		cacheTime: cacheTime,
+		projects:  make(map[string]*remoteFiles),
+	}
+	db.remotes[baseURL] = remote
+	return remote
+}
+
+/*
+available checks whether the remote index might be asked, i.e. it has not failed recently.
+It has to be called with the lock held.
+*/
+func (r *remoteIndex) available() bool {
+	return time.Since(r.failedAt) >= remoteRetryInterval
+}
+
+/*
+failed logs the error of a request to the remote index and marks it as unavailable.
+*/
+func (r *remoteIndex) failed(err error) {
+	log.Printf("the remote index '%s' is not available: %s", r.client.BaseURL, err)
+	r.Lock()
+	r.failedAt = time.Now()
+	r.Unlock()
+}
+
+/*
+ProjectNames returns the names of all projects of the remote index.
+*/
+func (r *remoteIndex) ProjectNames() []string {
+	r.Lock()
+	names := r.projectNames
+	if time.Since(r.projectsFetchedAt) < r.cacheTime || !r.available() {
+		r.Unlock()
+		return names
+	}
+	r.Unlock()
+
+	fetched, err := r.client.Projects()
+	if err != nil {
+		r.failed(err)
+		return names
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.projectNames = fetched
+	r.projectsFetchedAt = time.Now()
+	return fetched
+}
+
+/*
+ProjectFiles returns the files of a project of the remote index, or nil if the project does not exist.
+*/
+func (r *remoteIndex) ProjectFiles(projectName string) []simple.File {
+	key := distribution.NormalizeName(projectName)
+	r.Lock()
+	cached := r.projects[key]
+	if cached != nil && time.Now().Before(cached.expiresAt) || !r.available() {
+		r.Unlock()
+		if cached == nil {
+			return nil
+		}
+		return cached.files
+	}
+	r.Unlock()
+
+	files, err := r.client.Project(projectName)
+	if err != nil {
+		r.failed(err)
+		if cached == nil {
+			return nil
+		}
+		return cached.files
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.cacheFiles(key, files)
+	return files
+}
+
+/*
+cacheFiles caches the files of a project after dropping the expired answers.
+If the cache is full nevertheless, the answer expiring first is dropped.
+It has to be called with the lock held.
+*/
+func (r *remoteIndex) cacheFiles(key string, files []simple.File) {
+	now := time.Now()
+	var first string
+	for cachedKey, cached := range r.projects {
+		if !now.Before(cached.expiresAt) {
+			delete(r.projects, cachedKey)
+		} else if first == "" || cached.expiresAt.Before(r.projects[first].expiresAt) {
+			first = cachedKey
+		}
+	}
+	if _, exists := r.projects[key]; !exists && len(r.projects) >= remoteCacheSize {
+		delete(r.projects, first)
+	}
+	cacheTime := r.cacheTime
+	if files == nil && cacheTime > remoteMissCacheTime {
+		cacheTime = remoteMissCacheTime
+	}
+	r.projects[key] = &remoteFiles{files: files, expiresAt: now.Add(cacheTime)}
+}
+
+/*
+remoteProject is a read-only project of a remote index.
+*/
+type remoteProject struct {
+	remote *remoteIndex
+	name   string
+}
+
+/*
+errRemote returns the error of modifications of projects of remote indexes.
+*/
+func errRemote(projectName string, remote *remoteIndex) error {
+	return fmt.Errorf("project '%s' belongs to the remote index '%s' and can not be modified",
+		projectName, remote.client.BaseURL)
+}
+
+func (p *remoteProject) Name() string {
+	return p.name
+}
+
+func (p *remoteProject) ProjectPath() string {
+	return ""
+}
+
+func (p *remoteProject) ProjectFiles() ([]ProjectFile, error) {
+	var result []ProjectFile
+	for _, file := range p.remote.ProjectFiles(p.name) {
+		// Files without a checksum can neither be verified nor linked
+		if file.SHA256 == "" {
+			continue
+		}
+		result = append(result, &remoteFile{project: p, file: file})
+	}
+	return result, nil
+}
+
+func (p *remoteProject) GetFile(fileName string) (ProjectFile, error) {
+	files, err := p.ProjectFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if file.Name() == fileName {
+			return file, nil
+		}
+	}
+	return nil, nil
+}
+
+func (p *remoteProject) AddFile(string, io.Reader) error {
+	return errRemote(p.name, p.remote)
+}
+
+func (p *remoteProject) NewUpload(string) (Upload, error) {
+	return nil, errRemote(p.name, p.remote)
+}
+
+func (p *remoteProject) IsReadOnly() bool {
+	return true
+}
+
+func (p *remoteProject) Repository() (Repository, error) {
+	// Remote projects are not stored in any local repository
+	return nil, nil
+}
+
+func (p *remoteProject) Releases() ([]Release, error) {
+	// The simple API does not publish the releases
+	return []Release{}, nil
+}
+
+func (p *remoteProject) GetRelease(string) (Release, error) {
+	return nil, nil
+}
+
+func (p *remoteProject) AddRelease(distribution.Metadata) (Release, error) {
+	return nil, errRemote(p.name, p.remote)
+}
+
+func (p *remoteProject) Delete() error {
+	return errRemote(p.name, p.remote)
+}
+
+/*
+remoteFile is a read-only file of a project of a remote index.
+Its content is streamed from the remote index on every download.
+*/
+type remoteFile struct {
+	project *remoteProject
+	file    simple.File
+}
+
+func (f *remoteFile) modificationError() error {
+	return errRemote(f.project.name, f.project.remote)
+}
+
+func (f *remoteFile) Name() string {
+	return f.file.Name
+}
+
+func (f *remoteFile) Checksum() string {
+	return f.file.SHA256
+}
+
+func (f *remoteFile) SetChecksum(string) error {
+	return f.modificationError()
+}
+
+func (f *remoteFile) IsLocked() bool {
+	return false
+}
+
+func (f *remoteFile) Lock() error {
+	return f.modificationError()
+}
+
+func (f *remoteFile) Unlock() error {
+	return f.modificationError()
+}
+
+/*
+DownloadError is returned, if the content of a file can not be downloaded from a remote index.
+*/
+type DownloadError struct {
+	err error
+}
+
+func (e *DownloadError) Error() string {
+	return e.err.Error()
+}
+
+func (f *remoteFile) Open() (storage.Object, error) {
+	response, err := f.project.remote.client.Get(f.file.URL)
+	if err != nil {
+		return nil, &DownloadError{err: err}
+	}
+	modTime, _ := http.ParseTime(response.Header.Get("Last-Modified"))
+	return &remoteObject{
+		ReadCloser: response.Body,
+		name:       f.Name(),
+		checksum:   f.Checksum(),
+		hash:       sha256.New(),
+		size:       response.ContentLength,
+		modTime:    modTime,
+	}, nil
+}
+
+func (f *remoteFile) SignedURL() (string, error) {
+	return "", nil
+}
+
+func (f *remoteFile) Write(io.Reader) error {
+	return f.modificationError()
+}
+
+func (f *remoteFile) Delete() error {
+	return f.modificationError()
+}
+
+func (f *remoteFile) Fetch() error {
+	return nil
+}
+
+func (f *remoteFile) Project() (Project, error) {
+	return f.project, nil
+}
+
+func (f *remoteFile) Release() (Release, error) {
+	return nil, nil
+}
+
+func (f *remoteFile) SetRelease(Release) error {
+	return f.modificationError()
+}
+
+func (f *remoteFile) RequiresPython() string {
+	return f.file.RequiresPython
+}
+
+func (f *remoteFile) SetRequiresPython(string) error {
+	return f.modificationError()
+}
+
+func (f *remoteFile) IsYanked() bool {
+	return f.file.Yanked
+}
+
+func (f *remoteFile) YankedReason() string {
+	return f.file.YankedReason
+}
+
+func (f *remoteFile) Yank(string) error {
+	return f.modificationError()
+}
+
+func (f *remoteFile) Unyank() error {
+	return f.modificationError()
+}
+
+/*
+remoteObject is the content of a file downloaded from a remote index.
+The content is hashed while it is read and reading it fails at its end,
+if it does not match the checksum published by the remote index.
+*/
+type remoteObject struct {
+	io.ReadCloser
+	name     string
+	checksum string
+	hash     hash.Hash
+	size     int64
+	modTime  time.Time
+}
+
+func (o *remoteObject) Read(p []byte) (int, error) {
+	n, err := o.ReadCloser.Read(p)
+	o.hash.Write(p[:n])
+	if err == io.EOF {
+		if checksum := hex.EncodeToString(o.hash.Sum(nil)); checksum != o.checksum {
+			return n, &DownloadError{
+				err: fmt.Errorf("the checksum of '%s' does not match: '%s' != '%s'", o.name, checksum, o.checksum),
+			}
+		}
+	}
+	return n, err
+}
+
+func (o *remoteObject) Size() int64 {
+	return o.size
+}
+
+func (o *remoteObject) ModTime() time.Time {
+	return o.modTime
+}
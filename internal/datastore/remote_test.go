@@ -0,0 +1,218 @@
+package datastore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type remoteTestSuite struct {
+	TestSuiteWithDatastore
+	remote   *httptest.Server
+	requests int32
+	content  []byte
+	repo     Repository
+}
+
+func TestRemote(t *testing.T) {
+	suite.Run(t, new(remoteTestSuite))
+}
+
+func (suite *remoteTestSuite) SetupTest() {
+	suite.TestSuiteWithDatastore.SetupTest()
+	suite.requests = 0
+	suite.content = []byte("remote content")
+	checksum := sha256.Sum256(suite.content)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/simple/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&suite.requests, 1)
+		if r.URL.Path != "/simple/" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = fmt.Fprint(w, `<a href="remote-app/">remote-app</a><a href="shared/">shared</a>`)
+	})
+	mux.HandleFunc("/simple/remote-app/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&suite.requests, 1)
+		_, _ = fmt.Fprintf(w, `<a href="/files/remote_app-1.0.tar.gz#sha256=%s">remote_app-1.0.tar.gz</a>`+
+			`<a href="/files/remote_app-0.9.tar.gz">remote_app-0.9.tar.gz</a>`+
+			`<a href="/files/remote_app-2.0.tar.gz#sha256=%[1]s">remote_app-2.0.tar.gz</a>`+
+			`<a href="/files/remote_app-3.0.tar.gz#sha256=%[1]s">remote_app-3.0.tar.gz</a>`,
+			hex.EncodeToString(checksum[:]))
+	})
+	mux.HandleFunc("/simple/slow/", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * time.Second)
+	})
+	mux.HandleFunc("/files/remote_app-1.0.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(suite.content)
+	})
+	// The transfer of the content takes longer than the timeout
+	mux.HandleFunc("/files/remote_app-2.0.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(suite.content[:1])
+		w.(http.Flusher).Flush()
+		time.Sleep(1500 * time.Millisecond)
+		_, _ = w.Write(suite.content[1:])
+	})
+	// The content does not match the published checksum
+	mux.HandleFunc("/files/remote_app-3.0.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("tampered content"))
+	})
+	suite.remote = httptest.NewServer(mux)
+	suite.db.remoteConfigs[remoteURL(suite.remote.URL+"/simple")] = remoteConfig{Timeout: 1}
+
+	var err error
+	suite.repo, err = newRepository(suite.db, "test", nil, suite.storagePath)
+	suite.Require().Nil(err, "unable to create the repository")
+	suite.Require().Nil(suite.repo.SetRemoteBases([]string{suite.remote.URL + "/simple"}),
+		"unable to set the remote bases")
+}
+
+func (suite *remoteTestSuite) TearDownTest() {
+	suite.remote.Close()
+	suite.TestSuiteWithDatastore.TearDownTest()
+}
+
+func (suite *remoteTestSuite) TestRemoteBases() {
+	require := suite.Require()
+	urls, err := suite.repo.RemoteBases()
+	require.Nil(err, "unable to get the remote bases")
+	require.Equal([]string{suite.remote.URL + "/simple/"}, urls, "the remote bases differ")
+	require.NotNil(suite.repo.SetRemoteBases([]string{"base"}), "a local base has been accepted as a remote one")
+}
+
+func (suite *remoteTestSuite) TestAllProjects() {
+	require := suite.Require()
+	_, err := suite.repo.AddProject("shared")
+	require.Nil(err, "unable to add the local project")
+	projects, err := suite.repo.AllProjects()
+	require.Nil(err, "unable to list the projects")
+	require.Len(projects, 2, "the remote projects have not been merged")
+	for _, project := range projects {
+		if project.Name() == "shared" {
+			require.False(project.IsReadOnly(), "the local project has been replaced by the remote one")
+		} else {
+			require.Equal("remote-app", project.Name())
+			require.True(project.IsReadOnly(), "remote projects have to be read-only")
+		}
+	}
+}
+
+func (suite *remoteTestSuite) TestGetProject() {
+	require := suite.Require()
+	project, err := suite.repo.GetProject("remote_app")
+	require.Nil(err, "unable to get the remote project")
+	require.NotNil(project, "the remote project has not been found")
+	files, err := project.ProjectFiles()
+	require.Nil(err, "unable to get the remote files")
+	require.Len(files, 3, "files without checksum have to be skipped")
+
+	file, err := project.GetFile("remote_app-1.0.tar.gz")
+	require.Nil(err, "unable to get the remote file")
+	content, err := readContent(file)
+	require.Nil(err, "unable to download the remote file")
+	require.True(bytes.Equal(suite.content, content), "the downloaded content differs")
+
+	require.NotNil(project.AddFile("remote_app-1.1.tar.gz", bytes.NewReader(nil)),
+		"a file has been added to the remote project")
+	require.NotNil(file.Delete(), "a remote file has been deleted")
+
+	project, err = suite.repo.GetProject("unknown")
+	require.Nil(err, "unable to look up an unknown project")
+	require.Nil(project, "an unknown project has been found")
+}
+
+func (suite *remoteTestSuite) TestSlowDownload() {
+	require := suite.Require()
+	project, err := suite.repo.GetProject("remote-app")
+	require.Nil(err, "unable to get the remote project")
+	file, err := project.GetFile("remote_app-2.0.tar.gz")
+	require.Nil(err, "unable to get the remote file")
+	content, err := readContent(file)
+	require.Nil(err, "the download has been aborted by the timeout")
+	require.Equal(suite.content, content, "the downloaded content differs")
+
+	suite.remote.Close()
+	_, err = file.Open()
+	require.IsType(&DownloadError{}, err, "a failed download is not reported as such")
+}
+
+func (suite *remoteTestSuite) TestTamperedDownload() {
+	require := suite.Require()
+	project, err := suite.repo.GetProject("remote-app")
+	require.Nil(err, "unable to get the remote project")
+	file, err := project.GetFile("remote_app-3.0.tar.gz")
+	require.Nil(err, "unable to get the remote file")
+	_, err = readContent(file)
+	require.IsType(&DownloadError{}, err, "a content not matching the checksum has been read")
+}
+
+func (suite *remoteTestSuite) TestCacheLimits() {
+	require := suite.Require()
+	remote := suite.db.remoteIndex(suite.remote.URL + "/simple")
+	project, err := suite.repo.GetProject("unknown")
+	require.Nil(err, "unable to get the project")
+	require.Nil(project, "an unknown project has been found")
+	remote.Lock()
+	defer remote.Unlock()
+	require.True(remote.projects["unknown"].expiresAt.Before(time.Now().Add(remoteMissCacheTime+time.Second)),
+		"the absence of a project is cached as long as a project")
+
+	for i := 0; i < remoteCacheSize+10; i++ {
+		remote.cacheFiles(fmt.Sprintf("project-%d", i), nil)
+	}
+	require.Len(remote.projects, remoteCacheSize, "the number of cached projects is not limited")
+	remote.projects["project-42"].expiresAt = time.Time{}
+	remote.cacheFiles("other", nil)
+	require.NotContains(remote.projects, "project-42", "an expired answer has been kept")
+	require.Len(remote.projects, remoteCacheSize, "an answer has been dropped without need")
+}
+
+func (suite *remoteTestSuite) TestCaching() {
+	require := suite.Require()
+	for i := 0; i < 3; i++ {
+		project, err := suite.repo.GetProject("remote-app")
+		require.Nil(err, "unable to get the remote project")
+		_, err = project.ProjectFiles()
+		require.Nil(err, "unable to get the remote files")
+	}
+	require.Equal(int32(1), atomic.LoadInt32(&suite.requests), "the remote answers have not been cached")
+}
+
+func (suite *remoteTestSuite) TestRemoteNotAvailable() {
+	require := suite.Require()
+	project, err := suite.repo.GetProject("remote-app")
+	require.Nil(err, "unable to get the remote project")
+	require.NotNil(project, "the remote project has not been found")
+	// Outdated answers are served, if the remote is down
+	suite.db.remoteIndex(suite.remote.URL + "/simple").projects["remote-app"].expiresAt = time.Time{}
+	suite.remote.Close()
+
+	project, err = suite.repo.GetProject("remote-app")
+	require.Nil(err, "a failing remote has not been ignored")
+	require.NotNil(project, "the cached remote project has not been served")
+	projects, err := suite.repo.AllProjects()
+	require.Nil(err, "a failing remote has not been ignored")
+	require.Empty(projects, "projects of a failing remote have been listed")
+}
+
+func (suite *remoteTestSuite) TestTimeout() {
+	require := suite.Require()
+	start := time.Now()
+	project, err := suite.repo.GetProject("slow")
+	require.Nil(err, "a timed out remote has not been ignored")
+	require.Nil(project, "a project of a timed out remote has been found")
+	require.True(time.Since(start) < 2*time.Second, "the configured timeout has not been used")
+
+	// The remote is not asked again immediately
+	start = time.Now()
+	_, err = suite.repo.GetProject("slow")
+	require.Nil(err, "a timed out remote has not been ignored")
+	require.True(time.Since(start) < 500*time.Millisecond, "the failed remote has been asked again")
+}
@@ -1,9 +1,14 @@
 package datastore
 
 import (
+	"fmt"
+	"github.com/hansingt/GoatCheese/internal/distribution"
+	"github.com/hansingt/GoatCheese/internal/simple"
 	"github.com/jinzhu/gorm"
-	"os"
+	"log"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 /*
@@ -16,48 +21,110 @@ These repositories are requested, if a project is not found in the repository it
 type Repository interface {
 	// Name returns the name of the repository
 	Name() string
-	// Bases returns the slice of base repositories
+	// Bases returns the slice of base repositories in the order they are asked for projects
 	Bases() ([]Repository, error)
+	// RemoteBases returns the URLs of the remote simple indexes used as bases after the base repositories
+	RemoteBases() ([]string, error)
+	// SetRemoteBases sets the URLs of the remote simple indexes used as bases
+	SetRemoteBases(urls []string) error
+	// Projects returns a slice of the projects stored in this repository itself
+	Projects() ([]Project, error)
 	// AllProjects returns a slice of all projects defined
-	// in all reachable repositories
+	// in all reachable repositories, including remote ones
 	AllProjects() ([]Project, error)
 	// RepositoryPath returns the storage path of the repository
 	RepositoryPath() string
 	// AddProject adds a new project to this repository
 	AddProject(projectName string) (Project, error)
-	// GetProject returns a project given its project name
+	// GetProject returns a project given its project name. If the repository does not contain the
+	// project itself, it is searched in the bases and the remote bases according to the shadowing policy.
 	GetProject(projectName string) (Project, error)
+	// GetLocalProject returns a project stored in this repository itself, ignoring the bases
+	GetLocalProject(projectName string) (Project, error)
+	// ShadowingPolicy returns how projects relate to the same-named projects of the bases
+	ShadowingPolicy() ShadowingPolicy
+	// SetShadowingPolicy sets how projects relate to the same-named projects of the bases
+	SetShadowingPolicy(policy ShadowingPolicy) error
 	// StoragePath returns the storage base path for all repositories
 	StoragePath() string
-	// SetBases sets the slice of base repositories for this repository
+	// SetBases sets the slice of base repositories for this repository, preserving their order
 	SetBases(baseRepositories []Repository) error
+	// Upstream returns the URL of the upstream simple index projects are proxied from
+	Upstream() string
+	// SetUpstream sets the URL of the upstream simple index
+	SetUpstream(upstreamURL string) error
+	// ProxyProject returns a project from the upstream index and caches it in this repository
+	ProxyProject(projectName string) (Project, error)
+	// Promote copies a release of a project stored in this repository including all of its files
+	// into the target repository. The files share their contents with the original ones. If move
+	// is true, the release is deleted from this repository afterwards.
+	Promote(projectName string, version string, target Repository, move bool) (Release, error)
+	// SetPermissions replaces the users granted each permission on this repository
+	SetPermissions(permissions map[Permission][]string) error
+	// IsAllowed checks whether a user has a permission on this repository. Anonymous users have an empty name.
+	IsAllowed(userName string, permission Permission) (bool, error)
+	// AllowsOverwrite checks whether existing files might be replaced by files with different contents
+	AllowsOverwrite() bool
+	// SetAllowOverwrite sets whether existing files might be replaced by files with different contents
+	SetAllowOverwrite(allowOverwrite bool) error
+	// IsVolatile checks whether files might be deleted or replaced. Otherwise, files can only be added.
+	IsVolatile() bool
+	// SetVolatile sets whether files might be deleted or replaced
+	SetVolatile(volatile bool) error
+	// MaxUploadSize returns the maximum size of uploaded files in bytes. Zero means unlimited.
+	MaxUploadSize() int64
+	// SetMaxUploadSize sets the maximum size of uploaded files in bytes
+	SetMaxUploadSize(maxUploadSize int64) error
 }
 
+// upstreamRefreshInterval defines how long a cached upstream project is served without asking the upstream again
+const upstreamRefreshInterval = 30 * time.Minute
+
 type repository struct {
 	gorm.Model
-	db              *datastore    `gorm:"-"`
-	RepositoryName  string        `gorm:"unique_index"`
-	RepositoryBases []*repository `gorm:"many2many:repository_bases;association_jointable_foreignkey:parent_id"`
-	Storage         string
+	db             *datastore `gorm:"-"`
+	RepositoryName string     `gorm:"unique_index"`
+	Storage        string
+	UpstreamURL    string
+	AllowOverwrite bool  `gorm:"NOT NULL"`
+	MaxUploadBytes int64 `gorm:"NOT NULL"`
+	Shadowing      ShadowingPolicy
+	Immutable      bool `gorm:"NOT NULL;default:false"` // Repositories stored before are volatile
+}
+
+/*
+repositoryBase links a repository to one of its base repositories.
+The bases are asked for projects in the order of their position.
+*/
+type repositoryBase struct {
+	RepositoryID uint `gorm:"primary_key;auto_increment:false"`
+	ParentID     uint `gorm:"primary_key;auto_increment:false"`
+	Position     int  `gorm:"NOT NULL;default:0"`
+}
+
+// TableName keeps the name of the table used before the position has been stored
+func (repositoryBase) TableName() string {
+	return "repository_bases"
 }
 
 func newRepository(db *datastore, name string, baseNames []string, storagePath string) (Repository, error) {
-	var bases []*repository
-	if err := db.Model(&repository{}).Find(&bases, "repository_name IN (?)", baseNames).Error; err != nil {
-		return nil, err
+	var bases []Repository
+	for _, baseName := range baseNames {
+		base, err := db.GetRepository(baseName)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get the base '%s' of '%s': %s", baseName, name, err)
+		}
+		bases = append(bases, base)
 	}
 	repo := &repository{
-		db:              db,
-		RepositoryName:  name,
-		RepositoryBases: bases,
-		Storage:         storagePath,
+		db:             db,
+		RepositoryName: name,
+		Storage:        storagePath,
 	}
-	if _, err := os.Stat(repo.RepositoryPath()); err != nil {
-		if err = os.MkdirAll(repo.RepositoryPath(), 0750); err != nil {
-			return nil, err
-		}
+	if err := db.Model(repo).Create(repo).Error; err != nil {
+		return nil, err
 	}
-	return repo, db.Model(repo).Create(repo).Error
+	return repo, repo.SetBases(bases)
 }
 
 func (r *repository) Name() string {
@@ -74,7 +141,11 @@ func (r *repository) RepositoryPath() string {
 
 func (r *repository) Bases() ([]Repository, error) {
 	var bases []*repository
-	if err := r.db.Model(r).Association("RepositoryBases").Find(&bases).Error; err != nil {
+	err := r.db.Joins("JOIN repository_bases ON repository_bases.parent_id = repositories.id").
+		Where("repository_bases.repository_id = ?", r.ID).
+		Order("repository_bases.position, repository_bases.parent_id").
+		Find(&bases).Error
+	if err != nil {
 		return nil, err
 	}
 	var result []Repository
@@ -85,19 +156,40 @@ func (r *repository) Bases() ([]Repository, error) {
 	return result, nil
 }
 
-func (r *repository) AllProjects() ([]Project, error) {
-	// Find the projects of this repository
+func (r *repository) Projects() ([]Project, error) {
 	var projects []*project
 	if err := r.db.Find(&projects, &project{RepositoryID: r.ID}).Error; err != nil {
 		return nil, err
 	}
-	projectSet := make(map[string]Project, len(projects))
-	for _, project := range projects {
+	result := make([]Project, len(projects))
+	for i, project := range projects {
 		project.db = r.db
-		projectSet[project.Name()] = project
+		result[i] = project
 	}
+	return result, nil
+}
 
-	// Find the projects of all base repositories
+func (r *repository) AllProjects() ([]Project, error) {
+	// Projects with the same normalized name are collected in the order of precedence
+	var names []string
+	projectSet := make(map[string][]Project)
+	add := func(project Project) {
+		key := distribution.NormalizeName(project.Name())
+		if _, exists := projectSet[key]; !exists {
+			names = append(names, key)
+		}
+		projectSet[key] = append(projectSet[key], project)
+	}
+
+	// Find the projects of this repository
+	projects, err := r.Projects()
+	if err != nil {
+		return nil, err
+	}
+	for _, project := range projects {
+		add(project)
+	}
+	// Then the projects of all base repositories
 	bases, err := r.Bases()
 	if err != nil {
 		return nil, err
@@ -108,36 +200,182 @@ func (r *repository) AllProjects() ([]Project, error) {
 			return nil, err
 		}
 		for _, project := range baseProjects {
-			if _, exists := projectSet[project.Name()]; !exists {
-				projectSet[project.Name()] = project
-			}
+			add(project)
 		}
 	}
-	// Then convert the set to a slice
-	result := make([]Project, 0, len(projectSet))
-	for _, project := range projectSet {
-		result = append(result, project)
+	// Finally, the projects of the remote bases
+	remotes, err := r.remoteIndexes()
+	if err != nil {
+		return nil, err
+	}
+	for _, remote := range remotes {
+		for _, projectName := range remote.ProjectNames() {
+			add(&remoteProject{remote: remote, name: projectName})
+		}
+	}
+
+	result := make([]Project, 0, len(names))
+	for _, name := range names {
+		result = append(result, r.combine(projectSet[name]))
 	}
 	return result, nil
 }
 
+/*
+combine returns the project visible in this repository given the same-named projects
+of the repository and its bases in the order of precedence.
+*/
+func (r *repository) combine(projects []Project) Project {
+	if len(projects) > 1 && r.ShadowingPolicy() == PolicyMerge {
+		return &mergedProject{projects: projects}
+	}
+	return projects[0]
+}
+
 func (r *repository) AddProject(projectName string) (Project, error) {
+	project, err := r.prepareProject(projectName)
+	if err != nil {
+		return nil, err
+	} else if project.ID == 0 {
+		// Add a new project
+		if err = r.db.Create(project).Error; err != nil {
+			return nil, err
+		}
+	}
+	return project, nil
+}
+
+/*
+prepareProject returns the project with the given name stored in this repository.
+If it is not defined yet, a new project is returned, which has not been stored yet.
+*/
+func (r *repository) prepareProject(projectName string) (*project, error) {
 	// Check whether the project is already defined
-	project, err := r.GetProject(projectName)
+	existing, err := r.localProject(projectName)
 	if err != nil {
 		return nil, err
-	} else if project != nil {
-		return project, nil
+	} else if existing != nil {
+		return existing.(*project), nil
 	}
-	// Add a new project
-	project, err = newProject(r.db, r.ID, projectName, r.RepositoryPath())
+	if r.ShadowingPolicy() == PolicyDeny {
+		shadowed, err := r.baseProject(projectName)
+		if err != nil {
+			return nil, err
+		} else if shadowed != nil {
+			return nil, ErrShadowing
+		}
+	}
+	return &project{
+		db:             r.db,
+		RepositoryID:   r.ID,
+		ProjectName:    projectName,
+		RepositoryPath: r.RepositoryPath(),
+	}, nil
+}
+
+/*
+baseProject returns a project of the bases, whose name equals the given one after normalizing both.
+*/
+func (r *repository) baseProject(projectName string) (Project, error) {
+	name := distribution.NormalizeName(projectName)
+	bases, err := r.Bases()
 	if err != nil {
 		return nil, err
 	}
-	return project, nil
+	for _, base := range bases {
+		if project, err := base.(*repository).similarProject(name); err != nil || project != nil {
+			return project, err
+		}
+		if project, err := base.(*repository).baseProject(name); err != nil || project != nil {
+			return project, err
+		}
+	}
+	remotes, err := r.remoteIndexes()
+	if err != nil {
+		return nil, err
+	}
+	for _, remote := range remotes {
+		if files := remote.ProjectFiles(projectName); files != nil {
+			return &remoteProject{remote: remote, name: name}, nil
+		}
+	}
+	return nil, nil
+}
+
+/*
+similarProject returns a project stored in this repository itself, whose name equals the given one after
+normalizing both. Only the projects, whose names might be spellings of the normalized name, are loaded.
+*/
+func (r *repository) similarProject(projectName string) (Project, error) {
+	name := distribution.NormalizeName(projectName)
+	var candidates []*project
+	err := r.db.Where("repository_id = ? AND LOWER(project_name) LIKE ?", r.ID, strings.Replace(name, "-", "%", -1)).
+		Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, candidate := range candidates {
+		if distribution.NormalizeName(candidate.ProjectName) == name {
+			candidate.db = r.db
+			return candidate, nil
+		}
+	}
+	return nil, nil
 }
 
 func (r *repository) GetProject(projectName string) (Project, error) {
+	// The projects are searched in the order of precedence.
+	// Without merging, the first project found shadows all others.
+	merge := r.ShadowingPolicy() == PolicyMerge
+	var projects []Project
+	project, err := r.localProject(projectName)
+	if err != nil {
+		return nil, err
+	} else if project != nil {
+		if projects = append(projects, project); !merge {
+			return project, nil
+		}
+	}
+	bases, err := r.Bases()
+	if err != nil {
+		return nil, err
+	}
+	for _, base := range bases {
+		project, err := base.GetProject(projectName)
+		if err != nil {
+			return nil, err
+		} else if project != nil {
+			if projects = append(projects, project); !merge {
+				return project, nil
+			}
+		}
+	}
+	remotes, err := r.remoteIndexes()
+	if err != nil {
+		return nil, err
+	}
+	for _, remote := range remotes {
+		if files := remote.ProjectFiles(projectName); files != nil {
+			projects = append(projects, &remoteProject{remote: remote, name: distribution.NormalizeName(projectName)})
+			if !merge {
+				break
+			}
+		}
+	}
+	if len(projects) == 0 {
+		return nil, nil
+	}
+	return r.combine(projects), nil
+}
+
+func (r *repository) GetLocalProject(projectName string) (Project, error) {
+	return r.localProject(projectName)
+}
+
+/*
+localProject returns the project with the given name stored in this repository, or nil if it does not exist.
+*/
+func (r *repository) localProject(projectName string) (Project, error) {
 	project := &project{
 		RepositoryID: r.ID,
 		ProjectName:  projectName,
@@ -154,10 +392,233 @@ func (r *repository) GetProject(projectName string) (Project, error) {
 }
 
 func (r *repository) SetBases(baseRepositories []Repository) error {
-	var bases []*repository
-	for _, base := range baseRepositories {
-		bases = append(bases, base.(*repository))
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return r.setBases(tx, baseRepositories)
+	})
+}
+
+/*
+setBases replaces the base repositories within the given transaction.
+*/
+func (r *repository) setBases(tx *gorm.DB, baseRepositories []Repository) error {
+	if err := tx.Delete(&repositoryBase{}, "repository_id = ?", r.ID).Error; err != nil {
+		return err
+	}
+	for i, base := range baseRepositories {
+		err := tx.Create(&repositoryBase{
+			RepositoryID: r.ID,
+			ParentID:     base.(*repository).ID,
+			Position:     i,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *repository) RemoteBases() ([]string, error) {
+	var bases []*remoteBase
+	if err := r.db.Order("position").Find(&bases, "repository_id = ?", r.ID).Error; err != nil {
+		return nil, err
+	}
+	urls := make([]string, len(bases))
+	for i, base := range bases {
+		urls[i] = base.URL
+	}
+	return urls, nil
+}
+
+func (r *repository) SetRemoteBases(urls []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return r.setRemoteBases(tx, urls)
+	})
+}
+
+/*
+setRemoteBases replaces the URLs of the remote bases within the given transaction.
+*/
+func (r *repository) setRemoteBases(tx *gorm.DB, urls []string) error {
+	if err := tx.Delete(&remoteBase{}, "repository_id = ?", r.ID).Error; err != nil {
+		return err
+	}
+	for i, baseURL := range urls {
+		if !isRemoteBase(baseURL) {
+			return fmt.Errorf("the remote base '%s' of '%s' is no HTTP(S) URL", baseURL, r.Name())
+		}
+		err := tx.Create(&remoteBase{RepositoryID: r.ID, URL: remoteURL(baseURL), Position: i}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+remoteIndexes returns the remote simple indexes used as bases in their configured order.
+*/
+func (r *repository) remoteIndexes() ([]*remoteIndex, error) {
+	urls, err := r.RemoteBases()
+	if err != nil {
+		return nil, err
+	}
+	remotes := make([]*remoteIndex, len(urls))
+	for i, baseURL := range urls {
+		remotes[i] = r.db.remoteIndex(baseURL)
+	}
+	return remotes, nil
+}
+
+func (r *repository) Upstream() string {
+	return r.UpstreamURL
+}
+
+func (r *repository) SetUpstream(upstreamURL string) error {
+	r.UpstreamURL = upstreamURL
+	return r.db.Model(r).Update("UpstreamURL", upstreamURL).Error
+}
+
+func (r *repository) ProxyProject(projectName string) (Project, error) {
+	if r.Upstream() == "" {
+		return nil, nil
+	}
+	cached, err := r.localProject(projectName)
+	if err != nil {
+		return nil, err
+	} else if cached != nil && !cached.IsReadOnly() {
+		// Local projects are never replaced by upstream ones
+		return cached, nil
+	}
+	// Cache upstream projects by their normalized name, that all spellings share the same files
+	if normalized := distribution.NormalizeName(projectName); normalized != projectName {
+		projectName = normalized
+		if cached, err = r.localProject(projectName); err != nil {
+			return nil, err
+		} else if cached != nil && !cached.IsReadOnly() {
+			return cached, nil
+		}
+	}
+	if cached == nil {
+		// Neither are projects of remote bases
+		remote, err := r.GetProject(projectName)
+		if err != nil || remote != nil {
+			return remote, err
+		}
+	} else if cached != nil && time.Since(cached.(*project).UpdatedAt) < upstreamRefreshInterval {
+		return cached, nil
+	}
+
+	upstreamURL := r.Upstream()
+	if !strings.HasSuffix(upstreamURL, "/") {
+		upstreamURL += "/"
+	}
+	client := &simple.Client{BaseURL: upstreamURL, HTTP: r.db.httpClient}
+	files, err := client.Project(projectName)
+	if err != nil {
+		if cached != nil {
+			// Serve the cached project, if the upstream is not available
+			log.Printf("unable to refresh project '%s' from '%s': %s", projectName, upstreamURL, err)
+			return cached, nil
+		}
+		return nil, err
+	} else if files == nil {
+		return cached, nil
+	}
+
+	if cached == nil {
+		cached, err = newProject(r.db, r.ID, projectName, r.RepositoryPath())
+		if err != nil {
+			return nil, err
+		}
+	}
+	prj := cached.(*project)
+	if err = prj.setReadOnly(); err != nil {
+		return nil, err
+	}
+	for _, upstreamFile := range files {
+		if err = prj.addUpstreamFile(upstreamFile); err != nil {
+			return nil, err
+		}
 	}
-	r.RepositoryBases = bases
-	return r.db.Model(r).Updates(r).Error
+	return prj, nil
+}
+
+func (r *repository) SetPermissions(permissions map[Permission][]string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return r.setPermissions(tx, permissions)
+	})
+}
+
+/*
+setPermissions replaces the users granted each permission within the given transaction.
+*/
+func (r *repository) setPermissions(tx *gorm.DB, permissions map[Permission][]string) error {
+	err := tx.Unscoped().Delete(&repositoryPermission{}, "repository_id = ?", r.ID).Error
+	if err != nil {
+		return err
+	}
+	for permission, userNames := range permissions {
+		for _, userName := range userNames {
+			err = tx.Create(&repositoryPermission{
+				RepositoryID: r.ID,
+				UserName:     userName,
+				Permission:   permission,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *repository) IsAllowed(userName string, permission Permission) (bool, error) {
+	userNames := []string{AnyUser}
+	if userName != "" {
+		userNames = append(userNames, userName)
+	}
+	var count int
+	err := r.db.Model(&repositoryPermission{}).
+		Where("repository_id = ? AND permission >= ? AND user_name IN (?)", r.ID, permission, userNames).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *repository) AllowsOverwrite() bool {
+	return r.AllowOverwrite
+}
+
+func (r *repository) SetAllowOverwrite(allowOverwrite bool) error {
+	r.AllowOverwrite = allowOverwrite
+	return r.db.Model(r).Update("AllowOverwrite", allowOverwrite).Error
+}
+
+func (r *repository) IsVolatile() bool {
+	return !r.Immutable
+}
+
+func (r *repository) SetVolatile(volatile bool) error {
+	r.Immutable = !volatile
+	return r.db.Model(r).Update("Immutable", r.Immutable).Error
+}
+
+func (r *repository) MaxUploadSize() int64 {
+	return r.MaxUploadBytes
+}
+
+func (r *repository) SetMaxUploadSize(maxUploadSize int64) error {
+	r.MaxUploadBytes = maxUploadSize
+	return r.db.Model(r).Update("MaxUploadBytes", maxUploadSize).Error
+}
+
+func (r *repository) ShadowingPolicy() ShadowingPolicy {
+	if r.Shadowing == "" {
+		return PolicyShadow
+	}
+	return r.Shadowing
+}
+
+func (r *repository) SetShadowingPolicy(policy ShadowingPolicy) error {
+	r.Shadowing = policy
+	return r.db.Model(r).Update("Shadowing", policy).Error
 }
@@ -1,7 +1,13 @@
 package datastore
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"testing"
 )
@@ -54,6 +60,26 @@ func (suite *repositoryTestSuite) TestSetAndGetBases() {
 	require.Equal(base.Name(), bases[0].Name(), "not the correct base has been found")
 }
 
+func (suite *repositoryTestSuite) TestBasesOrder() {
+	require := suite.Require()
+	first, err := newRepository(suite.db, "first", nil, suite.storagePath)
+	require.Nil(err, "unable to create a base repository")
+	second, err := newRepository(suite.db, "second", nil, suite.storagePath)
+	require.Nil(err, "unable to create a base repository")
+
+	for _, order := range [][]Repository{{second, first}, {first, second}} {
+		require.Nil(suite.repo.SetBases(order), "unable to set the repository bases")
+		bases, err := suite.repo.Bases()
+		require.Nil(err, "unable to get the repository bases")
+		require.Len(bases, 2, "the number of bases differs")
+		require.Equal(order[0].Name(), bases[0].Name(), "the order of the bases has not been preserved")
+		require.Equal(order[1].Name(), bases[1].Name(), "the order of the bases has not been preserved")
+	}
+
+	_, err = newRepository(suite.db, "broken", []string{"undefined"}, suite.storagePath)
+	require.NotNil(err, "an undefined base has been dropped silently")
+}
+
 func (suite *repositoryTestSuite) TestAllProjects() {
 	require := suite.Require()
 
@@ -125,3 +151,124 @@ func (suite *repositoryTestSuite) TestAddExistingProject() {
 	require.Nil(err, "unable to get the projects from the repository")
 	require.Equal(1, len(projects), "the project got added twice")
 }
+
+func (suite *repositoryTestSuite) TestProxyProject() {
+	require := suite.Require()
+	content := []byte("upstream content")
+	checksum := sha256.Sum256(content)
+	downloads := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/simple/fuubar/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `<a href="/files/fuubar-1.0.tar.gz#sha256=%s">fuubar-1.0.tar.gz</a>`,
+			hex.EncodeToString(checksum[:]))
+	})
+	mux.HandleFunc("/files/fuubar-1.0.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		_, _ = w.Write(content)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Without an upstream, nothing is proxied
+	project, err := suite.repo.ProxyProject("fuubar")
+	require.Nil(err, "unable to proxy the project")
+	require.Nil(project, "a project has been proxied without upstream")
+
+	require.Nil(suite.repo.SetUpstream(server.URL+"/simple"), "unable to set the upstream")
+	require.Equal(server.URL+"/simple", suite.repo.Upstream())
+
+	// Unknown projects are not found
+	project, err = suite.repo.ProxyProject("unknown")
+	require.Nil(err, "unable to proxy the project")
+	require.Nil(project, "an unknown project has been found")
+
+	// Known projects are cached as read-only projects
+	project, err = suite.repo.ProxyProject("fuubar")
+	require.Nil(err, "unable to proxy the project")
+	require.NotNil(project, "the project has not been found")
+	require.True(project.IsReadOnly(), "the project is not read-only")
+	require.NotNil(project.AddFile("fuubar-2.0.tar.gz", nil), "a file has been added to a read-only project")
+	project, err = suite.repo.GetProject("fuubar")
+	require.Nil(err, "unable to get the cached project")
+	require.NotNil(project, "the project has not been cached")
+
+	// The files are downloaded lazily
+	file, err := project.GetFile("fuubar-1.0.tar.gz")
+	require.Nil(err, "unable to get the file")
+	require.NotNil(file, "the file has not been found")
+	require.Equal(hex.EncodeToString(checksum[:]), file.Checksum())
+	require.Equal(0, downloads, "the file has been downloaded eagerly")
+	require.Nil(file.Fetch(), "unable to fetch the file")
+	require.Nil(file.Fetch(), "unable to fetch the file again")
+	require.Equal(1, downloads, "the file has not been cached")
+	_, err = readContent(file)
+	require.Nil(err, "the file has not been written")
+
+	// Other spellings of the name share the cached project
+	for _, projectName := range []string{"FuuBar", "FUUBAR"} {
+		project, err = suite.repo.ProxyProject(projectName)
+		require.Nil(err, "unable to proxy the project")
+		require.NotNil(project, "the project has not been found")
+		require.Equal("fuubar", project.Name(), "the name has not been normalized")
+	}
+	projects, err := suite.repo.AllProjects()
+	require.Nil(err, "unable to get the projects")
+	require.Len(projects, 1, "the project has been cached twice")
+	require.Equal(1, downloads, "the file has been downloaded again")
+}
+
+func (suite *repositoryTestSuite) TestProxyProjectChecksumMismatch() {
+	require := suite.Require()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/simple/fuubar/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `<a href="/files/fuubar-1.0.tar.gz#sha256=abc">fuubar-1.0.tar.gz</a>`)
+	})
+	mux.HandleFunc("/files/fuubar-1.0.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "tampered content")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	require.Nil(suite.repo.SetUpstream(server.URL+"/simple/"), "unable to set the upstream")
+	project, err := suite.repo.ProxyProject("fuubar")
+	require.Nil(err, "unable to proxy the project")
+	file, err := project.GetFile("fuubar-1.0.tar.gz")
+	require.Nil(err, "unable to get the file")
+	require.NotNil(file.Fetch(), "a file with a wrong checksum has been accepted")
+	require.Equal("abc", file.Checksum(), "the upstream checksum has been replaced")
+	_, err = readContent(file)
+	require.True(os.IsNotExist(err), "the file with the wrong checksum has been kept")
+}
+
+func (suite *repositoryTestSuite) TestPermissions() {
+	require := suite.Require()
+	check := func(userName string, permission Permission, expected bool) {
+		allowed, err := suite.repo.IsAllowed(userName, permission)
+		require.Nil(err, "unable to check the permission")
+		require.Equal(expected, allowed, "wrong %s permission for user '%s'", permission, userName)
+	}
+	// Without permissions, nobody is allowed anything
+	check("", PermissionRead, false)
+
+	require.Nil(suite.repo.SetPermissions(map[Permission][]string{
+		PermissionRead:   {AnyUser},
+		PermissionUpload: {"alice"},
+		PermissionAdmin:  {"bob"},
+	}), "unable to set the permissions")
+	check("", PermissionRead, true)
+	check("", PermissionUpload, false)
+	check("alice", PermissionRead, true)
+	check("alice", PermissionUpload, true)
+	check("alice", PermissionAdmin, false)
+	check("bob", PermissionUpload, true)
+	check("bob", PermissionAdmin, true)
+
+	// Setting the permissions replaces the old ones
+	require.Nil(suite.repo.SetPermissions(map[Permission][]string{
+		PermissionUpload: {"bob"},
+	}), "unable to set the permissions")
+	check("", PermissionRead, false)
+	check("alice", PermissionRead, false)
+	check("bob", PermissionAdmin, false)
+	check("bob", PermissionUpload, true)
+}
@@ -0,0 +1,145 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hansingt/GoatCheese/internal/distribution"
+	"io"
+)
+
+/*
+ShadowingPolicy defines how projects of a repository relate to the same-named projects of its bases.
+*/
+type ShadowingPolicy string
+
+const (
+	// PolicyShadow lets projects of the repository hide the same-named projects of the bases
+	PolicyShadow ShadowingPolicy = "shadow"
+	// PolicyMerge merges the files of the same-named projects of the repository and all of its bases
+	PolicyMerge ShadowingPolicy = "merge"
+	// PolicyDeny refuses to add projects to the repository, which exist in one of its bases.
+	// This prevents dependency confusion, as projects of the bases can not be replaced.
+	PolicyDeny ShadowingPolicy = "deny"
+)
+
+// ErrShadowing is returned, if a project can not be added, because it would shadow a project of a base
+var ErrShadowing = errors.New("the project exists in a base and the repository denies shadowing it")
+
+/*
+parseShadowingPolicy parses the shadowing policy given in the configuration.
+An empty policy defaults to PolicyShadow.
+*/
+func parseShadowingPolicy(value string) (ShadowingPolicy, error) {
+	switch policy := ShadowingPolicy(value); policy {
+	case "":
+		return PolicyShadow, nil
+	case PolicyShadow, PolicyMerge, PolicyDeny:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown shadowing policy '%s'", value)
+	}
+}
+
+/*
+mergedProject combines the same-named projects of a repository and its bases.
+
+The projects are given in the order of precedence. If several projects contain a file
+with the same name, the file of the first project is used. Merged projects can not be
+modified, the projects of the single repositories have to be modified instead.
+*/
+type mergedProject struct {
+	projects []Project
+}
+
+func (p *mergedProject) modificationError() error {
+	return fmt.Errorf("project '%s' is merged from several repositories and can not be modified", p.Name())
+}
+
+func (p *mergedProject) Name() string {
+	return p.projects[0].Name()
+}
+
+func (p *mergedProject) ProjectPath() string {
+	return p.projects[0].ProjectPath()
+}
+
+func (p *mergedProject) ProjectFiles() ([]ProjectFile, error) {
+	var result []ProjectFile
+	seen := make(map[string]bool)
+	for _, prj := range p.projects {
+		files, err := prj.ProjectFiles()
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if !seen[file.Name()] {
+				seen[file.Name()] = true
+				result = append(result, file)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (p *mergedProject) GetFile(fileName string) (ProjectFile, error) {
+	for _, prj := range p.projects {
+		file, err := prj.GetFile(fileName)
+		if err != nil || file != nil {
+			return file, err
+		}
+	}
+	return nil, nil
+}
+
+func (p *mergedProject) AddFile(string, io.Reader) error {
+	return p.modificationError()
+}
+
+func (p *mergedProject) NewUpload(string) (Upload, error) {
+	return nil, p.modificationError()
+}
+
+func (p *mergedProject) IsReadOnly() bool {
+	return p.projects[0].IsReadOnly()
+}
+
+func (p *mergedProject) Repository() (Repository, error) {
+	// The files of merged projects are stored in different repositories
+	return nil, nil
+}
+
+func (p *mergedProject) Releases() ([]Release, error) {
+	var result []Release
+	seen := make(map[string]bool)
+	for _, prj := range p.projects {
+		releases, err := prj.Releases()
+		if err != nil {
+			return nil, err
+		}
+		for _, release := range releases {
+			if !seen[release.Version()] {
+				seen[release.Version()] = true
+				result = append(result, release)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (p *mergedProject) GetRelease(version string) (Release, error) {
+	for _, prj := range p.projects {
+		release, err := prj.GetRelease(version)
+		if err != nil || release != nil {
+			return release, err
+		}
+	}
+	return nil, nil
+}
+
+func (p *mergedProject) AddRelease(distribution.Metadata) (Release, error) {
+	return nil, p.modificationError()
+}
+
+func (p *mergedProject) Delete() error {
+	return p.modificationError()
+}
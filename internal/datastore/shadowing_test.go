@@ -0,0 +1,151 @@
+package datastore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type shadowingTestSuite struct {
+	TestSuiteWithDatastore
+	base Repository
+	repo Repository
+}
+
+func TestShadowing(t *testing.T) {
+	suite.Run(t, new(shadowingTestSuite))
+}
+
+func (suite *shadowingTestSuite) SetupTest() {
+	var err error
+	require := suite.Require()
+	suite.TestSuiteWithDatastore.SetupTest()
+	suite.base, err = newRepository(suite.db, "base", nil, suite.storagePath)
+	require.Nil(err, "unable to create the base repository")
+	suite.repo, err = newRepository(suite.db, "test", []string{"base"}, suite.storagePath)
+	require.Nil(err, "unable to create the repository")
+
+	suite.addFiles(suite.base, "Foo_Bar", "foo_bar-1.0.tar.gz", "foo_bar-1.1.tar.gz")
+}
+
+// addFiles adds files to the project of the repository
+func (suite *shadowingTestSuite) addFiles(repo Repository, projectName string, fileNames ...string) Project {
+	require := suite.Require()
+	prj, err := repo.AddProject(projectName)
+	require.Nil(err, "unable to add the project")
+	for _, fileName := range fileNames {
+		require.Nil(prj.AddFile(fileName, bytes.NewReader([]byte(repo.Name()+fileName))), "unable to add the file")
+	}
+	return prj
+}
+
+// requireFiles checks the names of the files of the project
+func (suite *shadowingTestSuite) requireFiles(prj Project, fileNames ...string) []ProjectFile {
+	require := suite.Require()
+	require.NotNil(prj, "the project has not been found")
+	files, err := prj.ProjectFiles()
+	require.Nil(err, "unable to get the project files")
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = file.Name()
+	}
+	require.ElementsMatch(fileNames, names, "the project files differ")
+	return files
+}
+
+func (suite *shadowingTestSuite) TestParsePolicy() {
+	require := suite.Require()
+	policy, err := parseShadowingPolicy("")
+	require.Nil(err, "the default policy has been rejected")
+	require.Equal(PolicyShadow, policy, "the default policy is not shadowing")
+	for _, policy := range []ShadowingPolicy{PolicyShadow, PolicyMerge, PolicyDeny} {
+		parsed, err := parseShadowingPolicy(string(policy))
+		require.Nil(err, "a valid policy has been rejected")
+		require.Equal(policy, parsed, "the policy has not been parsed correctly")
+	}
+	_, err = parseShadowingPolicy("override")
+	require.NotNil(err, "an unknown policy has been accepted")
+
+	cfg := &config{StoragePath: suite.storagePath, Indexes: []indexConfig{{Name: "other", Shadowing: "override"}}}
+	require.NotNil(suite.db.addRepositories(cfg), "an unknown policy in the configuration has been accepted")
+}
+
+func (suite *shadowingTestSuite) TestDefaultPolicy() {
+	suite.Require().Equal(PolicyShadow, suite.repo.ShadowingPolicy(), "the default policy is not shadowing")
+}
+
+func (suite *shadowingTestSuite) TestShadow() {
+	require := suite.Require()
+	prj, err := suite.repo.GetProject("Foo_Bar")
+	require.Nil(err, "unable to get the project")
+	suite.requireFiles(prj, "foo_bar-1.0.tar.gz", "foo_bar-1.1.tar.gz")
+
+	suite.addFiles(suite.repo, "foo-bar", "foo_bar-2.0.tar.gz")
+	prj, err = suite.repo.GetProject("foo-bar")
+	require.Nil(err, "unable to get the project")
+	suite.requireFiles(prj, "foo_bar-2.0.tar.gz")
+
+	projects, err := suite.repo.AllProjects()
+	require.Nil(err, "unable to get all projects")
+	require.Len(projects, 1, "the shadowed project is listed")
+	suite.requireFiles(projects[0], "foo_bar-2.0.tar.gz")
+}
+
+func (suite *shadowingTestSuite) TestMerge() {
+	require := suite.Require()
+	require.Nil(suite.repo.SetShadowingPolicy(PolicyMerge), "unable to set the policy")
+	suite.addFiles(suite.repo, "Foo_Bar", "foo_bar-1.0.tar.gz", "foo_bar-2.0.tar.gz")
+
+	prj, err := suite.repo.GetProject("Foo_Bar")
+	require.Nil(err, "unable to get the project")
+	suite.requireFiles(prj, "foo_bar-1.0.tar.gz", "foo_bar-1.1.tar.gz", "foo_bar-2.0.tar.gz")
+	// The files of the repository take precedence over the files of the bases
+	file, err := prj.GetFile("foo_bar-1.0.tar.gz")
+	require.Nil(err, "unable to get the file")
+	checksum := sha256.Sum256([]byte(suite.repo.Name() + "foo_bar-1.0.tar.gz"))
+	require.Equal(hex.EncodeToString(checksum[:]), file.Checksum(), "the file of the base has been used")
+
+	require.NotNil(prj.AddFile("foo_bar-3.0.tar.gz", bytes.NewReader(nil)), "a merged project has been modified")
+	require.NotNil(prj.Delete(), "a merged project has been deleted")
+
+	projects, err := suite.repo.AllProjects()
+	require.Nil(err, "unable to get all projects")
+	require.Len(projects, 1, "the merged project is listed more than once")
+	suite.requireFiles(projects[0], "foo_bar-1.0.tar.gz", "foo_bar-1.1.tar.gz", "foo_bar-2.0.tar.gz")
+
+	// Projects only defined once are not merged
+	suite.addFiles(suite.repo, "other", "other-1.0.tar.gz")
+	prj, err = suite.repo.GetProject("other")
+	require.Nil(err, "unable to get the project")
+	require.False(prj.IsReadOnly(), "a project of a single repository has been merged")
+	require.Nil(prj.AddFile("other-1.1.tar.gz", bytes.NewReader(nil)), "unable to modify a single project")
+}
+
+func (suite *shadowingTestSuite) TestDeny() {
+	require := suite.Require()
+	// Projects added before denying shadowing are still accessible
+	suite.addFiles(suite.repo, "foo.bar", "foo_bar-2.0.tar.gz")
+	require.Nil(suite.repo.SetShadowingPolicy(PolicyDeny), "unable to set the policy")
+	prj, err := suite.repo.AddProject("foo.bar")
+	require.Nil(err, "an existing project has been denied")
+	suite.requireFiles(prj, "foo_bar-2.0.tar.gz")
+
+	other, err := newRepository(suite.db, "other", []string{"base"}, suite.storagePath)
+	require.Nil(err, "unable to create the repository")
+	require.Nil(other.SetShadowingPolicy(PolicyDeny), "unable to set the policy")
+	for _, projectName := range []string{"Foo_Bar", "foo-bar", "FOO.bar"} {
+		_, err = other.AddProject(projectName)
+		require.Equal(ErrShadowing, err, "a project of the base has been shadowed")
+	}
+	_, err = other.AddProject("unrelated")
+	require.Nil(err, "a project not defined in the bases has been denied")
+
+	// The bases of the bases are asked as well
+	nested, err := newRepository(suite.db, "nested", []string{"other"}, suite.storagePath)
+	require.Nil(err, "unable to create the repository")
+	require.Nil(nested.SetShadowingPolicy(PolicyDeny), "unable to set the policy")
+	_, err = nested.AddProject("Foo__Bar")
+	require.Equal(ErrShadowing, err, "a project of the base of the base has been shadowed")
+}
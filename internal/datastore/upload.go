@@ -0,0 +1,196 @@
+package datastore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/hansingt/GoatCheese/internal/distribution"
+	"github.com/jinzhu/gorm"
+	"hash"
+	"os"
+)
+
+/*
+Upload defines the interface of a file being uploaded into a project.
+
+The content is written to a temporary file of the storage backend while it is hashed.
+The file is only added to the project, if the upload is committed.
+Until then, it can be read to validate the content. The file is linked to the release
+described by the metadata within the same transaction as it is added.
+*/
+type Upload interface {
+	Write(data []byte) (int, error)                // Write appends data to the uploaded file
+	ReadAt(data []byte, offset int64) (int, error) // ReadAt reads the data written so far
+	Size() int64                                   // Size returns the number of bytes written so far
+	Checksum() string                              // Checksum returns the sha256 checksum of the data written so far
+	SetMetadata(metadata distribution.Metadata)    // SetMetadata sets the release metadata the file is linked to on commit
+	Commit() error                                 // Commit atomically moves the file into place and adds it to the project
+	Discard() error                                // Discard removes the temporary file without adding it
+}
+
+// ErrUploadTooLarge is returned, if an upload exceeds the maximum upload size of the repository
+var ErrUploadTooLarge = errors.New("the uploaded file exceeds the maximum upload size")
+
+type upload struct {
+	project  *project
+	fileName string
+	file     *os.File
+	hash     hash.Hash
+	size     int64
+	maxSize  int64
+	metadata *distribution.Metadata
+}
+
+func (p *project) NewUpload(fileName string) (Upload, error) {
+	if p.IsReadOnly() {
+		return nil, fmt.Errorf("project '%s' is a read-only copy of the upstream project", p.Name())
+	}
+	var maxSize int64
+	repo, err := p.loadRepository(p.db.DB)
+	if err != nil {
+		return nil, err
+	} else if repo != nil {
+		maxSize = repo.MaxUploadSize()
+	}
+	file, err := p.db.createTempFile(".upload-*")
+	if err != nil {
+		return nil, err
+	}
+	return &upload{
+		project:  p,
+		fileName: fileName,
+		file:     file,
+		hash:     sha256.New(),
+		maxSize:  maxSize,
+	}, nil
+}
+
+func (u *upload) Write(data []byte) (int, error) {
+	if u.maxSize > 0 && u.size+int64(len(data)) > u.maxSize {
+		return 0, ErrUploadTooLarge
+	}
+	n, err := u.file.Write(data)
+	u.hash.Write(data[:n])
+	u.size += int64(n)
+	return n, err
+}
+
+func (u *upload) ReadAt(data []byte, offset int64) (int, error) {
+	return u.file.ReadAt(data, offset)
+}
+
+func (u *upload) Size() int64 {
+	return u.size
+}
+
+func (u *upload) Checksum() string {
+	return hex.EncodeToString(u.hash.Sum(nil))
+}
+
+func (u *upload) SetMetadata(metadata distribution.Metadata) {
+	u.metadata = &metadata
+}
+
+/*
+linkRelease adds the file to the release described by the metadata of the upload
+and stores its Requires-Python specifier within the transaction.
+*/
+func (u *upload) linkRelease(tx *gorm.DB, file *projectFile) error {
+	if u.metadata == nil {
+		return nil
+	}
+	rel, err := u.project.saveRelease(tx, *u.metadata)
+	if err != nil {
+		return err
+	}
+	err = tx.Model(file).Updates(map[string]interface{}{
+		"ReleaseID":               rel.ID,
+		"RequiresPythonSpecifier": u.metadata.RequiresPython,
+	}).Error
+	if err != nil {
+		return err
+	}
+	file.ReleaseID = rel.ID
+	file.RequiresPythonSpecifier = u.metadata.RequiresPython
+	return nil
+}
+
+func (u *upload) Discard() error {
+	// Closing fails, if the upload has been discarded already
+	_ = u.file.Close()
+	return removeFile(u.file.Name())
+}
+
+/*
+createFile adds a new file to the project. Concurrent uploads of the same file race to create it.
+The upload losing the race gets ErrLocked, as the other upload is still storing its content.
+*/
+func (p *project) createFile(fileName string) (ProjectFile, error) {
+	file, err := newProjectFile(p.db, p.ID, fileName, p.ProjectPath())
+	if err != nil {
+		if existing, getErr := p.GetFile(fileName); getErr == nil && existing != nil {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+func (u *upload) Commit() error {
+	//noinspection GoUnhandledErrorResult
+	defer u.Discard()
+	p := u.project
+	checksum := u.Checksum()
+	if err := syncAndVerify(u.file, checksum); err != nil {
+		return err
+	}
+	file, err := p.GetFile(u.fileName)
+	if err != nil {
+		return err
+	}
+	created := file == nil
+	if !created && file.IsLocked() {
+		return ErrLocked
+	} else if !created {
+		allowOverwrite, err := p.allowsOverwrite()
+		if err != nil {
+			return err
+		} else if !allowOverwrite {
+			// Uploading the identical file again is allowed to retry failed uploads
+			if checksum != file.Checksum() {
+				return ErrFileExists
+			}
+			return p.db.Transaction(func(tx *gorm.DB) error {
+				return u.linkRelease(tx, file.(*projectFile))
+			})
+		}
+	} else {
+		if file, err = p.createFile(u.fileName); err != nil {
+			return err
+		}
+	}
+	// Lock the file while it is replaced
+	if err = file.Lock(); err != nil {
+		if created {
+			_ = file.(*projectFile).remove()
+		}
+		return err
+	}
+	stored := file.(*projectFile)
+	err = stored.setBlob(u.file.Name(), checksum, func(tx *gorm.DB) error {
+		return u.linkRelease(tx, stored)
+	})
+	if err != nil {
+		if created {
+			// We are creating a new file, delete it
+			_ = file.(*projectFile).remove()
+		} else {
+			// The existing file has not been modified, just unlock it
+			_ = file.Unlock()
+		}
+		return err
+	}
+	// Unlock the file again
+	return file.Unlock()
+}
@@ -0,0 +1,168 @@
+package datastore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/hansingt/GoatCheese/internal/distribution"
+	"github.com/stretchr/testify/suite"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type uploadTestSuite struct {
+	TestSuiteWithDatastore
+	projectName string
+	project     Project
+}
+
+func (suite *uploadTestSuite) SetupTest() {
+	var err error
+	suite.TestSuiteWithDatastore.SetupTest()
+	suite.projectName = "test-app"
+	suite.project, err = newProject(suite.db, 0, suite.projectName, suite.storagePath)
+	suite.Require().Nil(err, "unable to create a new project")
+}
+
+func TestUpload(t *testing.T) {
+	suite.Run(t, new(uploadTestSuite))
+}
+
+// temporaryFiles returns the names of all temporary files in the blob store
+func (suite *uploadTestSuite) temporaryFiles() []string {
+	entries, err := ioutil.ReadDir(filepath.Join(suite.storagePath, "tmp"))
+	suite.Require().Nil(err, "unable to list the temporary files")
+	var names []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+func (suite *uploadTestSuite) TestCommit() {
+	require := suite.Require()
+	fileName := "test_app-1.0-py3-none-any.whl"
+	content := make([]byte, 4096)
+	_, err := rand.Read(content)
+	require.Nil(err, "Error creating random file content")
+	expected := sha256.Sum256(content)
+
+	upload, err := suite.project.NewUpload(fileName)
+	require.Nil(err, "unable to start the upload")
+	_, err = io.Copy(upload, bytes.NewReader(content))
+	require.Nil(err, "unable to write the upload")
+	require.Equal(int64(len(content)), upload.Size())
+	require.Equal(hex.EncodeToString(expected[:]), upload.Checksum())
+	read := make([]byte, 16)
+	_, err = upload.ReadAt(read, 100)
+	require.Nil(err, "unable to read the upload")
+	require.Equal(content[100:116], read, "the upload can not be read back")
+
+	file, err := suite.project.GetFile(fileName)
+	require.Nil(err, "unable to get the file")
+	require.Nil(file, "the file has been added before committing the upload")
+
+	require.Nil(upload.Commit(), "unable to commit the upload")
+	file, err = suite.project.GetFile(fileName)
+	require.Nil(err, "unable to get the file")
+	require.NotNil(file, "the file has not been added")
+	require.Equal(upload.Checksum(), file.Checksum())
+	stored, err := readContent(file)
+	require.Nil(err, "unable to read the stored file")
+	require.Equal(content, stored)
+	require.Empty(suite.temporaryFiles(), "temporary files have been left behind")
+}
+
+// commit uploads the content into the project and links it to the release described by the metadata
+func (suite *uploadTestSuite) commit(fileName string, content []byte, metadata distribution.Metadata) error {
+	upload, err := suite.project.NewUpload(fileName)
+	suite.Require().Nil(err, "unable to start the upload")
+	_, err = upload.Write(content)
+	suite.Require().Nil(err, "unable to write the upload")
+	upload.SetMetadata(metadata)
+	return upload.Commit()
+}
+
+func (suite *uploadTestSuite) TestCommitMetadata() {
+	require := suite.Require()
+	fileName := "test_app-1.0-py3-none-any.whl"
+	metadata := distribution.Metadata{Name: "test-app", Version: "1.0", RequiresPython: ">=3.6"}
+	require.NotNil(suite.commit(fileName, []byte("content"), distribution.Metadata{Name: "test-app"}),
+		"a file without a version has been committed")
+	file, err := suite.project.GetFile(fileName)
+	require.Nil(err, "unable to get the file")
+	require.Nil(file, "a file has been added without its release")
+
+	require.Nil(suite.commit(fileName, []byte("content"), metadata), "unable to commit the upload")
+	release, err := suite.project.GetRelease("1.0")
+	require.Nil(err, "unable to get the release")
+	require.NotNil(release, "the release has not been added")
+	files, err := release.ProjectFiles()
+	require.Nil(err, "unable to get the files of the release")
+	require.Len(files, 1, "the file has not been linked to the release")
+	require.Equal(">=3.6", files[0].RequiresPython(), "the Requires-Python specifier has not been set")
+
+	// Retrying the identical upload links the file again
+	require.Nil(suite.db.Model(files[0]).Updates(map[string]interface{}{
+		"ReleaseID":               0,
+		"RequiresPythonSpecifier": "",
+	}).Error, "unable to unlink the file")
+	metadata.Summary = "A test project"
+	require.Nil(suite.commit(fileName, []byte("content"), metadata), "unable to retry the upload")
+	files, err = release.ProjectFiles()
+	require.Nil(err, "unable to get the files of the release")
+	require.Len(files, 1, "the file has not been linked to the release again")
+	require.Equal(">=3.6", files[0].RequiresPython(), "the Requires-Python specifier has not been set again")
+	release, err = suite.project.GetRelease("1.0")
+	require.Nil(err, "unable to get the release")
+	require.Equal("A test project", release.Metadata().Summary, "the metadata have not been completed")
+}
+
+func (suite *uploadTestSuite) TestConcurrentCreate() {
+	require := suite.Require()
+	fileName := "test_app-1.0-py3-none-any.whl"
+	prj := suite.project.(*project)
+	_, err := prj.createFile(fileName)
+	require.Nil(err, "unable to create the file")
+	// Another upload created the file after it has been looked up
+	_, err = prj.createFile(fileName)
+	require.Equal(ErrLocked, err, "losing the race to create the file is not reported as a conflict")
+}
+
+func (suite *uploadTestSuite) TestDiscard() {
+	require := suite.Require()
+	fileName := "test_app-1.0-py3-none-any.whl"
+	upload, err := suite.project.NewUpload(fileName)
+	require.Nil(err, "unable to start the upload")
+	_, err = upload.Write([]byte("content"))
+	require.Nil(err, "unable to write the upload")
+	require.Nil(upload.Discard(), "unable to discard the upload")
+
+	file, err := suite.project.GetFile(fileName)
+	require.Nil(err, "unable to get the file")
+	require.Nil(file, "the discarded file has been added")
+	require.Empty(suite.temporaryFiles(), "temporary files have been left behind")
+}
+
+func (suite *uploadTestSuite) TestMaxUploadSize() {
+	require := suite.Require()
+	repo, err := newRepository(suite.db, "limited", nil, suite.storagePath)
+	require.Nil(err, "unable to create the repository")
+	require.Nil(repo.SetMaxUploadSize(1024), "unable to set the maximum upload size")
+	project, err := repo.AddProject(suite.projectName)
+	require.Nil(err, "unable to create the project")
+
+	fileName := "test_app-1.0-py3-none-any.whl"
+	require.Nil(project.AddFile(fileName, bytes.NewReader(make([]byte, 1024))), "the file has been rejected")
+	require.Equal(ErrUploadTooLarge, project.AddFile("test_app-2.0-py3-none-any.whl", bytes.NewReader(make([]byte, 1025))))
+	file, err := project.GetFile("test_app-2.0-py3-none-any.whl")
+	require.Nil(err, "unable to get the file")
+	require.Nil(file, "the file exceeding the limit has been added")
+	require.Empty(suite.temporaryFiles(), "temporary files have been left behind")
+}
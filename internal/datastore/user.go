@@ -0,0 +1,65 @@
+package datastore
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// TokenUserName is the user name to authenticate with an API token only, as used by twine
+const TokenUserName = "__token__"
+
+// ErrInvalidCredentials is returned, if a user could not be authenticated
+var ErrInvalidCredentials = errors.New("invalid user name, password or token")
+
+/*
+userConfig defines a user who is able to authenticate against the GoatCheese shop.
+
+Passwords are given as bcrypt hashes, API tokens as hex encoded sha256 hashes.
+Plain text secrets are never stored in the configuration.
+*/
+type userConfig struct {
+	Name     string   `yaml:"name"`
+	Password string   `yaml:"password"`
+	Tokens   []string `yaml:"tokens"`
+}
+
+func (u *userConfig) checkPassword(password string) bool {
+	return u.Password != "" && bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) == nil
+}
+
+func (u *userConfig) checkToken(token string) bool {
+	checksum := sha256.Sum256([]byte(token))
+	hash := []byte(hex.EncodeToString(checksum[:]))
+	for _, userToken := range u.Tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(strings.ToLower(userToken))) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Authenticate checks the given credentials and returns the name of the authenticated user.
+
+The secret is either the password or an API token of the user. If the user name is
+TokenUserName, the user is identified by the API token only.
+*/
+func (db *datastore) Authenticate(userName string, secret string) (string, error) {
+	if userName == TokenUserName {
+		for _, user := range db.users {
+			if user.checkToken(secret) {
+				return user.Name, nil
+			}
+		}
+		return "", ErrInvalidCredentials
+	}
+	user, exists := db.users[userName]
+	if !exists || !(user.checkPassword(secret) || user.checkToken(secret)) {
+		return "", ErrInvalidCredentials
+	}
+	return user.Name, nil
+}
@@ -0,0 +1,59 @@
+package datastore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+)
+
+type userTestSuite struct {
+	TestSuiteWithDatastore
+}
+
+func TestUser(t *testing.T) {
+	suite.Run(t, new(userTestSuite))
+}
+
+func (suite *userTestSuite) SetupTest() {
+	suite.TestSuiteWithDatastore.SetupTest()
+	require := suite.Require()
+	password, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.Nil(err, "unable to hash the password")
+	token := sha256.Sum256([]byte("pypi-token"))
+	suite.db.users = map[string]*userConfig{
+		"alice": {Name: "alice", Password: string(password)},
+		"bob":   {Name: "bob", Tokens: []string{hex.EncodeToString(token[:])}},
+	}
+}
+
+func (suite *userTestSuite) TestAuthenticatePassword() {
+	require := suite.Require()
+	user, err := suite.db.Authenticate("alice", "secret")
+	require.Nil(err, "unable to authenticate with the password")
+	require.Equal("alice", user)
+
+	_, err = suite.db.Authenticate("alice", "wrong")
+	require.Equal(ErrInvalidCredentials, err, "authenticated with a wrong password")
+	_, err = suite.db.Authenticate("unknown", "secret")
+	require.Equal(ErrInvalidCredentials, err, "authenticated an unknown user")
+	_, err = suite.db.Authenticate("bob", "")
+	require.Equal(ErrInvalidCredentials, err, "authenticated an user without password")
+}
+
+func (suite *userTestSuite) TestAuthenticateToken() {
+	require := suite.Require()
+	user, err := suite.db.Authenticate(TokenUserName, "pypi-token")
+	require.Nil(err, "unable to authenticate with the token")
+	require.Equal("bob", user)
+
+	user, err = suite.db.Authenticate("bob", "pypi-token")
+	require.Nil(err, "unable to authenticate with the user name and token")
+	require.Equal("bob", user)
+
+	_, err = suite.db.Authenticate(TokenUserName, "wrong-token")
+	require.Equal(ErrInvalidCredentials, err, "authenticated with a wrong token")
+	_, err = suite.db.Authenticate("alice", "pypi-token")
+	require.Equal(ErrInvalidCredentials, err, "authenticated with the token of another user")
+}
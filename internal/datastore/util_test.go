@@ -1,6 +1,7 @@
 package datastore
 
 import (
+	"github.com/hansingt/GoatCheese/internal/storage"
 	"github.com/stretchr/testify/suite"
 	"io/ioutil"
 	"os"
@@ -28,9 +29,33 @@ func (suite *TestSuiteWithDatastore) SetupTest() {
 	// Create a storage path
 	suite.storagePath, err = ioutil.TempDir(os.TempDir(), "")
 	assert.Nil(err)
+	suite.db.storagePath = suite.storagePath
+	suite.db.storage, err = storage.NewLocal(suite.storagePath)
+	assert.Nil(err)
 }
 
 func (suite *TestSuiteWithDatastore) TearDownTest() {
 	suite.Require().Nil(suite.db.Close(), "unable to close the database connection")
 	suite.Require().Nil(os.RemoveAll(suite.storagePath), "unable to remove the storage path")
 }
+
+// refCount returns the number of references to the blob with the given checksum
+func (suite *TestSuiteWithDatastore) refCount(checksum string) int {
+	var blobs []blob
+	suite.Require().Nil(suite.db.Find(&blobs, "checksum = ?", checksum).Error, "unable to find the blob")
+	if len(blobs) == 0 {
+		return 0
+	}
+	return blobs[0].RefCount
+}
+
+// readContent reads the content of a project file from the storage backend
+func readContent(file ProjectFile) ([]byte, error) {
+	object, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer object.Close()
+	return ioutil.ReadAll(object)
+}
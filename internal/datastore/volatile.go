@@ -0,0 +1,49 @@
+package datastore
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+)
+
+// ErrImmutable is returned, if a file of a repository, which is not volatile, would be deleted or replaced
+var ErrImmutable = errors.New("the repository is immutable, its files can not be deleted or replaced")
+
+/*
+checkVolatile returns ErrImmutable, if the repository of this project does not allow deleting files.
+*/
+func (p *project) checkVolatile(tx *gorm.DB) error {
+	repo, err := p.loadRepository(tx)
+	if err != nil {
+		return err
+	} else if repo != nil && !repo.IsVolatile() {
+		return ErrImmutable
+	}
+	return nil
+}
+
+/*
+checkProjectVolatile returns ErrImmutable, if the repository of the project with the given ID
+does not allow deleting files. Files of projects, which do not exist anymore, might be deleted.
+*/
+func (db *datastore) checkProjectVolatile(projectID uint) error {
+	prj := &project{}
+	err := db.First(prj, projectID).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	prj.db = db
+	return prj.checkVolatile(db.DB)
+}
+
+/*
+checkReplaceable returns ErrImmutable, if the file has a content already and its repository does not allow
+replacing files. Files without a content, like the ones fetched from an upstream index, might be written once.
+*/
+func (f *projectFile) checkReplaceable() error {
+	if f.BlobChecksum == "" {
+		return nil
+	}
+	return f.db.checkProjectVolatile(f.ProjectID)
+}
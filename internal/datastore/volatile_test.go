@@ -0,0 +1,128 @@
+package datastore
+
+import (
+	"bytes"
+	"github.com/hansingt/GoatCheese/internal/distribution"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type volatileTestSuite struct {
+	TestSuiteWithDatastore
+	repo    Repository
+	project Project
+	file    ProjectFile
+}
+
+func TestVolatile(t *testing.T) {
+	suite.Run(t, new(volatileTestSuite))
+}
+
+func (suite *volatileTestSuite) SetupTest() {
+	var err error
+	require := suite.Require()
+	suite.TestSuiteWithDatastore.SetupTest()
+	suite.repo, err = newRepository(suite.db, "release", nil, suite.storagePath)
+	require.Nil(err, "unable to create the repository")
+	suite.project, err = suite.repo.AddProject("fuubar")
+	require.Nil(err, "unable to add the project")
+	require.Nil(suite.project.AddFile("fuubar-1.0.tar.gz", bytes.NewReader([]byte("1.0"))), "unable to add the file")
+	suite.file, err = suite.project.GetFile("fuubar-1.0.tar.gz")
+	require.Nil(err, "unable to get the file")
+	require.Nil(suite.repo.SetVolatile(false), "unable to make the repository immutable")
+}
+
+func (suite *volatileTestSuite) TestConfiguration() {
+	require := suite.Require()
+	volatile := false
+	cfg := &config{StoragePath: suite.storagePath, Indexes: []indexConfig{{Name: "scratch"}, {Name: "release", Volatile: &volatile}}}
+	require.Nil(suite.db.addRepositories(cfg), "unable to add the repositories")
+	scratch, err := suite.db.GetRepository("scratch")
+	require.Nil(err, "unable to get the repository")
+	require.True(scratch.IsVolatile(), "repositories are not volatile by default")
+	repo, err := suite.db.GetRepository("release")
+	require.Nil(err, "unable to get the repository")
+	require.False(repo.IsVolatile(), "the repository is volatile")
+
+	cfg.Indexes[1].AllowOverwrite = true
+	require.NotNil(suite.db.addRepositories(cfg), "overwriting files of an immutable repository has been configured")
+}
+
+func (suite *volatileTestSuite) TestAddFile() {
+	require := suite.Require()
+	require.Nil(suite.repo.SetAllowOverwrite(true), "unable to allow overwriting files")
+	require.Nil(suite.project.AddFile("fuubar-1.0.tar.gz", bytes.NewReader([]byte("1.0"))),
+		"uploading the identical file again has been rejected")
+	require.Equal(ErrFileExists, suite.project.AddFile("fuubar-1.0.tar.gz", bytes.NewReader([]byte("other"))),
+		"a file of an immutable repository has been replaced")
+	content, err := readContent(suite.file)
+	require.Nil(err, "unable to read the file")
+	require.Equal("1.0", string(content), "the content has been replaced")
+	require.Nil(suite.project.AddFile("fuubar-1.1.tar.gz", bytes.NewReader([]byte("1.1"))),
+		"a new file has been rejected")
+}
+
+func (suite *volatileTestSuite) TestReplaceContent() {
+	require := suite.Require()
+	require.Equal(ErrImmutable, suite.file.Write(bytes.NewReader([]byte("other"))),
+		"the content of a file of an immutable repository has been replaced")
+	require.Equal(ErrImmutable, suite.file.SetChecksum("other"),
+		"the checksum of a file of an immutable repository has been replaced")
+	file, err := suite.project.GetFile("fuubar-1.0.tar.gz")
+	require.Nil(err, "unable to get the file")
+	require.Equal(suite.file.Checksum(), file.Checksum(), "the checksum has been replaced")
+	content, err := readContent(file)
+	require.Nil(err, "unable to read the file")
+	require.Equal("1.0", string(content), "the content has been replaced")
+
+	// Files without a content get it once
+	missing := &projectFile{db: suite.db, ProjectID: suite.project.(*project).ID, FileName: "fuubar-1.1.tar.gz"}
+	require.Nil(suite.db.Create(missing).Error, "unable to add the file")
+	require.Nil(missing.Write(bytes.NewReader([]byte("1.1"))), "the content of a new file has been rejected")
+	require.Equal(ErrImmutable, missing.Write(bytes.NewReader([]byte("other"))),
+		"the content of a file of an immutable repository has been replaced")
+}
+
+func (suite *volatileTestSuite) TestDelete() {
+	require := suite.Require()
+	release, err := suite.project.AddRelease(distribution.Metadata{Name: "fuubar", Version: "1.0"})
+	require.Nil(err, "unable to add the release")
+	require.Nil(suite.file.SetRelease(release), "unable to set the release")
+
+	require.Equal(ErrImmutable, suite.file.Delete(), "a file of an immutable repository has been deleted")
+	require.Equal(ErrImmutable, release.Delete(), "a release of an immutable repository has been deleted")
+	require.Equal(ErrImmutable, suite.project.Delete(), "a project of an immutable repository has been deleted")
+	file, err := suite.project.GetFile("fuubar-1.0.tar.gz")
+	require.Nil(err, "unable to get the file")
+	require.NotNil(file, "the file has been deleted")
+
+	empty, err := suite.repo.AddProject("empty")
+	require.Nil(err, "unable to add the project")
+	require.Nil(empty.Delete(), "a project without files has not been deleted")
+
+	require.Nil(suite.repo.SetVolatile(true), "unable to make the repository volatile")
+	require.Nil(suite.file.Delete(), "a file of a volatile repository has not been deleted")
+}
+
+func (suite *volatileTestSuite) TestPromote() {
+	require := suite.Require()
+	release, err := suite.project.AddRelease(distribution.Metadata{Name: "fuubar", Version: "1.0"})
+	require.Nil(err, "unable to add the release")
+	require.Nil(suite.file.SetRelease(release), "unable to set the release")
+	target, err := newRepository(suite.db, "target", nil, suite.storagePath)
+	require.Nil(err, "unable to create the repository")
+
+	_, err = suite.repo.Promote("fuubar", "1.0", target, true)
+	require.Equal(ErrImmutable, err, "a release has been moved out of an immutable repository")
+	prj, err := target.GetLocalProject("fuubar")
+	require.Nil(err, "unable to get the project")
+	require.Nil(prj, "the release has been copied before moving it has been rejected")
+	_, err = suite.repo.Promote("fuubar", "1.0", target, false)
+	require.Nil(err, "a release of an immutable repository has not been copied")
+
+	// Releases can be promoted into immutable repositories
+	require.Nil(target.SetVolatile(false), "unable to make the repository immutable")
+	require.Nil(suite.repo.SetVolatile(true), "unable to make the repository volatile")
+	_, err = suite.repo.Promote("fuubar", "1.0", target, true)
+	require.Nil(err, "unable to move the release into the immutable repository")
+}
@@ -0,0 +1,88 @@
+package distribution
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+/*
+isMetadataFile checks whether the path inside an archive is the metadata file
+of a distribution with the given file name.
+*/
+func isMetadataFile(fileName string, filePath string) bool {
+	filePath = strings.TrimPrefix(filePath, "./")
+	directory, name := path.Split(filePath)
+	directory = strings.TrimSuffix(directory, "/")
+	if strings.HasSuffix(fileName, ".whl") {
+		// Wheels contain the metadata in the top-level .dist-info directory
+		return name == "METADATA" && strings.HasSuffix(directory, ".dist-info") && !strings.Contains(directory, "/")
+	} else if strings.HasSuffix(fileName, ".egg") {
+		return filePath == "EGG-INFO/PKG-INFO"
+	}
+	// Source distributions contain the PKG-INFO in the top-level directory
+	return name == "PKG-INFO" && directory != "" && !strings.Contains(directory, "/")
+}
+
+/*
+ReadMetadata reads the metadata of a distribution archive with the given file name.
+Wheels, eggs and zip, tar.gz and tar.bz2 source distributions are supported.
+*/
+func ReadMetadata(fileName string, content io.ReaderAt, size int64) (*Metadata, error) {
+	switch {
+	case strings.HasSuffix(fileName, ".whl"), strings.HasSuffix(fileName, ".egg"), strings.HasSuffix(fileName, ".zip"):
+		return readZipMetadata(fileName, content, size)
+	case strings.HasSuffix(fileName, ".tar.gz"), strings.HasSuffix(fileName, ".tgz"):
+		reader, err := gzip.NewReader(io.NewSectionReader(content, 0, size))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read '%s': %s", fileName, err)
+		}
+		//noinspection GoUnhandledErrorResult
+		defer reader.Close()
+		return readTarMetadata(fileName, reader)
+	case strings.HasSuffix(fileName, ".tar.bz2"):
+		return readTarMetadata(fileName, bzip2.NewReader(io.NewSectionReader(content, 0, size)))
+	default:
+		return nil, fmt.Errorf("unsupported distribution format: '%s'", fileName)
+	}
+}
+
+func readZipMetadata(fileName string, content io.ReaderAt, size int64) (*Metadata, error) {
+	archive, err := zip.NewReader(content, size)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read '%s': %s", fileName, err)
+	}
+	for _, file := range archive.File {
+		if !isMetadataFile(fileName, file.Name) {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		//noinspection GoUnhandledErrorResult
+		defer reader.Close()
+		return ParseMetadata(reader)
+	}
+	return nil, fmt.Errorf("no metadata found in '%s'", fileName)
+}
+
+func readTarMetadata(fileName string, content io.Reader) (*Metadata, error) {
+	archive := tar.NewReader(content)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no metadata found in '%s'", fileName)
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to read '%s': %s", fileName, err)
+		}
+		if header.FileInfo().Mode().IsRegular() && isMetadataFile(fileName, header.Name) {
+			return ParseMetadata(archive)
+		}
+	}
+}
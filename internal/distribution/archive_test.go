@@ -0,0 +1,103 @@
+package distribution
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type archiveTestSuite struct {
+	suite.Suite
+}
+
+func TestArchive(t *testing.T) {
+	suite.Run(t, new(archiveTestSuite))
+}
+
+func zipArchive(files map[string]string) []byte {
+	buffer := &bytes.Buffer{}
+	writer := zip.NewWriter(buffer)
+	for name, content := range files {
+		file, _ := writer.Create(name)
+		_, _ = file.Write([]byte(content))
+	}
+	_ = writer.Close()
+	return buffer.Bytes()
+}
+
+func tarGzArchive(files map[string]string) []byte {
+	buffer := &bytes.Buffer{}
+	compressor := gzip.NewWriter(buffer)
+	writer := tar.NewWriter(compressor)
+	for name, content := range files {
+		_ = writer.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		})
+		_, _ = writer.Write([]byte(content))
+	}
+	_ = writer.Close()
+	_ = compressor.Close()
+	return buffer.Bytes()
+}
+
+func (suite *archiveTestSuite) readMetadata(fileName string, content []byte) (*Metadata, error) {
+	return ReadMetadata(fileName, bytes.NewReader(content), int64(len(content)))
+}
+
+func (suite *archiveTestSuite) TestWheel() {
+	require := suite.Require()
+	metadata, err := suite.readMetadata("Fuu.Bar-1.0-py3-none-any.whl", zipArchive(map[string]string{
+		"fuu/__init__.py":                   "",
+		"fuu/other.dist-info/METADATA":      "invalid",
+		"Fuu.Bar-1.0.dist-info/METADATA":    testMetadata,
+		"Fuu.Bar-1.0.dist-info/RECORD":      "",
+		"Fuu.Bar-1.0.data/scripts/METADATA": "invalid",
+	}))
+	require.Nil(err, "unable to read the metadata")
+	require.Equal("Fuu.Bar", metadata.Name)
+	require.Equal("1.0", metadata.Version)
+}
+
+func (suite *archiveTestSuite) TestZipSdist() {
+	metadata, err := suite.readMetadata("Fuu.Bar-1.0.zip", zipArchive(map[string]string{
+		"Fuu.Bar-1.0/PKG-INFO": testMetadata,
+	}))
+	suite.Require().Nil(err, "unable to read the metadata")
+	suite.Require().Equal("1.0", metadata.Version)
+}
+
+func (suite *archiveTestSuite) TestTarGzSdist() {
+	metadata, err := suite.readMetadata("Fuu.Bar-1.0.tar.gz", tarGzArchive(map[string]string{
+		"Fuu.Bar-1.0/setup.py":                      "",
+		"Fuu.Bar-1.0/src/Fuu.Bar.egg-info/PKG-INFO": "invalid",
+		"Fuu.Bar-1.0/PKG-INFO":                      testMetadata,
+	}))
+	suite.Require().Nil(err, "unable to read the metadata")
+	suite.Require().Equal("1.0", metadata.Version)
+}
+
+func (suite *archiveTestSuite) TestMissingMetadata() {
+	_, err := suite.readMetadata("Fuu.Bar-1.0.tar.gz", tarGzArchive(map[string]string{
+		"Fuu.Bar-1.0/setup.py": "",
+	}))
+	suite.Require().NotNil(err, "no error for a missing PKG-INFO")
+	_, err = suite.readMetadata("Fuu.Bar-1.0-py3-none-any.whl", zipArchive(map[string]string{
+		"fuu/__init__.py": "",
+	}))
+	suite.Require().NotNil(err, "no error for a missing METADATA")
+}
+
+func (suite *archiveTestSuite) TestInvalidArchive() {
+	_, err := suite.readMetadata("Fuu.Bar-1.0-py3-none-any.whl", []byte("no zip file"))
+	suite.Require().NotNil(err, "no error for an invalid wheel")
+	_, err = suite.readMetadata("Fuu.Bar-1.0.tar.gz", []byte("no tar file"))
+	suite.Require().NotNil(err, "no error for an invalid sdist")
+	_, err = suite.readMetadata("Fuu.Bar-1.0.exe", []byte(""))
+	suite.Require().NotNil(err, "no error for an unsupported format")
+}
@@ -0,0 +1,79 @@
+package distribution
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Kind defines the kind of a distribution file
+type Kind string
+
+const (
+	// Wheel is a built distribution as defined in PEP 427
+	Wheel Kind = "bdist_wheel"
+	// Sdist is a source distribution
+	Sdist Kind = "sdist"
+)
+
+var (
+	wheelRegExp = regexp.MustCompile(
+		`^([A-Za-z0-9](?:[A-Za-z0-9._]*[A-Za-z0-9])?)-([^-]+)(?:-(\d[^-]*))?-([^-]+)-([^-]+)-([^-]+)\.whl$`)
+	sdistRegExp = regexp.MustCompile(
+		`^([A-Za-z0-9](?:[A-Za-z0-9._-]*[A-Za-z0-9])?)-([0-9][^-]*)\.(?:tar\.gz|zip|tar\.bz2)$`)
+)
+
+/*
+FileName contains the information encoded in the file name of a distribution.
+*/
+type FileName struct {
+	Kind    Kind   // Kind is the kind of the distribution
+	Name    string // Name is the project name as given in the file name
+	Version string // Version is the version as given in the file name
+	// Tags contains the build tag (might be empty), the python, abi and platform tags of wheels.
+	// It is empty for source distributions.
+	Tags []string
+}
+
+/*
+ParseFileName parses the file name of a wheel (PEP 427) or source distribution.
+*/
+func ParseFileName(fileName string) (*FileName, error) {
+	if match := wheelRegExp.FindStringSubmatch(fileName); match != nil {
+		return &FileName{
+			Kind:    Wheel,
+			Name:    match[1],
+			Version: match[2],
+			Tags:    match[3:],
+		}, nil
+	} else if match := sdistRegExp.FindStringSubmatch(fileName); match != nil {
+		return &FileName{
+			Kind:    Sdist,
+			Name:    match[1],
+			Version: match[2],
+		}, nil
+	}
+	if strings.HasSuffix(fileName, ".whl") {
+		return nil, fmt.Errorf("'%s' is not a valid wheel file name", fileName)
+	}
+	return nil, fmt.Errorf("'%s' is neither a valid wheel nor source distribution file name", fileName)
+}
+
+/*
+Matches checks whether the file name belongs to the project with the given name.
+Names are compared after normalizing them as defined in PEP 503.
+*/
+func (f *FileName) Matches(projectName string) bool {
+	return NormalizeName(f.Name) == NormalizeName(projectName)
+}
+
+/*
+MatchesVersion checks whether the file name contains the given version.
+Dashes are compared equal to underscores, because wheels escape them in the file name.
+*/
+func (f *FileName) MatchesVersion(version string) bool {
+	escape := func(version string) string {
+		return strings.ToLower(strings.Replace(version, "-", "_", -1))
+	}
+	return escape(f.Version) == escape(version)
+}
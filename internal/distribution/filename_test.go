@@ -0,0 +1,68 @@
+package distribution
+
+import (
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type fileNameTestSuite struct {
+	suite.Suite
+}
+
+func TestFileName(t *testing.T) {
+	suite.Run(t, new(fileNameTestSuite))
+}
+
+func (suite *fileNameTestSuite) TestWheel() {
+	require := suite.Require()
+	fileName, err := ParseFileName("Fuu_Bar-1.0.post1-py2.py3-none-any.whl")
+	require.Nil(err, "unable to parse the file name")
+	require.Equal(&FileName{
+		Kind:    Wheel,
+		Name:    "Fuu_Bar",
+		Version: "1.0.post1",
+		Tags:    []string{"", "py2.py3", "none", "any"},
+	}, fileName)
+	require.True(fileName.Matches("fuu-bar"))
+	require.False(fileName.Matches("fuu"))
+	require.True(fileName.MatchesVersion("1.0.post1"))
+	require.False(fileName.MatchesVersion("1.0"))
+
+	fileName, err = ParseFileName("fuubar-1.0_rc1-py3-none-any.whl")
+	require.Nil(err, "unable to parse the file name")
+	require.True(fileName.MatchesVersion("1.0-rc1"), "the escaped version does not match")
+
+	fileName, err = ParseFileName("numpy-1.19.0-1-cp38-cp38-manylinux2010_x86_64.whl")
+	require.Nil(err, "unable to parse the file name")
+	require.Equal([]string{"1", "cp38", "cp38", "manylinux2010_x86_64"}, fileName.Tags)
+}
+
+func (suite *fileNameTestSuite) TestSdist() {
+	require := suite.Require()
+	for fileName, expected := range map[string]FileName{
+		"fuu_bar-1.0.tar.gz":       {Kind: Sdist, Name: "fuu_bar", Version: "1.0"},
+		"zope.interface-4.7.1.zip": {Kind: Sdist, Name: "zope.interface", Version: "4.7.1"},
+		"Fuu-Bar-2.0rc1.tar.bz2":   {Kind: Sdist, Name: "Fuu-Bar", Version: "2.0rc1"},
+		"backports-abc-0.5.tar.gz": {Kind: Sdist, Name: "backports-abc", Version: "0.5"},
+		"fuubar-1.0.0.dev1.tar.gz": {Kind: Sdist, Name: "fuubar", Version: "1.0.0.dev1"},
+	} {
+		parsed, err := ParseFileName(fileName)
+		require.Nil(err, "unable to parse '%s'", fileName)
+		require.Equal(expected, *parsed, "'%s' has not been parsed correctly", fileName)
+	}
+}
+
+func (suite *fileNameTestSuite) TestInvalid() {
+	for _, fileName := range []string{
+		"fuubar.whl",
+		"fuubar-1.0-py3-none.whl",
+		"fuubar-1.0.exe",
+		"fuubar-1.0-py2.7.egg",
+		"fuubar.tar.gz",
+		"fuubar-latest.tar.gz",
+		"-1.0.tar.gz",
+	} {
+		_, err := ParseFileName(fileName)
+		suite.Require().NotNil(err, "'%s' has been parsed", fileName)
+	}
+}
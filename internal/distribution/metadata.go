@@ -0,0 +1,138 @@
+/*
+Package distribution implements reading the metadata of python distribution files,
+i.e. wheels and source distributions.
+*/
+package distribution
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var nameRegExp = regexp.MustCompile("[-_.]+")
+
+/*
+NormalizeName normalizes a project name as defined in PEP 503.
+*/
+func NormalizeName(name string) string {
+	return strings.ToLower(nameRegExp.ReplaceAllString(name, "-"))
+}
+
+/*
+Metadata contains the core metadata of a distribution as defined by the
+python packaging core metadata specification.
+*/
+type Metadata struct {
+	Name           string
+	Version        string
+	Summary        string
+	RequiresPython string
+	RequiresDist   []string
+	Author         string
+	AuthorEmail    string
+	License        string
+	Classifiers    []string
+}
+
+/*
+ParseMetadata parses the contents of a METADATA or PKG-INFO file.
+Only the headers are parsed, the description in the message body is ignored.
+*/
+func ParseMetadata(content io.Reader) (*Metadata, error) {
+	headers := make(map[string][]string)
+	var key string
+	scanner := bufio.NewScanner(content)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			// The headers end with the first empty line
+			break
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			// continuation of the previous header
+			if key != "" {
+				values := headers[key]
+				values[len(values)-1] += "\n" + strings.TrimSpace(line)
+			}
+			continue
+		}
+		separator := strings.Index(line, ":")
+		if separator < 0 {
+			return nil, fmt.Errorf("invalid metadata line: '%s'", line)
+		}
+		key = strings.ToLower(strings.TrimSpace(line[:separator]))
+		headers[key] = append(headers[key], strings.TrimSpace(line[separator+1:]))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	first := func(key string) string {
+		if values := headers[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	metadata := &Metadata{
+		Name:           first("name"),
+		Version:        first("version"),
+		Summary:        first("summary"),
+		RequiresPython: first("requires-python"),
+		RequiresDist:   headers["requires-dist"],
+		Author:         first("author"),
+		AuthorEmail:    first("author-email"),
+		License:        first("license"),
+		Classifiers:    headers["classifier"],
+	}
+	if metadata.Name == "" || metadata.Version == "" {
+		return nil, fmt.Errorf("the metadata does not contain a name and version")
+	}
+	return metadata, nil
+}
+
+/*
+Verify checks that the given metadata describes the same distribution.
+Fields not set in either of the metadata are not compared.
+*/
+func (m *Metadata) Verify(other *Metadata) error {
+	if m.Name != "" && other.Name != "" && NormalizeName(m.Name) != NormalizeName(other.Name) {
+		return fmt.Errorf("the names '%s' and '%s' do not match", m.Name, other.Name)
+	}
+	if m.Version != "" && other.Version != "" && m.Version != other.Version {
+		return fmt.Errorf("the versions '%s' and '%s' do not match", m.Version, other.Version)
+	}
+	if m.RequiresPython != "" && other.RequiresPython != "" && m.RequiresPython != other.RequiresPython {
+		return fmt.Errorf(
+			"the Requires-Python specifiers '%s' and '%s' do not match",
+			m.RequiresPython, other.RequiresPython)
+	}
+	return nil
+}
+
+/*
+Merge fills all fields not set in this metadata from the other one.
+*/
+func (m *Metadata) Merge(other *Metadata) {
+	mergeString := func(value *string, otherValue string) {
+		if *value == "" {
+			*value = otherValue
+		}
+	}
+	mergeString(&m.Name, other.Name)
+	mergeString(&m.Version, other.Version)
+	mergeString(&m.Summary, other.Summary)
+	mergeString(&m.RequiresPython, other.RequiresPython)
+	mergeString(&m.Author, other.Author)
+	mergeString(&m.AuthorEmail, other.AuthorEmail)
+	mergeString(&m.License, other.License)
+	if len(m.RequiresDist) == 0 {
+		m.RequiresDist = other.RequiresDist
+	}
+	if len(m.Classifiers) == 0 {
+		m.Classifiers = other.Classifiers
+	}
+}
@@ -0,0 +1,88 @@
+package distribution
+
+import (
+	"github.com/stretchr/testify/suite"
+	"strings"
+	"testing"
+)
+
+type metadataTestSuite struct {
+	suite.Suite
+}
+
+func TestMetadata(t *testing.T) {
+	suite.Run(t, new(metadataTestSuite))
+}
+
+const testMetadata = `Metadata-Version: 2.1
+Name: Fuu.Bar
+Version: 1.0
+Summary: A test project
+Author: Alice
+Author-email: alice@example.com
+License: MIT License
+        with a second line
+Requires-Python: >=3.6
+Requires-Dist: requests (>=2.0)
+Requires-Dist: six
+Classifier: Programming Language :: Python :: 3
+Classifier: License :: OSI Approved :: MIT License
+
+Description: This is no header
+`
+
+func (suite *metadataTestSuite) TestNormalizeName() {
+	suite.Require().Equal("fuu-bar", NormalizeName("Fuu._-Bar"))
+}
+
+func (suite *metadataTestSuite) TestParseMetadata() {
+	require := suite.Require()
+	metadata, err := ParseMetadata(strings.NewReader(testMetadata))
+	require.Nil(err, "unable to parse the metadata")
+	require.Equal(&Metadata{
+		Name:           "Fuu.Bar",
+		Version:        "1.0",
+		Summary:        "A test project",
+		RequiresPython: ">=3.6",
+		RequiresDist:   []string{"requests (>=2.0)", "six"},
+		Author:         "Alice",
+		AuthorEmail:    "alice@example.com",
+		License:        "MIT License\nwith a second line",
+		Classifiers:    []string{"Programming Language :: Python :: 3", "License :: OSI Approved :: MIT License"},
+	}, metadata)
+}
+
+func (suite *metadataTestSuite) TestParseInvalidMetadata() {
+	_, err := ParseMetadata(strings.NewReader("Name: fuubar\n"))
+	suite.Require().NotNil(err, "metadata without a version has been parsed")
+	_, err = ParseMetadata(strings.NewReader("Name: fuubar\nVersion: 1.0\ninvalid line\n"))
+	suite.Require().NotNil(err, "invalid metadata has been parsed")
+}
+
+func (suite *metadataTestSuite) TestVerify() {
+	require := suite.Require()
+	metadata := &Metadata{Name: "Fuu.Bar", Version: "1.0", RequiresPython: ">=3.6"}
+	require.Nil(metadata.Verify(&Metadata{Name: "fuu-bar", Version: "1.0"}))
+	require.Nil(metadata.Verify(&Metadata{}))
+	require.NotNil(metadata.Verify(&Metadata{Name: "asdf"}), "different names have been accepted")
+	require.NotNil(metadata.Verify(&Metadata{Version: "1.1"}), "different versions have been accepted")
+	require.NotNil(metadata.Verify(&Metadata{RequiresPython: ">=3.7"}), "different specifiers have been accepted")
+}
+
+func (suite *metadataTestSuite) TestMerge() {
+	metadata := &Metadata{Name: "fuubar", Summary: "Summary"}
+	metadata.Merge(&Metadata{
+		Name:        "other",
+		Version:     "1.0",
+		Summary:     "Other",
+		License:     "MIT",
+		Classifiers: []string{"classifier"},
+	})
+	suite.Require().Equal(&Metadata{
+		Name:        "fuubar",
+		Version:     "1.0",
+		Summary:     "Summary",
+		License:     "MIT",
+		Classifiers: []string{"classifier"},
+	}, metadata)
+}
@@ -0,0 +1,306 @@
+package mirror
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"github.com/hansingt/GoatCheese/internal/datastore"
+	"github.com/hansingt/GoatCheese/internal/distribution"
+	"github.com/hansingt/GoatCheese/internal/simple"
+	"github.com/hansingt/GoatCheese/internal/storage"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// manifestName is the name of the manifest in a bundle. It is always the first entry.
+const manifestName = "manifest.json"
+
+/*
+Manifest lists the projects and files contained in a bundle.
+*/
+type Manifest struct {
+	Repository string            `json:"repository"` // Repository is the name of the exported repository
+	Created    time.Time         `json:"created"`    // Created is the time the bundle has been exported
+	Projects   []ManifestProject `json:"projects"`   // Projects are the exported projects
+}
+
+/*
+ManifestProject lists the files of a project contained in a bundle.
+*/
+type ManifestProject struct {
+	Name  string         `json:"name"`
+	Files []ManifestFile `json:"files"`
+}
+
+/*
+ManifestFile describes a file contained in a bundle.
+*/
+type ManifestFile struct {
+	Name           string `json:"name"`                      // Name is the file name
+	Path           string `json:"path"`                      // Path is the name of the entry in the bundle
+	SHA256         string `json:"sha256"`                    // SHA256 is the hex encoded sha256 checksum of the file
+	RequiresPython string `json:"requires-python,omitempty"` // RequiresPython is the Requires-Python specifier of the file
+	Yanked         bool   `json:"yanked,omitempty"`          // Yanked is true, if the file has been yanked
+	YankedReason   string `json:"yanked-reason,omitempty"`   // YankedReason is the reason given for yanking the file
+}
+
+/*
+Export writes the projects with the given names stored in the repository into a tar bundle.
+Without project names, all projects stored in the repository itself are exported,
+except the cached copies of upstream projects.
+*/
+func Export(output io.Writer, repo datastore.Repository, projectNames []string) (*Manifest, error) {
+	var projects []datastore.Project
+	if len(projectNames) == 0 {
+		all, err := repo.Projects()
+		if err != nil {
+			return nil, err
+		}
+		for _, prj := range all {
+			if !prj.IsReadOnly() {
+				projects = append(projects, prj)
+			}
+		}
+	}
+	for _, projectName := range projectNames {
+		prj, err := repo.GetLocalProject(projectName)
+		if err == nil && prj == nil {
+			prj, err = repo.GetLocalProject(distribution.NormalizeName(projectName))
+		}
+		if err != nil {
+			return nil, err
+		} else if prj == nil {
+			return nil, fmt.Errorf("project '%s' not found in '%s'", projectName, repo.Name())
+		}
+		projects = append(projects, prj)
+	}
+
+	// The manifest is written first, so that bundles can be verified while they are streamed
+	manifest := &Manifest{Repository: repo.Name(), Created: time.Now().UTC()}
+	var files []datastore.ProjectFile
+	for _, prj := range projects {
+		projectFiles, err := prj.ProjectFiles()
+		if err != nil {
+			return nil, err
+		}
+		entry := ManifestProject{Name: prj.Name()}
+		for _, file := range projectFiles {
+			// Files of upstream projects might not have been downloaded yet
+			if err = file.Fetch(); err != nil {
+				return nil, err
+			}
+			entry.Files = append(entry.Files, ManifestFile{
+				Name:           file.Name(),
+				Path:           path.Join("files", prj.Name(), file.Name()),
+				SHA256:         file.Checksum(),
+				RequiresPython: file.RequiresPython(),
+				Yanked:         file.IsYanked(),
+				YankedReason:   file.YankedReason(),
+			})
+			files = append(files, file)
+		}
+		manifest.Projects = append(manifest.Projects, entry)
+	}
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	writer := tar.NewWriter(output)
+	err = writer.WriteHeader(&tar.Header{
+		Name:    manifestName,
+		Mode:    0640,
+		Size:    int64(len(content)),
+		ModTime: manifest.Created,
+	})
+	if err != nil {
+		return nil, err
+	} else if _, err = writer.Write(content); err != nil {
+		return nil, err
+	}
+
+	i := 0
+	for _, entry := range manifest.Projects {
+		for _, fileEntry := range entry.Files {
+			if err = writeFile(writer, fileEntry.Path, files[i]); err != nil {
+				return nil, err
+			}
+			i++
+		}
+	}
+	return manifest, writer.Close()
+}
+
+/*
+writeFile writes the content of the project file into the bundle.
+*/
+func writeFile(writer *tar.Writer, entryPath string, file datastore.ProjectFile) error {
+	object, err := file.Open()
+	if err != nil {
+		return err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer object.Close()
+	return writeObject(writer, entryPath, object)
+}
+
+/*
+writeObject writes the content of a stored object into the bundle.
+Entries of tar files start with their size, thus objects of unknown size are
+copied into a temporary file first to count their bytes.
+*/
+func writeObject(writer *tar.Writer, entryPath string, object storage.Object) error {
+	var content io.Reader = object
+	size := object.Size()
+	if size < 0 {
+		buffer, err := ioutil.TempFile("", "goatcheese-bundle-")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = buffer.Close()
+			_ = os.Remove(buffer.Name())
+		}()
+		if size, err = io.Copy(buffer, object); err != nil {
+			return err
+		} else if _, err = buffer.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		content = buffer
+	}
+	err := writer.WriteHeader(&tar.Header{
+		Name:    entryPath,
+		Mode:    0640,
+		Size:    size,
+		ModTime: object.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, content)
+	return err
+}
+
+/*
+Import adds the files of a tar bundle to the repository.
+Each file is verified against the checksum listed in the manifest. Files already
+present with the same checksum are skipped, files present with a different checksum
+are not replaced, but counted as failures like files missing in the bundle.
+*/
+func Import(input io.Reader, repo datastore.Repository) (Result, error) {
+	var result Result
+	reader := tar.NewReader(input)
+	header, err := reader.Next()
+	if err != nil {
+		return result, fmt.Errorf("unable to read the manifest: %s", err)
+	} else if header.Name != manifestName {
+		return result, fmt.Errorf("the bundle does not start with the manifest, but '%s'", header.Name)
+	}
+	var manifest Manifest
+	if err = json.NewDecoder(reader).Decode(&manifest); err != nil {
+		return result, fmt.Errorf("unable to read the manifest: %s", err)
+	}
+	type bundleFile struct {
+		project string
+		file    ManifestFile
+	}
+	pending := make(map[string]bundleFile)
+	for _, entry := range manifest.Projects {
+		for _, file := range entry.Files {
+			pending[file.Path] = bundleFile{project: entry.Name, file: file}
+		}
+	}
+
+	for {
+		header, err = reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return result, err
+		}
+		entry, listed := pending[header.Name]
+		if !listed {
+			log.Printf("skipping '%s', it is not listed in the manifest", header.Name)
+			continue
+		}
+		delete(pending, header.Name)
+		skipped, err := importFile(repo, entry.project, entry.file, reader)
+		if err != nil {
+			log.Printf("unable to import '%s': %s", entry.file.Name, err)
+			result.Failed++
+		} else if skipped {
+			result.Skipped++
+		} else {
+			log.Printf("imported '%s'", entry.file.Name)
+			result.Added++
+		}
+	}
+	for entryPath := range pending {
+		log.Printf("the file '%s' listed in the manifest is missing", entryPath)
+		result.Failed++
+	}
+	return result, nil
+}
+
+/*
+verifyFileName checks that the file name listed in the manifest is the name of a
+wheel or source distribution of the project. Like for uploads, it must not contain a path.
+*/
+func verifyFileName(projectName string, fileName string) error {
+	if strings.ContainsAny(fileName, `/\`) || strings.Contains(fileName, "..") {
+		return fmt.Errorf("invalid file name '%s'", fileName)
+	}
+	parsed, err := distribution.ParseFileName(fileName)
+	if err != nil {
+		return err
+	} else if !parsed.Matches(projectName) {
+		return fmt.Errorf("the file name '%s' does not belong to the project '%s'", fileName, projectName)
+	}
+	return nil
+}
+
+/*
+importFile adds a single file of the bundle to the project.
+It returns true, if the file already exists with the same checksum.
+*/
+func importFile(repo datastore.Repository, projectName string, file ManifestFile, content io.Reader) (bool, error) {
+	if file.SHA256 == "" {
+		return false, fmt.Errorf("no checksum listed in the manifest")
+	} else if err := verifyFileName(projectName, file.Name); err != nil {
+		return false, err
+	}
+	prj, err := repo.AddProject(projectName)
+	if err != nil {
+		return false, err
+	} else if prj.IsReadOnly() {
+		return false, fmt.Errorf("the project '%s' is a read-only copy of the upstream project", projectName)
+	}
+	existing, err := prj.GetFile(file.Name)
+	if err != nil {
+		return false, err
+	} else if existing != nil {
+		if strings.EqualFold(existing.Checksum(), file.SHA256) {
+			return true, nil
+		}
+		return false, fmt.Errorf("a file with different content exists already")
+	}
+	upload, err := prj.NewUpload(file.Name)
+	if err != nil {
+		return false, err
+	}
+	if _, err = io.Copy(upload, content); err != nil {
+		_ = upload.Discard()
+		return false, err
+	}
+	return false, commitFile(prj, upload, simple.File{
+		Name:           file.Name,
+		SHA256:         file.SHA256,
+		RequiresPython: file.RequiresPython,
+		Yanked:         file.Yanked,
+		YankedReason:   file.YankedReason,
+	})
+}
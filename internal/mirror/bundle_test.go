@@ -0,0 +1,190 @@
+package mirror
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/hansingt/GoatCheese/internal/datastore"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// target returns the repository bundles are imported into
+func (suite *mirrorTestSuite) target() datastore.Repository {
+	repo, err := suite.db.GetRepository("target")
+	suite.Require().Nil(err, "unable to get the target repository")
+	return repo
+}
+
+// export exports the mirrored project into a bundle
+func (suite *mirrorTestSuite) export() *bytes.Buffer {
+	require := suite.Require()
+	require.Equal(Result{Added: 2}, suite.mirror.Sync([]Requirement{{Name: "fuu"}}))
+	file, err := suite.project().GetFile("fuu-1.0-py3-none-any.whl")
+	require.Nil(err, "unable to get the file")
+	require.Nil(file.Yank("broken"), "unable to yank the file")
+
+	bundle := &bytes.Buffer{}
+	manifest, err := Export(bundle, suite.mirror.Repository, nil)
+	require.Nil(err, "unable to export the repository")
+	require.Len(manifest.Projects, 1, "the project has not been exported")
+	require.Len(manifest.Projects[0].Files, 2, "the files have not been exported")
+	return bundle
+}
+
+// bundle writes a bundle containing the manifest followed by the entries
+func (suite *mirrorTestSuite) bundle(manifest Manifest, entries map[string][]byte) *bytes.Buffer {
+	require := suite.Require()
+	content, err := json.Marshal(manifest)
+	require.Nil(err, "unable to write the manifest")
+	bundle := &bytes.Buffer{}
+	writer := tar.NewWriter(bundle)
+	// The manifest has to be the first entry
+	require.Nil(writer.WriteHeader(&tar.Header{Name: manifestName, Mode: 0640, Size: int64(len(content))}))
+	_, err = writer.Write(content)
+	require.Nil(err, "unable to write the bundle")
+	for name, data := range entries {
+		require.Nil(writer.WriteHeader(&tar.Header{Name: name, Mode: 0640, Size: int64(len(data))}))
+		_, err = writer.Write(data)
+		require.Nil(err, "unable to write the bundle")
+	}
+	require.Nil(writer.Close(), "unable to close the bundle")
+	return bundle
+}
+
+// unsizedObject is a stored object of unknown size
+type unsizedObject struct {
+	io.Reader
+}
+
+func (o *unsizedObject) Close() error {
+	return nil
+}
+
+func (o *unsizedObject) Size() int64 {
+	return -1
+}
+
+func (o *unsizedObject) ModTime() time.Time {
+	return time.Time{}
+}
+
+func (suite *mirrorTestSuite) TestExportImport() {
+	require := suite.Require()
+	bundle := suite.export()
+	result, err := Import(bytes.NewReader(bundle.Bytes()), suite.target())
+	require.Nil(err, "unable to import the bundle")
+	require.Equal(Result{Added: 2}, result, "the files have not been imported")
+
+	project, err := suite.target().GetProject("fuu")
+	require.Nil(err, "unable to get the imported project")
+	require.NotNil(project, "the project has not been imported")
+	file, err := project.GetFile("fuu-1.0-py3-none-any.whl")
+	require.Nil(err, "unable to get the imported file")
+	require.Equal(suite.checksums[file.Name()], file.Checksum(), "the checksum differs")
+	require.True(file.IsYanked(), "the yanked state has not been imported")
+	require.Equal("broken", file.YankedReason())
+	release, err := file.Release()
+	require.Nil(err, "unable to get the release")
+	require.NotNil(release, "the release has not been added")
+	require.Equal("1.0", release.Version())
+
+	// Importing again skips the existing files
+	result, err = Import(bytes.NewReader(bundle.Bytes()), suite.target())
+	require.Nil(err, "unable to import the bundle again")
+	require.Equal(Result{Skipped: 2}, result, "existing files have not been skipped")
+}
+
+func (suite *mirrorTestSuite) TestExportProjects() {
+	require := suite.Require()
+	_, err := Export(&bytes.Buffer{}, suite.mirror.Repository, []string{"unknown"})
+	require.NotNil(err, "an unknown project has been exported")
+	suite.mirror.Sync([]Requirement{{Name: "fuu"}})
+	manifest, err := Export(&bytes.Buffer{}, suite.mirror.Repository, []string{"Fuu"})
+	require.Nil(err, "unable to export the project")
+	require.Equal("fuu", manifest.Projects[0].Name)
+}
+
+func (suite *mirrorTestSuite) TestImportVerifiesChecksums() {
+	require := suite.Require()
+	manifest := Manifest{Repository: "mirror", Projects: []ManifestProject{{
+		Name: "fuu",
+		Files: []ManifestFile{
+			{Name: "fuu-1.0-py3-none-any.whl", Path: "files/fuu/fuu-1.0-py3-none-any.whl",
+				SHA256: suite.checksums["fuu-2.0-py3-none-any.whl"]},
+			{Name: "fuu-2.0-py3-none-any.whl", Path: "files/fuu/fuu-2.0-py3-none-any.whl",
+				SHA256: suite.checksums["fuu-2.0-py3-none-any.whl"]},
+		},
+	}}}
+	bundle := suite.bundle(manifest, map[string][]byte{
+		"files/fuu/fuu-1.0-py3-none-any.whl": suite.files["fuu-1.0-py3-none-any.whl"],
+	})
+	result, err := Import(bundle, suite.target())
+	require.Nil(err, "unable to import the bundle")
+	require.Equal(Result{Failed: 2}, result, "neither the corrupted nor the missing file has been reported")
+	project, err := suite.target().GetProject("fuu")
+	require.Nil(err, "unable to get the project")
+	files, err := project.ProjectFiles()
+	require.Nil(err, "unable to get the project files")
+	require.Empty(files, "a corrupted file has been imported")
+}
+
+func (suite *mirrorTestSuite) TestImportInvalidFileNames() {
+	require := suite.Require()
+	content := suite.files["fuu-1.0-py3-none-any.whl"]
+	checksum := suite.checksums["fuu-1.0-py3-none-any.whl"]
+	manifest := Manifest{Repository: "mirror", Projects: []ManifestProject{{Name: "fuu"}}}
+	entries := make(map[string][]byte)
+	for i, fileName := range []string{
+		"../fuu-1.0-py3-none-any.whl",
+		"sub/fuu-1.0-py3-none-any.whl",
+		`sub\fuu-1.0-py3-none-any.whl`,
+		"fuu-1.0..tar.gz",
+		"fuu.exe",
+		"bar-1.0-py3-none-any.whl",
+	} {
+		entryPath := fmt.Sprintf("files/fuu/%d", i)
+		manifest.Projects[0].Files = append(manifest.Projects[0].Files,
+			ManifestFile{Name: fileName, Path: entryPath, SHA256: checksum})
+		entries[entryPath] = content
+	}
+	result, err := Import(suite.bundle(manifest, entries), suite.target())
+	require.Nil(err, "unable to import the bundle")
+	require.Equal(Result{Failed: len(entries)}, result, "invalid file names have been imported")
+	project, err := suite.target().GetProject("fuu")
+	require.Nil(err, "unable to get the project")
+	if project != nil {
+		files, err := project.ProjectFiles()
+		require.Nil(err, "unable to get the project files")
+		require.Empty(files, "a file with an invalid name has been imported")
+	}
+}
+
+func (suite *mirrorTestSuite) TestWriteUnsizedObject() {
+	require := suite.Require()
+	bundle := &bytes.Buffer{}
+	writer := tar.NewWriter(bundle)
+	content := []byte("content of unknown size")
+	require.Nil(writeObject(writer, "files/fuu/fuu-1.0.tar.gz", &unsizedObject{bytes.NewReader(content)}),
+		"unable to write an object of unknown size")
+	require.Nil(writer.Close(), "unable to close the bundle")
+
+	reader := tar.NewReader(bundle)
+	header, err := reader.Next()
+	require.Nil(err, "unable to read the bundle")
+	require.Equal(int64(len(content)), header.Size, "the size of the entry differs")
+	read, err := ioutil.ReadAll(reader)
+	require.Nil(err, "unable to read the entry")
+	require.Equal(content, read, "the content of the entry differs")
+}
+
+func (suite *mirrorTestSuite) TestImportWithoutManifest() {
+	bundle := &bytes.Buffer{}
+	writer := tar.NewWriter(bundle)
+	suite.Require().Nil(writer.WriteHeader(&tar.Header{Name: "files/fuu/fuu-1.0.tar.gz", Mode: 0640}))
+	suite.Require().Nil(writer.Close())
+	_, err := Import(bundle, suite.target())
+	suite.Require().NotNil(err, "a bundle without manifest has been imported")
+}
@@ -0,0 +1,221 @@
+package mirror
+
+import (
+	"github.com/hansingt/GoatCheese/internal/distribution"
+	"strconv"
+	"strings"
+)
+
+/*
+Filter selects the files of a project to mirror.
+Wheels are selected by their platform and python tags as defined in PEP 425,
+all files by their Requires-Python specifier.
+An empty list of platforms or python versions matches all files.
+*/
+type Filter struct {
+	Platforms      []string // Platforms are the platform tags to mirror, e.g. "manylinux2014_x86_64"
+	PythonVersions []string // PythonVersions are the python versions to mirror, e.g. "3.8"
+}
+
+/*
+Matches checks whether a file with the given name and Requires-Python specifier has to be mirrored.
+Files being neither wheels nor source distributions are never mirrored.
+*/
+func (f *Filter) Matches(fileName string, requiresPython string) bool {
+	name, err := distribution.ParseFileName(fileName)
+	if err != nil {
+		return false
+	}
+	if name.Kind == distribution.Wheel {
+		pythonTags, abiTags, platformTags := name.Tags[1], name.Tags[2], name.Tags[3]
+		if !f.matchesPlatform(platformTags) || !f.matchesPythonTags(pythonTags, abiTags) {
+			return false
+		}
+	}
+	return f.matchesRequiresPython(requiresPython)
+}
+
+func (f *Filter) matchesPlatform(platformTags string) bool {
+	if len(f.Platforms) == 0 {
+		return true
+	}
+	for _, tag := range strings.Split(platformTags, ".") {
+		if tag == "any" {
+			return true
+		}
+		for _, platform := range f.Platforms {
+			if tag == platform {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f *Filter) matchesPythonTags(pythonTags string, abiTags string) bool {
+	if len(f.PythonVersions) == 0 {
+		return true
+	}
+	stableABI := false
+	for _, tag := range strings.Split(abiTags, ".") {
+		stableABI = stableABI || tag == "abi3"
+	}
+	for _, version := range f.PythonVersions {
+		major, minor := splitPythonVersion(version)
+		for _, tag := range strings.Split(pythonTags, ".") {
+			tagMajor, tagMinor, ok := parsePythonTag(tag)
+			if !ok || tagMajor != major {
+				continue
+			} else if tagMinor < 0 || tagMinor == minor || stableABI && tagMinor <= minor {
+				// Tags without minor version match all minor versions,
+				// tags of the stable ABI all later minor versions
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f *Filter) matchesRequiresPython(specifier string) bool {
+	if len(f.PythonVersions) == 0 || strings.TrimSpace(specifier) == "" {
+		return true
+	}
+	for _, version := range f.PythonVersions {
+		if specifierMatches(specifier, version) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+splitPythonVersion splits a python version like "3.8" into its major and minor version.
+*/
+func splitPythonVersion(version string) (int, int) {
+	parts := parseVersion(version)
+	major, minor := 0, 0
+	if len(parts) > 0 {
+		major = parts[0]
+	}
+	if len(parts) > 1 {
+		minor = parts[1]
+	}
+	return major, minor
+}
+
+/*
+parsePythonTag parses a python tag like "cp38", "py3" or "py310".
+The minor version is negative, if the tag does not specify one.
+*/
+func parsePythonTag(tag string) (int, int, bool) {
+	digits := strings.TrimLeft(tag, "abcdefghijklmnopqrstuvwxyz")
+	if len(digits) == 0 || len(digits) == len(tag) {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(digits[:1])
+	if err != nil {
+		return 0, 0, false
+	} else if len(digits) == 1 {
+		return major, -1, true
+	}
+	minor, err := strconv.Atoi(digits[1:])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
+
+/*
+parseVersion parses the numeric components of a version like "3.8.1".
+Parsing stops at the first non-numeric component.
+*/
+func parseVersion(version string) []int {
+	var parts []int
+	for _, part := range strings.Split(strings.TrimSpace(version), ".") {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			break
+		}
+		parts = append(parts, number)
+	}
+	return parts
+}
+
+/*
+compareVersions compares two versions given by their numeric components.
+Missing components are treated as zero.
+*/
+func compareVersions(a []int, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+	}
+	return 0
+}
+
+/*
+hasPrefix checks whether the version starts with the given components.
+*/
+func hasPrefix(version []int, prefix []int) bool {
+	for i, part := range prefix {
+		var component int
+		if i < len(version) {
+			component = version[i]
+		}
+		if component != part {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+specifierMatches checks whether a python version satisfies a Requires-Python specifier as defined in PEP 440,
+e.g. ">=2.7, !=3.0.*". Clauses not understood are ignored, so that files are rather mirrored than missing.
+*/
+func specifierMatches(specifier string, pythonVersion string) bool {
+	version := parseVersion(pythonVersion)
+	for _, clause := range strings.Split(specifier, ",") {
+		clause = strings.TrimSpace(clause)
+		operator := strings.TrimRight(clause, "0123456789.* ")
+		value := strings.TrimSpace(strings.TrimPrefix(clause, operator))
+		wildcard := strings.HasSuffix(value, ".*")
+		expected := parseVersion(strings.TrimSuffix(value, ".*"))
+		if len(expected) == 0 {
+			continue
+		}
+		var matches bool
+		switch strings.TrimSpace(operator) {
+		case "==", "===":
+			matches = wildcard && hasPrefix(version, expected) || !wildcard && compareVersions(version, expected) == 0
+		case "!=":
+			matches = wildcard && !hasPrefix(version, expected) || !wildcard && compareVersions(version, expected) != 0
+		case ">=":
+			matches = compareVersions(version, expected) >= 0
+		case "<=":
+			matches = compareVersions(version, expected) <= 0
+		case ">":
+			matches = compareVersions(version, expected) > 0
+		case "<":
+			matches = compareVersions(version, expected) < 0
+		case "~=":
+			matches = compareVersions(version, expected) >= 0 && hasPrefix(version, expected[:len(expected)-1])
+		default:
+			matches = true
+		}
+		if !matches {
+			return false
+		}
+	}
+	return true
+}
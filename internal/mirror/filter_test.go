@@ -0,0 +1,66 @@
+package mirror
+
+import (
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type filterTestSuite struct {
+	suite.Suite
+}
+
+func TestFilter(t *testing.T) {
+	suite.Run(t, new(filterTestSuite))
+}
+
+func (suite *filterTestSuite) TestEmptyFilter() {
+	require := suite.Require()
+	filter := &Filter{}
+	require.True(filter.Matches("numpy-1.19.0-cp38-cp38-win_amd64.whl", ">=3.6"))
+	require.True(filter.Matches("numpy-1.19.0.zip", ""))
+	require.False(filter.Matches("numpy-1.19.0-py3.8.egg", ""), "eggs are not mirrored")
+}
+
+func (suite *filterTestSuite) TestPlatforms() {
+	require := suite.Require()
+	filter := &Filter{Platforms: []string{"manylinux2014_x86_64"}}
+	require.True(filter.Matches("fuu-1.0-py3-none-any.whl", ""))
+	require.True(filter.Matches("fuu-1.0-cp38-cp38-manylinux_2_17_x86_64.manylinux2014_x86_64.whl", ""))
+	require.False(filter.Matches("fuu-1.0-cp38-cp38-win_amd64.whl", ""))
+	require.True(filter.Matches("fuu-1.0.tar.gz", ""), "source distributions are platform independent")
+}
+
+func (suite *filterTestSuite) TestPythonVersions() {
+	require := suite.Require()
+	filter := &Filter{PythonVersions: []string{"3.8", "3.10"}}
+	require.True(filter.Matches("fuu-1.0-py2.py3-none-any.whl", ""))
+	require.True(filter.Matches("fuu-1.0-cp38-cp38-win_amd64.whl", ""))
+	require.True(filter.Matches("fuu-1.0-cp310-cp310-win_amd64.whl", ""))
+	require.False(filter.Matches("fuu-1.0-cp39-cp39-win_amd64.whl", ""))
+	require.False(filter.Matches("fuu-1.0-py2-none-any.whl", ""))
+	require.True(filter.Matches("fuu-1.0-cp36-abi3-win_amd64.whl", ""), "the stable ABI matches later versions")
+	require.False(filter.Matches("fuu-1.0-cp311-abi3-win_amd64.whl", ""))
+	require.True(filter.Matches("fuu-1.0.tar.gz", ">=3.9"))
+	require.False(filter.Matches("fuu-1.0.tar.gz", ">=3.11"))
+	require.False(filter.Matches("fuu-1.0-py3-none-any.whl", "<3.8"))
+}
+
+func (suite *filterTestSuite) TestSpecifierMatches() {
+	require := suite.Require()
+	for specifier, expected := range map[string]bool{
+		">=3.6":                   true,
+		">3.8":                    false,
+		"<=3.8":                   true,
+		">=2.7, !=3.0.*, !=3.1.*": true,
+		"!=3.8.*":                 false,
+		"==3.*":                   true,
+		"==3.8":                   true,
+		"~=3.7":                   true,
+		"~=3.9":                   false,
+		"~=3.7.0":                 false,
+		">=3.6, <4":               true,
+		"unknown":                 true,
+	} {
+		require.Equal(expected, specifierMatches(specifier, "3.8"), "specifier '%s'", specifier)
+	}
+}
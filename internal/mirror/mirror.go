@@ -0,0 +1,171 @@
+/*
+Package mirror implements mirroring projects from an upstream simple index into a repository,
+e.g. to provide them on sites without access to the upstream index. Projects are moved to
+such sites by exporting them into bundles and importing the bundles into another instance.
+*/
+package mirror
+
+import (
+	"fmt"
+	"github.com/hansingt/GoatCheese/internal/datastore"
+	"github.com/hansingt/GoatCheese/internal/distribution"
+	"github.com/hansingt/GoatCheese/internal/simple"
+	"io"
+	"log"
+	"strings"
+)
+
+/*
+Mirror copies the files of projects from an upstream simple index into a repository.
+
+Files already stored in the repository with the checksum published by the upstream
+index are skipped. Thus, interrupted runs are resumed and repeated runs only
+download the files added to the upstream index in the meantime.
+*/
+type Mirror struct {
+	Upstream   *simple.Client       // Upstream is the client of the index to mirror from
+	Repository datastore.Repository // Repository is the repository to mirror into
+	Filter     Filter               // Filter selects the files to mirror
+}
+
+/*
+Result summarizes the files handled by a mirror run.
+*/
+type Result struct {
+	Added   int // Added is the number of files downloaded
+	Skipped int // Skipped is the number of files already mirrored
+	Failed  int // Failed is the number of files or projects which could not be mirrored
+}
+
+/*
+Sync mirrors the files of the required projects.
+Failures of single projects or files are logged and counted, but do not stop the other ones from being mirrored.
+*/
+func (m *Mirror) Sync(requirements []Requirement) Result {
+	var result Result
+	for _, requirement := range requirements {
+		if err := m.syncProject(requirement, &result); err != nil {
+			log.Printf("unable to mirror '%s': %s", requirement.Name, err)
+			result.Failed++
+		}
+	}
+	return result
+}
+
+func (m *Mirror) syncProject(requirement Requirement, result *Result) error {
+	files, err := m.Upstream.Project(requirement.Name)
+	if err != nil {
+		return err
+	} else if files == nil {
+		return fmt.Errorf("the project does not exist in '%s'", m.Upstream.BaseURL)
+	}
+	prj, err := m.Repository.AddProject(distribution.NormalizeName(requirement.Name))
+	if err != nil {
+		return err
+	} else if prj.IsReadOnly() {
+		return fmt.Errorf("the project is a read-only copy of the upstream of '%s'", m.Repository.Name())
+	}
+	for _, file := range files {
+		if !m.selects(requirement, file) {
+			continue
+		}
+		existing, err := prj.GetFile(file.Name)
+		if err != nil {
+			return err
+		} else if existing != nil {
+			if file.SHA256 == "" || strings.EqualFold(existing.Checksum(), file.SHA256) {
+				result.Skipped++
+			} else {
+				log.Printf("not mirroring '%s', a file with different content exists already", file.Name)
+				result.Failed++
+			}
+			continue
+		}
+		if err = m.download(prj, file); err != nil {
+			log.Printf("unable to mirror '%s': %s", file.Name, err)
+			result.Failed++
+			continue
+		}
+		log.Printf("mirrored '%s'", file.Name)
+		result.Added++
+	}
+	return nil
+}
+
+/*
+selects checks whether the upstream file has to be mirrored for the requirement.
+*/
+func (m *Mirror) selects(requirement Requirement, file simple.File) bool {
+	if requirement.Version != "" {
+		name, err := distribution.ParseFileName(file.Name)
+		if err != nil || name.Version != requirement.Version {
+			return false
+		}
+	}
+	return m.Filter.Matches(file.Name, file.RequiresPython)
+}
+
+/*
+download streams the upstream file into the project and stores its metadata.
+*/
+func (m *Mirror) download(prj datastore.Project, file simple.File) error {
+	content, err := m.Upstream.Download(file.URL)
+	if err != nil {
+		return err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer content.Close()
+	upload, err := prj.NewUpload(file.Name)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(upload, content); err != nil {
+		_ = upload.Discard()
+		return err
+	}
+	return commitFile(prj, upload, file)
+}
+
+/*
+commitFile verifies the checksum of the uploaded file and adds it to the project.
+The release and Requires-Python specifier are read from the metadata of the file,
+if they are not given, and the file is yanked, if requested.
+*/
+func commitFile(prj datastore.Project, upload datastore.Upload, file simple.File) error {
+	if file.SHA256 != "" && !strings.EqualFold(upload.Checksum(), file.SHA256) {
+		_ = upload.Discard()
+		return fmt.Errorf("the checksum '%s' differs from the published one", upload.Checksum())
+	}
+	metadata, err := distribution.ReadMetadata(file.Name, upload, upload.Size())
+	if err != nil {
+		// The file is stored nevertheless, as it has been published already
+		log.Printf("unable to read the metadata of '%s': %s", file.Name, err)
+	}
+	if err = upload.Commit(); err != nil {
+		return err
+	}
+
+	stored, err := prj.GetFile(file.Name)
+	if err != nil {
+		return err
+	}
+	requiresPython := file.RequiresPython
+	if metadata != nil {
+		release, err := prj.AddRelease(*metadata)
+		if err != nil {
+			return err
+		} else if err = stored.SetRelease(release); err != nil {
+			return err
+		}
+		if requiresPython == "" {
+			requiresPython = metadata.RequiresPython
+		}
+	}
+	if err = stored.SetRequiresPython(requiresPython); err != nil {
+		return err
+	}
+	if file.Yanked {
+		return stored.Yank(file.YankedReason)
+	}
+	return nil
+}
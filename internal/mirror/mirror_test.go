@@ -0,0 +1,151 @@
+package mirror
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/hansingt/GoatCheese/internal/datastore"
+	"github.com/hansingt/GoatCheese/internal/simple"
+	"github.com/hansingt/GoatCheese/internal/testutil"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+type mirrorTestSuite struct {
+	suite.Suite
+	storagePath string
+	db          datastore.Datastore
+	upstream    *httptest.Server
+	files       map[string][]byte
+	checksums   map[string]string
+	downloads   int32
+	mirror      *Mirror
+}
+
+func TestMirror(t *testing.T) {
+	suite.Run(t, new(mirrorTestSuite))
+}
+
+func (suite *mirrorTestSuite) SetupTest() {
+	require := suite.Require()
+	var err error
+	suite.storagePath, err = ioutil.TempDir(os.TempDir(), "")
+	require.Nil(err, "unable to create the temporary storage path")
+	config := filepath.Join(suite.storagePath, "config.yaml")
+	require.Nil(ioutil.WriteFile(config, []byte(`
+storagePath: "`+suite.storagePath+`"
+database:
+  driver: "sqlite3"
+  connection: ":memory:"
+indexes:
+  - name: "mirror"
+    bases: []
+  - name: "target"
+    bases: []
+`), 0640), "unable to write the configuration file")
+	suite.db, err = datastore.New(config)
+	require.Nil(err, "unable to create the data store")
+
+	suite.files = map[string][]byte{
+		"fuu-1.0-py3-none-any.whl":        testutil.Wheel("fuu", "1.0"),
+		"fuu-1.0-cp38-cp38-win_amd64.whl": testutil.Wheel("fuu", "1.0"),
+		"fuu-2.0-py3-none-any.whl":        testutil.Wheel("fuu", "2.0"),
+	}
+	suite.checksums = make(map[string]string, len(suite.files))
+	for fileName, content := range suite.files {
+		checksum := sha256.Sum256(content)
+		suite.checksums[fileName] = hex.EncodeToString(checksum[:])
+	}
+	suite.downloads = 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/simple/fuu/", func(w http.ResponseWriter, r *http.Request) {
+		for fileName, checksum := range suite.checksums {
+			_, _ = fmt.Fprintf(w, `<a href="/files/%s#sha256=%s">%s</a>`, fileName, checksum, fileName)
+		}
+	})
+	mux.HandleFunc("/files/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&suite.downloads, 1)
+		_, _ = w.Write(suite.files[filepath.Base(r.URL.Path)])
+	})
+	suite.upstream = httptest.NewServer(mux)
+
+	repo, err := suite.db.GetRepository("mirror")
+	require.Nil(err, "unable to get the repository")
+	suite.mirror = &Mirror{
+		Upstream:   simple.NewClient(suite.upstream.URL+"/simple/", 0),
+		Repository: repo,
+		Filter:     Filter{Platforms: []string{"manylinux2014_x86_64"}},
+	}
+}
+
+func (suite *mirrorTestSuite) TearDownTest() {
+	suite.upstream.Close()
+	suite.Require().Nil(suite.db.Close(), "unable to close the database connection")
+	suite.Require().Nil(os.RemoveAll(suite.storagePath), "unable to remove the storage path")
+}
+
+// project returns the mirrored project
+func (suite *mirrorTestSuite) project() datastore.Project {
+	project, err := suite.mirror.Repository.GetProject("fuu")
+	suite.Require().Nil(err, "unable to get the project")
+	suite.Require().NotNil(project, "the project has not been mirrored")
+	return project
+}
+
+func (suite *mirrorTestSuite) TestSync() {
+	require := suite.Require()
+	result := suite.mirror.Sync([]Requirement{{Name: "Fuu"}})
+	require.Equal(Result{Added: 2}, result, "the files have not been mirrored")
+
+	project := suite.project()
+	files, err := project.ProjectFiles()
+	require.Nil(err, "unable to get the project files")
+	require.Len(files, 2, "files not matching the filter have been mirrored")
+	file, err := project.GetFile("fuu-2.0-py3-none-any.whl")
+	require.Nil(err, "unable to get the file")
+	require.Equal(suite.checksums[file.Name()], file.Checksum(), "the checksum differs")
+	release, err := file.Release()
+	require.Nil(err, "unable to get the release")
+	require.NotNil(release, "the release has not been added")
+	require.Equal("2.0", release.Version())
+}
+
+func (suite *mirrorTestSuite) TestIncrementalSync() {
+	require := suite.Require()
+	require.Equal(Result{Added: 1}, suite.mirror.Sync([]Requirement{{Name: "fuu", Version: "1.0"}}))
+	require.Equal(Result{Added: 1, Skipped: 1}, suite.mirror.Sync([]Requirement{{Name: "fuu"}}),
+		"already mirrored files have not been skipped")
+	require.Equal(int32(2), atomic.LoadInt32(&suite.downloads), "files have been downloaded again")
+}
+
+func (suite *mirrorTestSuite) TestChecksumMismatch() {
+	require := suite.Require()
+	suite.checksums["fuu-2.0-py3-none-any.whl"] = suite.checksums["fuu-1.0-py3-none-any.whl"]
+	result := suite.mirror.Sync([]Requirement{{Name: "fuu", Version: "2.0"}})
+	require.Equal(Result{Failed: 1}, result, "a file with a wrong checksum has been mirrored")
+	file, err := suite.project().GetFile("fuu-2.0-py3-none-any.whl")
+	require.Nil(err, "unable to get the file")
+	require.Nil(file, "a file with a wrong checksum has been stored")
+}
+
+func (suite *mirrorTestSuite) TestConflictingFile() {
+	require := suite.Require()
+	project, err := suite.mirror.Repository.AddProject("fuu")
+	require.Nil(err, "unable to add the project")
+	require.Nil(project.AddFile("fuu-1.0-py3-none-any.whl", bytes.NewReader([]byte("local"))),
+		"unable to add the local file")
+	result := suite.mirror.Sync([]Requirement{{Name: "fuu", Version: "1.0"}})
+	require.Equal(Result{Failed: 1}, result, "a conflicting file has not been reported")
+}
+
+func (suite *mirrorTestSuite) TestUnknownProject() {
+	result := suite.mirror.Sync([]Requirement{{Name: "unknown"}, {Name: "fuu", Version: "2.0"}})
+	suite.Require().Equal(Result{Added: 1, Failed: 1}, result, "the failure stopped the other projects")
+}
@@ -0,0 +1,78 @@
+package mirror
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+)
+
+var (
+	requirementRegExp = regexp.MustCompile(`^([A-Za-z0-9](?:[A-Za-z0-9._-]*[A-Za-z0-9])?)\s*(?:\[[^\]]*\])?\s*(.*)$`)
+	// Comments start with a "#" at the beginning of the line or after whitespace
+	commentRegExp = regexp.MustCompile(`(^|\s)#.*$`)
+)
+
+/*
+Requirement defines a project to mirror.
+*/
+type Requirement struct {
+	Name    string // Name is the name of the project
+	Version string // Version is the only version to mirror, if pinned using "==". It is empty to mirror all versions.
+}
+
+/*
+ParseRequirement parses a single requirement as given in a requirements file, e.g. "requests[socks]==2.22.0".
+Only versions pinned using "==" restrict the mirrored versions, all other version specifiers are ignored.
+*/
+func ParseRequirement(line string) (Requirement, error) {
+	// Neither environment markers nor per-requirement options like --hash restrict the files to mirror
+	if i := strings.Index(line, ";"); i >= 0 {
+		line = line[:i]
+	}
+	if i := strings.Index(line, " --"); i >= 0 {
+		line = line[:i]
+	}
+	match := requirementRegExp.FindStringSubmatch(strings.TrimSpace(line))
+	if match == nil {
+		return Requirement{}, fmt.Errorf("'%s' is not a valid requirement", line)
+	}
+	requirement := Requirement{Name: match[1]}
+	specifier := strings.TrimSpace(match[2])
+	if strings.HasPrefix(specifier, "==") && !strings.ContainsAny(specifier, ",*") {
+		requirement.Version = strings.TrimSpace(strings.TrimPrefix(specifier, "=="))
+	} else if specifier != "" && !strings.HasPrefix(specifier, "@") {
+		log.Printf("mirroring all versions of '%s', only '==' restricts the versions", requirement.Name)
+	}
+	return requirement, nil
+}
+
+/*
+ReadRequirements reads the requirements from a pip requirements file.
+Comments, empty lines and options are skipped.
+*/
+func ReadRequirements(content io.Reader) ([]Requirement, error) {
+	var requirements []Requirement
+	var line string
+	scanner := bufio.NewScanner(content)
+	for scanner.Scan() {
+		line += strings.TrimSpace(scanner.Text())
+		// Lines ending with a backslash are continued on the next line
+		if strings.HasSuffix(line, "\\") {
+			line = strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		line = strings.TrimSpace(commentRegExp.ReplaceAllString(line, ""))
+		if line != "" && !strings.HasPrefix(line, "-") {
+			requirement, err := ParseRequirement(line)
+			if err != nil {
+				return nil, err
+			}
+			requirements = append(requirements, requirement)
+		}
+		line = ""
+	}
+	return requirements, scanner.Err()
+}
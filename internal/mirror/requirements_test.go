@@ -0,0 +1,54 @@
+package mirror
+
+import (
+	"github.com/stretchr/testify/suite"
+	"strings"
+	"testing"
+)
+
+type requirementsTestSuite struct {
+	suite.Suite
+}
+
+func TestRequirements(t *testing.T) {
+	suite.Run(t, new(requirementsTestSuite))
+}
+
+func (suite *requirementsTestSuite) TestParseRequirement() {
+	require := suite.Require()
+	for line, expected := range map[string]Requirement{
+		"requests":                            {Name: "requests"},
+		"requests==2.22.0":                    {Name: "requests", Version: "2.22.0"},
+		"requests[socks] == 2.22.0":           {Name: "requests", Version: "2.22.0"},
+		"requests>=2.0,<3":                    {Name: "requests"},
+		"requests==2.*":                       {Name: "requests"},
+		"pywin32==227; sys_platform=='win32'": {Name: "pywin32", Version: "227"},
+		"zope.interface @ https://host/zope.interface-4.7.1.zip": {Name: "zope.interface"},
+	} {
+		requirement, err := ParseRequirement(line)
+		require.Nil(err, "unable to parse '%s'", line)
+		require.Equal(expected, requirement, "'%s' has not been parsed correctly", line)
+	}
+	_, err := ParseRequirement("==1.0")
+	require.NotNil(err, "a requirement without name has been accepted")
+}
+
+func (suite *requirementsTestSuite) TestReadRequirements() {
+	require := suite.Require()
+	requirements, err := ReadRequirements(strings.NewReader(`
+# Comment
+--index-url https://pypi.org/simple/
+-r other.txt
+requests==2.22.0 \
+    --hash=sha256:abcdef
+six  # inline comment
+
+numpy>=1.18
+`))
+	require.Nil(err, "unable to read the requirements")
+	require.Equal([]Requirement{
+		{Name: "requests", Version: "2.22.0"},
+		{Name: "six"},
+		{Name: "numpy"},
+	}, requirements)
+}
@@ -0,0 +1,324 @@
+/*
+Package simple implements a client for python package indexes implementing the
+simple repository API as defined in PEP 503 and PEP 691.
+*/
+package simple
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hansingt/GoatCheese/internal/distribution"
+	"golang.org/x/net/html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	jsonContentType = "application/vnd.pypi.simple.v1+json"
+	acceptHeader    = jsonContentType + ", application/vnd.pypi.simple.v1+html;q=0.2, text/html;q=0.1"
+	// DefaultTimeout is the timeout used for requests, if no other timeout is configured
+	DefaultTimeout = 30 * time.Second
+)
+
+/*
+File describes a single distribution file listed by a simple index.
+*/
+type File struct {
+	Name           string // Name is the file name of the distribution
+	URL            string // URL is the absolute URL to download the file from
+	SHA256         string // SHA256 is the sha256 hex digest of the file, if published by the index
+	RequiresPython string // RequiresPython is the Requires-Python specifier of the file
+	Yanked         bool   // Yanked is true, if the file has been yanked
+	YankedReason   string // YankedReason is the reason given for yanking the file
+}
+
+/*
+Client requests project information and files from a simple index.
+*/
+type Client struct {
+	BaseURL string       // BaseURL is the URL of the simple index, e.g. https://pypi.org/simple/
+	HTTP    *http.Client // HTTP is the client used to send the requests
+	// Downloads is the client used to download files. If it is nil, the HTTP client is used.
+	Downloads *http.Client
+}
+
+/*
+NewClient creates a new client for the simple index at the given URL.
+*/
+func NewClient(baseURL string, timeout time.Duration) *Client {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	return &Client{
+		BaseURL:   baseURL,
+		HTTP:      &http.Client{Timeout: timeout},
+		Downloads: NewDownloadClient(timeout),
+	}
+}
+
+/*
+NewDownloadClient creates a client to download files.
+The timeout only limits waiting for the response, because reading large files might take longer.
+*/
+func NewDownloadClient(timeout time.Duration) *http.Client {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+	}}
+}
+
+type jsonMeta struct {
+	APIVersion string `json:"api-version"`
+}
+
+type jsonProjectList struct {
+	Meta     jsonMeta `json:"meta"`
+	Projects []struct {
+		Name string `json:"name"`
+	} `json:"projects"`
+}
+
+type jsonProject struct {
+	Meta  jsonMeta `json:"meta"`
+	Name  string   `json:"name"`
+	Files []struct {
+		FileName       string            `json:"filename"`
+		URL            string            `json:"url"`
+		Hashes         map[string]string `json:"hashes"`
+		RequiresPython string            `json:"requires-python"`
+		Yanked         interface{}       `json:"yanked"`
+	} `json:"files"`
+}
+
+/*
+get requests the given page from the index.
+It returns a nil response, if the page has not been found.
+*/
+func (c *Client) get(pageURL string) (*http.Response, error) {
+	request, err := http.NewRequest(http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", acceptHeader)
+	response, err := c.HTTP.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode == http.StatusNotFound {
+		_ = response.Body.Close()
+		return nil, nil
+	} else if response.StatusCode != http.StatusOK {
+		_ = response.Body.Close()
+		return nil, fmt.Errorf("unexpected response from '%s': %s", pageURL, response.Status)
+	}
+	return response, nil
+}
+
+func isJSON(response *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	return err == nil && mediaType == jsonContentType
+}
+
+/*
+Projects returns the names of all projects listed by the index.
+*/
+func (c *Client) Projects() ([]string, error) {
+	response, err := c.get(c.BaseURL)
+	if err != nil {
+		return nil, err
+	} else if response == nil {
+		return nil, fmt.Errorf("the simple index '%s' does not exist", c.BaseURL)
+	}
+	//noinspection GoUnhandledErrorResult
+	defer response.Body.Close()
+
+	var names []string
+	if isJSON(response) {
+		var list jsonProjectList
+		if err = json.NewDecoder(response.Body).Decode(&list); err != nil {
+			return nil, err
+		}
+		for _, project := range list.Projects {
+			names = append(names, project.Name)
+		}
+		return names, nil
+	}
+	links, err := parseLinks(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range links {
+		names = append(names, link.text)
+	}
+	return names, nil
+}
+
+/*
+Project returns the files of a project listed by the index.
+If the project is not known to the index, it returns nil.
+*/
+func (c *Client) Project(projectName string) ([]File, error) {
+	pageURL := c.BaseURL + url.PathEscape(distribution.NormalizeName(projectName)) + "/"
+	response, err := c.get(pageURL)
+	if err != nil || response == nil {
+		return nil, err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer response.Body.Close()
+	// Relative links are relative to the final URL after following redirects
+	base := response.Request.URL
+
+	files := make([]File, 0)
+	if isJSON(response) {
+		var project jsonProject
+		if err = json.NewDecoder(response.Body).Decode(&project); err != nil {
+			return nil, err
+		}
+		for _, file := range project.Files {
+			fileURL, err := base.Parse(file.URL)
+			if err != nil {
+				return nil, err
+			}
+			fileURL.Fragment = ""
+			result := File{
+				Name:           file.FileName,
+				URL:            fileURL.String(),
+				SHA256:         file.Hashes["sha256"],
+				RequiresPython: file.RequiresPython,
+			}
+			switch yanked := file.Yanked.(type) {
+			case bool:
+				result.Yanked = yanked
+			case string:
+				result.Yanked = true
+				result.YankedReason = yanked
+			}
+			files = append(files, result)
+		}
+		return files, nil
+	}
+
+	links, err := parseLinks(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range links {
+		fileURL, err := base.Parse(link.href)
+		if err != nil {
+			return nil, err
+		}
+		result := File{
+			Name:           path.Base(fileURL.Path),
+			RequiresPython: link.attributes["data-requires-python"],
+		}
+		if fragment := fileURL.Fragment; strings.HasPrefix(fragment, "sha256=") {
+			result.SHA256 = strings.TrimPrefix(fragment, "sha256=")
+		}
+		if reason, yanked := link.attributes["data-yanked"]; yanked {
+			result.Yanked = true
+			result.YankedReason = reason
+		}
+		fileURL.Fragment = ""
+		result.URL = fileURL.String()
+		files = append(files, result)
+	}
+	return files, nil
+}
+
+/*
+Download opens the file with the given URL for reading.
+The caller is responsible to close the returned reader.
+*/
+func (c *Client) Download(fileURL string) (io.ReadCloser, error) {
+	response, err := c.Get(fileURL)
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+/*
+Get requests the file with the given URL and returns the response, if it succeeded.
+The caller is responsible to close the body of the response.
+*/
+func (c *Client) Get(fileURL string) (*http.Response, error) {
+	client := c.Downloads
+	if client == nil {
+		client = c.HTTP
+	}
+	response, err := client.Get(fileURL)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		_ = response.Body.Close()
+		return nil, fmt.Errorf("unable to download '%s': %s", fileURL, response.Status)
+	}
+	return response, nil
+}
+
+type link struct {
+	href       string
+	text       string
+	attributes map[string]string
+}
+
+/*
+parseLinks parses all anchors from a HTML simple index page.
+*/
+func parseLinks(content io.Reader) ([]link, error) {
+	var links []link
+	var current *link
+	tokenizer := html.NewTokenizer(content)
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if tokenizer.Err() == io.EOF {
+				return links, nil
+			}
+			return nil, tokenizer.Err()
+		case html.StartTagToken:
+			token := tokenizer.Token()
+			if token.Data != "a" {
+				continue
+			}
+			current = &link{attributes: make(map[string]string)}
+			for _, attribute := range token.Attr {
+				if attribute.Key == "href" {
+					current.href = attribute.Val
+				} else {
+					current.attributes[attribute.Key] = attribute.Val
+				}
+			}
+		case html.TextToken:
+			if current != nil {
+				current.text += string(tokenizer.Text())
+			}
+		case html.EndTagToken:
+			token := tokenizer.Token()
+			if token.Data == "a" && current != nil {
+				current.text = strings.TrimSpace(current.text)
+				if current.href != "" {
+					links = append(links, *current)
+				}
+				current = nil
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package simple
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type clientTestSuite struct {
+	suite.Suite
+	server   *httptest.Server
+	client   *Client
+	useJSON  bool
+	requests []string
+}
+
+func TestClient(t *testing.T) {
+	suite.Run(t, new(clientTestSuite))
+}
+
+func (suite *clientTestSuite) SetupTest() {
+	suite.requests = nil
+	suite.useJSON = false
+	mux := http.NewServeMux()
+	mux.HandleFunc("/simple/", func(w http.ResponseWriter, r *http.Request) {
+		suite.requests = append(suite.requests, r.URL.Path)
+		if r.URL.Path != "/simple/" {
+			http.NotFound(w, r)
+			return
+		}
+		if suite.useJSON {
+			w.Header().Set("Content-Type", jsonContentType)
+			_, _ = fmt.Fprint(w, `{"meta": {"api-version": "1.0"}, "projects": [{"name": "Fuu.Bar"}, {"name": "asdf"}]}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `<html><body><a href="fuu-bar/">Fuu.Bar</a><a href="asdf/"> asdf </a></body></html>`)
+	})
+	mux.HandleFunc("/simple/fuu-bar/", func(w http.ResponseWriter, r *http.Request) {
+		suite.requests = append(suite.requests, r.URL.Path)
+		if suite.useJSON {
+			w.Header().Set("Content-Type", jsonContentType+"; charset=utf-8")
+			_, _ = fmt.Fprint(w, `{"meta": {"api-version": "1.0"}, "name": "fuu-bar", "files": [
+				{"filename": "Fuu.Bar-1.0.tar.gz", "url": "../../files/Fuu.Bar-1.0.tar.gz", "hashes": {"sha256": "abc"}, "requires-python": ">=3.6", "yanked": false},
+				{"filename": "Fuu.Bar-0.1.tar.gz", "url": "/files/Fuu.Bar-0.1.tar.gz", "hashes": {}, "yanked": "broken"}
+			]}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `<html><body>
+			<a href="../../files/Fuu.Bar-1.0.tar.gz#sha256=abc" data-requires-python="&gt;=3.6">Fuu.Bar-1.0.tar.gz</a>
+			<a href="/files/Fuu.Bar-0.1.tar.gz" data-yanked="broken">Fuu.Bar-0.1.tar.gz</a>
+		</body></html>`)
+	})
+	mux.HandleFunc("/files/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "content")
+	})
+	suite.server = httptest.NewServer(mux)
+	suite.client = NewClient(suite.server.URL+"/simple", 0)
+}
+
+func (suite *clientTestSuite) TearDownTest() {
+	suite.server.Close()
+}
+
+func (suite *clientTestSuite) checkFiles(files []File) {
+	require := suite.Require()
+	require.Equal([]File{
+		{
+			Name:           "Fuu.Bar-1.0.tar.gz",
+			URL:            suite.server.URL + "/files/Fuu.Bar-1.0.tar.gz",
+			SHA256:         "abc",
+			RequiresPython: ">=3.6",
+		},
+		{
+			Name:         "Fuu.Bar-0.1.tar.gz",
+			URL:          suite.server.URL + "/files/Fuu.Bar-0.1.tar.gz",
+			Yanked:       true,
+			YankedReason: "broken",
+		},
+	}, files, "the files have not been parsed correctly")
+}
+
+func (suite *clientTestSuite) TestProjectsHTML() {
+	projects, err := suite.client.Projects()
+	suite.Require().Nil(err, "unable to get the projects")
+	suite.Require().Equal([]string{"Fuu.Bar", "asdf"}, projects)
+}
+
+func (suite *clientTestSuite) TestProjectsJSON() {
+	suite.useJSON = true
+	projects, err := suite.client.Projects()
+	suite.Require().Nil(err, "unable to get the projects")
+	suite.Require().Equal([]string{"Fuu.Bar", "asdf"}, projects)
+}
+
+func (suite *clientTestSuite) TestProjectHTML() {
+	files, err := suite.client.Project("Fuu.Bar")
+	suite.Require().Nil(err, "unable to get the project")
+	suite.Require().Equal([]string{"/simple/fuu-bar/"}, suite.requests, "the name has not been normalized")
+	suite.checkFiles(files)
+}
+
+func (suite *clientTestSuite) TestProjectJSON() {
+	suite.useJSON = true
+	files, err := suite.client.Project("fuu-bar")
+	suite.Require().Nil(err, "unable to get the project")
+	suite.checkFiles(files)
+}
+
+func (suite *clientTestSuite) TestProjectNotFound() {
+	files, err := suite.client.Project("unknown")
+	suite.Require().Nil(err, "a missing project raised an error")
+	suite.Require().Nil(files, "files found for an unknown project")
+}
+
+func (suite *clientTestSuite) TestDownload() {
+	require := suite.Require()
+	reader, err := suite.client.Download(suite.server.URL + "/files/Fuu.Bar-1.0.tar.gz")
+	require.Nil(err, "unable to download the file")
+	content, err := ioutil.ReadAll(reader)
+	require.Nil(err, "unable to read the file")
+	require.Nil(reader.Close())
+	require.Equal("content", string(content))
+
+	_, err = suite.client.Download(suite.server.URL + "/unknown")
+	require.NotNil(err, "no error raised for a missing file")
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type local struct {
+	root string
+}
+
+type localObject struct {
+	*os.File
+	info os.FileInfo
+}
+
+/*
+NewLocal creates a backend storing the objects as files below the root directory.
+*/
+func NewLocal(root string) (Backend, error) {
+	if err := os.MkdirAll(filepath.Join(root, TempDirectory), 0750); err != nil {
+		return nil, err
+	}
+	return &local{root: root}, nil
+}
+
+func (l *local) path(key string) string {
+	return filepath.Join(l.root, filepath.FromSlash(key))
+}
+
+func (l *local) TempFile(pattern string) (*os.File, error) {
+	// Temporary files are created below the root, so that importing them is an atomic rename
+	return ioutil.TempFile(filepath.Join(l.root, TempDirectory), pattern)
+}
+
+func (l *local) Import(key string, localPath string) error {
+	filePath := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0750); err != nil {
+		return err
+	}
+	if err := os.Rename(localPath, filePath); err != nil {
+		return err
+	}
+	syncDirectory(filepath.Dir(filePath))
+	return nil
+}
+
+func (l *local) Open(key string) (Object, error) {
+	file, err := os.Open(l.path(key))
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &localObject{File: file, info: info}, nil
+}
+
+func (l *local) Delete(key string) error {
+	if err := os.Remove(l.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (o *localObject) Size() int64 {
+	return o.info.Size()
+}
+
+func (o *localObject) ModTime() time.Time {
+	return o.info.ModTime()
+}
+
+/*
+syncDirectory flushes the directory entries of a directory to the disk, so that
+renamed files survive a crash. Errors are ignored, as not all platforms support it.
+*/
+func syncDirectory(directory string) {
+	if dir, err := os.Open(directory); err == nil {
+		_ = dir.Sync()
+		_ = dir.Close()
+	}
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type localTestSuite struct {
+	suite.Suite
+	root    string
+	backend Backend
+}
+
+func (suite *localTestSuite) SetupTest() {
+	var err error
+	suite.root, err = ioutil.TempDir(os.TempDir(), "")
+	suite.Require().Nil(err, "unable to create the storage path")
+	suite.backend, err = NewLocal(suite.root)
+	suite.Require().Nil(err, "unable to create the backend")
+}
+
+func (suite *localTestSuite) TearDownTest() {
+	suite.Require().Nil(os.RemoveAll(suite.root), "unable to remove the storage path")
+}
+
+func TestLocal(t *testing.T) {
+	suite.Run(t, new(localTestSuite))
+}
+
+// importContent imports the content into the backend using a temporary file
+func importContent(suite *suite.Suite, backend Backend, key string, content []byte) {
+	require := suite.Require()
+	file, err := backend.TempFile(".test-*")
+	require.Nil(err, "unable to create the temporary file")
+	_, err = file.Write(content)
+	require.Nil(err, "unable to write the temporary file")
+	require.Nil(file.Close(), "unable to close the temporary file")
+	require.Nil(backend.Import(key, file.Name()), "unable to import the file")
+	_, err = os.Stat(file.Name())
+	require.True(os.IsNotExist(err), "the temporary file has not been moved")
+}
+
+func (suite *localTestSuite) TestImportAndOpen() {
+	require := suite.Require()
+	importContent(&suite.Suite, suite.backend, "blobs/ab/abcd", []byte("content"))
+	_, err := os.Stat(filepath.Join(suite.root, "blobs", "ab", "abcd"))
+	require.Nil(err, "the file has not been stored below the root")
+
+	object, err := suite.backend.Open("blobs/ab/abcd")
+	require.Nil(err, "unable to open the object")
+	//noinspection GoUnhandledErrorResult
+	defer object.Close()
+	require.Equal(int64(7), object.Size())
+	content, err := ioutil.ReadAll(object)
+	require.Nil(err, "unable to read the object")
+	require.Equal([]byte("content"), content)
+}
+
+func (suite *localTestSuite) TestDelete() {
+	require := suite.Require()
+	importContent(&suite.Suite, suite.backend, "blobs/ab/abcd", []byte("content"))
+	require.Nil(suite.backend.Delete("blobs/ab/abcd"), "unable to delete the object")
+	_, err := suite.backend.Open("blobs/ab/abcd")
+	require.True(os.IsNotExist(err), "the object has not been deleted")
+	require.Nil(suite.backend.Delete("blobs/ab/abcd"), "deleting a missing object failed")
+}
@@ -0,0 +1,373 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat    = "20060102T150405Z"
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	// maxURLLifetime is the maximum lifetime of signed URLs supported by the signature version 4
+	maxURLLifetime = 7 * 24 * time.Hour
+	// connectTimeout limits establishing the connection to the object storage
+	connectTimeout = 10 * time.Second
+	// responseTimeout limits waiting for the response after a request has been sent completely.
+	// The transfer of the bodies is not limited, as objects might be large.
+	responseTimeout = time.Minute
+)
+
+/*
+S3Config defines the configuration of an S3 compatible object storage.
+If no credentials are configured, they are read from the environment
+variables AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+*/
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"`  // Endpoint is the URL of the service, e.g. https://s3.eu-central-1.amazonaws.com
+	Region    string `yaml:"region"`    // Region is the region of the bucket (default: us-east-1)
+	Bucket    string `yaml:"bucket"`    // Bucket is the name of the bucket to store the objects in
+	Prefix    string `yaml:"prefix"`    // Prefix is prepended to the keys of all objects
+	AccessKey string `yaml:"accessKey"` // AccessKey is the access key ID used to sign the requests
+	SecretKey string `yaml:"secretKey"` // SecretKey is the secret access key used to sign the requests
+	PathStyle bool   `yaml:"pathStyle"` // PathStyle addresses the bucket in the path instead of the host name
+}
+
+type s3 struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+	tempDir  string
+	now      func() time.Time
+}
+
+type s3Object struct {
+	io.ReadCloser
+	size    int64
+	modTime time.Time
+}
+
+/*
+NewS3 creates a backend storing the objects in a bucket of an S3 compatible object storage.
+Local temporary files are created below the storage path.
+*/
+func NewS3(cfg S3Config, storagePath string) (Backend, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("the endpoint and bucket of the S3 storage need to be configured")
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.AccessKey == "" {
+		cfg.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if cfg.SecretKey == "" {
+		cfg.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	tempDir := filepath.Join(storagePath, TempDirectory)
+	if err = os.MkdirAll(tempDir, 0750); err != nil {
+		return nil, err
+	}
+	return &s3{
+		config:   cfg,
+		endpoint: endpoint,
+		client:   newS3Client(),
+		tempDir:  tempDir,
+		now:      time.Now,
+	}, nil
+}
+
+/*
+newS3Client creates the HTTP client used to access the object storage.
+It does not hang forever, if the object storage does not answer.
+*/
+func newS3Client() *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: responseTimeout,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+	}}
+}
+
+/*
+objectURL returns the URL of the object with the given key.
+*/
+func (s *s3) objectURL(key string) *url.URL {
+	objectKey := path.Join(s.config.Prefix, key)
+	result := *s.endpoint
+	basePath := strings.TrimSuffix(result.Path, "/")
+	if s.config.PathStyle {
+		result.Path = basePath + "/" + s.config.Bucket + "/" + objectKey
+		result.RawPath = basePath + "/" + uriEncode(s.config.Bucket, true) + "/" + uriEncode(objectKey, false)
+	} else {
+		result.Host = s.config.Bucket + "." + result.Host
+		result.Path = basePath + "/" + objectKey
+		result.RawPath = basePath + "/" + uriEncode(objectKey, false)
+	}
+	return &result
+}
+
+/*
+send signs and sends a request for the object with the given key.
+*/
+func (s *s3) send(method string, key string, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	request, err := http.NewRequest(method, s.objectURL(key).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		request.ContentLength = size
+	}
+	s.sign(request, payloadHash, s.now())
+	return s.client.Do(request)
+}
+
+/*
+responseError creates an error describing an unexpected response of the storage.
+*/
+func responseError(key string, response *http.Response) error {
+	message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	return fmt.Errorf("unexpected response for '%s' from the S3 storage: %s %s",
+		key, response.Status, strings.TrimSpace(string(message)))
+}
+
+func (s *s3) TempFile(pattern string) (*os.File, error) {
+	return ioutil.TempFile(s.tempDir, pattern)
+}
+
+func (s *s3) Import(key string, localPath string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	hashBuilder := sha256.New()
+	if _, err = io.Copy(hashBuilder, file); err != nil {
+		return err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	response, err := s.send(http.MethodPut, key, file, info.Size(), hex.EncodeToString(hashBuilder.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return responseError(key, response)
+	}
+	return os.Remove(localPath)
+}
+
+func (s *s3) Open(key string) (Object, error) {
+	response, err := s.send(http.MethodGet, key, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	switch response.StatusCode {
+	case http.StatusOK:
+		modTime, _ := http.ParseTime(response.Header.Get("Last-Modified"))
+		return &s3Object{ReadCloser: response.Body, size: response.ContentLength, modTime: modTime}, nil
+	case http.StatusNotFound:
+		_ = response.Body.Close()
+		return nil, &os.PathError{Op: "open", Path: key, Err: os.ErrNotExist}
+	default:
+		//noinspection GoUnhandledErrorResult
+		defer response.Body.Close()
+		return nil, responseError(key, response)
+	}
+}
+
+func (s *s3) Delete(key string) error {
+	response, err := s.send(http.MethodDelete, key, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	default:
+		return responseError(key, response)
+	}
+}
+
+func (o *s3Object) Size() int64 {
+	return o.size
+}
+
+func (o *s3Object) ModTime() time.Time {
+	return o.modTime
+}
+
+// emptyPayloadHash is the sha256 hex digest of an empty request body
+var emptyPayloadHash = hex.EncodeToString(sha256.New().Sum(nil))
+
+/*
+uriEncode encodes a string as defined by the AWS signature version 4.
+All characters except the unreserved ones are percent encoded.
+*/
+func uriEncode(value string, encodeSlash bool) string {
+	var result strings.Builder
+	for _, b := range []byte(value) {
+		if 'A' <= b && b <= 'Z' || 'a' <= b && b <= 'z' || '0' <= b && b <= '9' ||
+			b == '-' || b == '_' || b == '.' || b == '~' || b == '/' && !encodeSlash {
+			result.WriteByte(b)
+		} else {
+			_, _ = fmt.Fprintf(&result, "%%%02X", b)
+		}
+	}
+	return result.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+/*
+canonicalRequest creates the canonical request of the AWS signature version 4.
+All headers of the request and the host are signed.
+It returns the canonical request and the names of the signed headers.
+*/
+func canonicalRequest(request *http.Request, payloadHash string) (string, string) {
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	return strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		canonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n"), signedHeaders
+}
+
+/*
+canonicalQuery creates the canonical query string of the AWS signature version 4.
+*/
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parameters []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			parameters = append(parameters, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(parameters, "&")
+}
+
+/*
+signature calculates the signature of the canonical request at the given time.
+It returns the credential scope and the signature.
+*/
+func (s *s3) signature(canonical string, now time.Time) (string, string) {
+	amzDate := now.UTC().Format(amzDateFormat)
+	date := amzDate[:8]
+	scope := date + "/" + s.config.Region + "/s3/aws4_request"
+	hashedRequest := sha256.Sum256([]byte(canonical))
+	stringToSign := signingAlgorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashedRequest[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretKey), date)
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return scope, hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+/*
+sign adds the authorization header of the AWS signature version 4 to the request.
+*/
+func (s *s3) sign(request *http.Request, payloadHash string, now time.Time) {
+	request.Header.Set("X-Amz-Date", now.UTC().Format(amzDateFormat))
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	canonical, signedHeaders := canonicalRequest(request, payloadHash)
+	scope, signature := s.signature(canonical, now)
+	request.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signingAlgorithm, s.config.AccessKey, scope, signedHeaders, signature))
+}
+
+func (s *s3) SignedURL(key string, fileName string, lifetime time.Duration) (string, error) {
+	if lifetime <= 0 || lifetime > maxURLLifetime {
+		return "", fmt.Errorf("the lifetime of signed URLs needs to be between 1s and %s", maxURLLifetime)
+	}
+	objectURL := s.objectURL(key)
+	query := url.Values{}
+	if fileName != "" {
+		query.Set("response-content-disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
+	}
+	return s.presign(objectURL, query, lifetime, s.now())
+}
+
+func (s *s3) MaxURLLifetime() time.Duration {
+	return maxURLLifetime
+}
+
+/*
+presign signs the URL using query parameters as defined by the AWS signature version 4.
+Additional query parameters are signed as well.
+*/
+func (s *s3) presign(objectURL *url.URL, query url.Values, lifetime time.Duration, now time.Time) (string, error) {
+	amzDate := now.UTC().Format(amzDateFormat)
+	query.Set("X-Amz-Algorithm", signingAlgorithm)
+	query.Set("X-Amz-Credential", s.config.AccessKey+"/"+amzDate[:8]+"/"+s.config.Region+"/s3/aws4_request")
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(lifetime/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+	objectURL.RawQuery = canonicalQuery(query)
+
+	request, err := http.NewRequest(http.MethodGet, objectURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	canonical, _ := canonicalRequest(request, unsignedPayload)
+	_, signature := s.signature(canonical, now)
+	return objectURL.String() + "&X-Amz-Signature=" + signature, nil
+}
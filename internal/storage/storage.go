@@ -0,0 +1,83 @@
+/*
+Package storage implements the backends storing the contents of the files in the GoatCheese shop.
+
+Files are stored as objects identified by slash separated keys. Contents are always
+written to a local temporary file first, which is imported into the backend as a
+whole. Thus, objects are never visible partially written.
+*/
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+/*
+Backend defines the interface of a storage backend.
+*/
+type Backend interface {
+	// TempFile creates a new local temporary file, which can be imported into the backend
+	TempFile(pattern string) (*os.File, error)
+	// Import moves the local file into the backend, replacing the object with the given key
+	Import(key string, localPath string) error
+	// Open opens the object with the given key for reading. Missing objects satisfy os.IsNotExist.
+	Open(key string) (Object, error)
+	// Delete deletes the object with the given key. Missing objects are ignored.
+	Delete(key string) error
+}
+
+/*
+Object is an object opened for reading.
+If the backend supports it, objects implement io.Seeker and io.ReaderAt as well.
+*/
+type Object interface {
+	io.ReadCloser
+	Size() int64        // Size returns the size of the object in bytes, or -1 if it is unknown
+	ModTime() time.Time // ModTime returns the time the object has been modified last
+}
+
+/*
+Signer is implemented by backends able to create time-limited URLs granting read access to objects.
+*/
+type Signer interface {
+	// SignedURL returns a URL to download the object with the given key, which is valid for the given
+	// lifetime. The downloaded object is named by the file name.
+	SignedURL(key string, fileName string, lifetime time.Duration) (string, error)
+	// MaxURLLifetime returns the maximum lifetime of signed URLs supported by the backend
+	MaxURLLifetime() time.Duration
+}
+
+/*
+Config defines the configuration of the storage backend.
+*/
+type Config struct {
+	Type string   `yaml:"type"` // Type is either "local" (default) or "s3"
+	S3   S3Config `yaml:"s3"`
+	// Redirect answers download requests with a redirect to a signed URL of the backend
+	Redirect bool `yaml:"redirect"`
+	// RedirectLifetime is the time in seconds signed URLs are valid for
+	RedirectLifetime int `yaml:"redirectLifetime"`
+}
+
+// DefaultRedirectLifetime is the time signed URLs are valid for, if no other lifetime is configured
+const DefaultRedirectLifetime = 5 * time.Minute
+
+// TempDirectory is the directory in the storage path containing the temporary files
+const TempDirectory = "tmp"
+
+/*
+New creates the storage backend defined by the configuration.
+Local temporary files are created below the storage path.
+*/
+func New(cfg Config, storagePath string) (Backend, error) {
+	switch cfg.Type {
+	case "", "local":
+		return NewLocal(storagePath)
+	case "s3":
+		return NewS3(cfg.S3, storagePath)
+	default:
+		return nil, fmt.Errorf("unknown storage type '%s'", cfg.Type)
+	}
+}
@@ -0,0 +1,19 @@
+package testutil
+
+import (
+	"archive/zip"
+	"bytes"
+)
+
+// Wheel creates a wheel of the project and version containing the given additional metadata headers
+func Wheel(name string, version string, headers ...string) []byte {
+	buffer := &bytes.Buffer{}
+	writer := zip.NewWriter(buffer)
+	file, _ := writer.Create(name + "-" + version + ".dist-info/METADATA")
+	_, _ = file.Write([]byte("Metadata-Version: 2.1\nName: " + name + "\nVersion: " + version + "\n"))
+	for _, header := range headers {
+		_, _ = file.Write([]byte(header + "\n"))
+	}
+	_ = writer.Close()
+	return buffer.Bytes()
+}
@@ -0,0 +1,124 @@
+package web
+
+import (
+	"fmt"
+	"github.com/hansingt/GoatCheese/internal/datastore"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+const (
+	userContextKey = "user"
+	realm          = `Basic realm="GoatCheese"`
+)
+
+/*
+authenticate returns a middleware, which authenticates users sending HTTP basic
+authentication credentials. Requests without credentials are processed anonymously.
+*/
+func authenticate(db datastore.Datastore) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			userName, secret, ok := ctx.Request().BasicAuth()
+			if !ok {
+				return next(ctx)
+			}
+			user, err := db.Authenticate(userName, secret)
+			if err == datastore.ErrInvalidCredentials {
+				ctx.Response().Header().Set(echo.HeaderWWWAuthenticate, realm)
+				return &echo.HTTPError{
+					Code:    http.StatusUnauthorized,
+					Message: err.Error(),
+				}
+			} else if err != nil {
+				return &echo.HTTPError{
+					Code:     http.StatusInternalServerError,
+					Message:  err.Error(),
+					Internal: err,
+				}
+			}
+			ctx.Set(userContextKey, user)
+			return next(ctx)
+		}
+	}
+}
+
+/*
+currentUser returns the name of the authenticated user, or an empty string for anonymous users.
+*/
+func currentUser(ctx echo.Context) string {
+	if user, ok := ctx.Get(userContextKey).(string); ok {
+		return user
+	}
+	return ""
+}
+
+/*
+authorize checks, whether the current user has the given permission on the repository.
+Anonymous users are asked to authenticate, while authenticated users are denied access.
+*/
+func authorize(ctx echo.Context, repo datastore.Repository, permission datastore.Permission) error {
+	user := currentUser(ctx)
+	allowed, err := repo.IsAllowed(user, permission)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  err.Error(),
+			Internal: err,
+		}
+	} else if allowed {
+		return nil
+	} else if user == "" {
+		ctx.Response().Header().Set(echo.HeaderWWWAuthenticate, realm)
+		return &echo.HTTPError{
+			Code:    http.StatusUnauthorized,
+			Message: fmt.Sprintf("authentication required for %s access to '%s'", permission, repo.Name()),
+		}
+	}
+	return &echo.HTTPError{
+		Code:    http.StatusForbidden,
+		Message: fmt.Sprintf("user '%s' has no %s access to '%s'", user, permission, repo.Name()),
+	}
+}
+
+/*
+requirePermission returns a middleware, which ensures the current user has the given permission
+on the repository addressed by the request.
+*/
+func requirePermission(permission datastore.Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			repo, err := contextRepository(ctx)
+			if err != nil {
+				return err
+			} else if err = authorize(ctx, repo, permission); err != nil {
+				return err
+			}
+			return next(ctx)
+		}
+	}
+}
+
+/*
+requireAdmin returns a middleware, which ensures the current user is allowed to manage the repositories.
+*/
+func requireAdmin(db datastore.Datastore) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			user := currentUser(ctx)
+			if db.IsAdmin(user) {
+				return next(ctx)
+			} else if user == "" {
+				ctx.Response().Header().Set(echo.HeaderWWWAuthenticate, realm)
+				return &echo.HTTPError{
+					Code:    http.StatusUnauthorized,
+					Message: "authentication required to manage the indexes",
+				}
+			}
+			return &echo.HTTPError{
+				Code:    http.StatusForbidden,
+				Message: fmt.Sprintf("user '%s' is not allowed to manage the indexes", user),
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/hansingt/GoatCheese/internal/testutil"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"testing"
+)
+
+type authTestSuite struct {
+	TestSuiteWithServer
+}
+
+func TestAuth(t *testing.T) {
+	suite.Run(t, new(authTestSuite))
+}
+
+func (suite *authTestSuite) SetupTest() {
+	password, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	suite.Require().Nil(err, "unable to hash the password")
+	token := sha256.Sum256([]byte("pypi-token"))
+	suite.extraConfiguration = `
+users:
+  - name: "alice"
+    password: "` + string(password) + `"
+  - name: "bob"
+    tokens: ["` + hex.EncodeToString(token[:]) + `"]
+`
+	suite.indexes = `
+  - name: "base"
+    bases: []
+    permissions:
+      read: ["*"]
+      upload: ["alice"]
+  - name: "private"
+    bases: []
+    permissions:
+      read: ["bob"]
+  - name: "test"
+    bases: ["base"]
+`
+	suite.TestSuiteWithServer.SetupTest()
+}
+
+func (suite *authTestSuite) TestInvalidCredentials() {
+	require := suite.Require()
+	response := suite.request(http.MethodGet, "/base/", basicAuth("alice", "wrong"))
+	require.Equal(http.StatusUnauthorized, response.Code)
+	require.NotEmpty(response.Header().Get(echo.HeaderWWWAuthenticate))
+}
+
+func (suite *authTestSuite) TestRead() {
+	require := suite.Require()
+	require.Equal(http.StatusOK, suite.request(http.MethodGet, "/base/", nil).Code)
+	require.Equal(http.StatusUnauthorized, suite.request(http.MethodGet, "/private/", nil).Code)
+	require.Equal(http.StatusForbidden, suite.request(http.MethodGet, "/private/", basicAuth("alice", "secret")).Code)
+	require.Equal(http.StatusOK, suite.request(http.MethodGet, "/private/", basicAuth("__token__", "pypi-token")).Code)
+
+	// The root view lists only readable repositories
+	body := suite.request(http.MethodGet, "/", nil).Body.String()
+	require.Contains(body, "/base/")
+	require.NotContains(body, "/private/")
+}
+
+func (suite *authTestSuite) TestUpload() {
+	require := suite.Require()
+	fields := map[string]string{"name": "fuubar"}
+	content := testutil.Wheel("fuubar", "1.0")
+
+	response := suite.upload("base", fields, "fuubar-1.0-py3-none-any.whl", content, nil)
+	require.Equal(http.StatusUnauthorized, response.Code)
+	require.NotEmpty(response.Header().Get(echo.HeaderWWWAuthenticate))
+
+	response = suite.upload("base", fields, "fuubar-1.0-py3-none-any.whl", content, basicAuth("__token__", "pypi-token"))
+	require.Equal(http.StatusForbidden, response.Code)
+	require.Contains(response.Body.String(), "user 'bob' has no upload access to 'base'")
+
+	response = suite.upload("base", fields, "fuubar-1.0-py3-none-any.whl", content, basicAuth("alice", "secret"))
+	require.Equal(http.StatusOK, response.Code)
+}
+
+func (suite *authTestSuite) TestDefaultPermissions() {
+	response := suite.upload("test", map[string]string{"name": "fuubar"}, "fuubar-1.0-py3-none-any.whl", testutil.Wheel("fuubar", "1.0"), nil)
+	suite.Require().Equal(http.StatusOK, response.Code)
+}
@@ -0,0 +1,82 @@
+package web
+
+import (
+	"github.com/hansingt/GoatCheese/internal/datastore"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+/*
+deleted answers a delete request depending on the error returned by the deletion.
+*/
+func deleted(ctx echo.Context, err error) error {
+	if err == datastore.ErrLocked {
+		return &echo.HTTPError{
+			Code:     http.StatusConflict,
+			Message:  err.Error(),
+			Internal: err,
+		}
+	} else if err == datastore.ErrImmutable {
+		return &echo.HTTPError{
+			Code:     http.StatusForbidden,
+			Message:  err.Error(),
+			Internal: err,
+		}
+	} else if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  err.Error(),
+			Internal: err,
+		}
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+/*
+deleteProjectView deletes a project including all of its releases and files.
+*/
+func deleteProjectView(repo datastore.Repository) func(ctx echo.Context) error {
+	return func(ctx echo.Context) error {
+		project, err := apiProject(repo, ctx)
+		if err != nil {
+			return err
+		}
+		return deleted(ctx, project.Delete())
+	}
+}
+
+/*
+deleteReleaseView deletes a release of a project including all of its files.
+*/
+func deleteReleaseView(repo datastore.Repository) func(ctx echo.Context) error {
+	return func(ctx echo.Context) error {
+		project, err := apiProject(repo, ctx)
+		if err != nil {
+			return err
+		}
+		release, err := apiRelease(project, ctx)
+		if err != nil {
+			return err
+		}
+		return deleted(ctx, release.Delete())
+	}
+}
+
+/*
+deleteFileView deletes a single file of a project.
+*/
+func deleteFileView(repo datastore.Repository) func(ctx echo.Context) error {
+	return func(ctx echo.Context) error {
+		project, err := apiProject(repo, ctx)
+		if err != nil {
+			return err
+		}
+		file, err := apiFile(project, ctx)
+		if err != nil {
+			return err
+		} else if file.IsLocked() {
+			return deleted(ctx, datastore.ErrLocked)
+		}
+		return deleted(ctx, file.Delete())
+	}
+}
@@ -0,0 +1,124 @@
+package web
+
+import (
+	"github.com/hansingt/GoatCheese/internal/datastore"
+	"github.com/hansingt/GoatCheese/internal/testutil"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"os"
+	"testing"
+)
+
+type deleteTestSuite struct {
+	TestSuiteWithAdmin
+}
+
+func TestDelete(t *testing.T) {
+	suite.Run(t, new(deleteTestSuite))
+}
+
+func (suite *deleteTestSuite) SetupTest() {
+	suite.TestSuiteWithAdmin.SetupTest()
+	for _, version := range []string{"1.0", "2.0"} {
+		response := suite.upload("base", map[string]string{"name": "fuubar"},
+			"fuubar-"+version+"-py3-none-any.whl", testutil.Wheel("fuubar", version), nil)
+		suite.Require().Equal(http.StatusOK, response.Code, response.Body.String())
+	}
+}
+
+// file returns a file of the project fuubar
+func (suite *deleteTestSuite) file(fileName string) datastore.ProjectFile {
+	repo, err := suite.db.GetRepository("base")
+	suite.Require().Nil(err, "unable to get the repository")
+	project, err := repo.GetProject("fuubar")
+	suite.Require().Nil(err, "unable to get the project")
+	file, err := project.GetFile(fileName)
+	suite.Require().Nil(err, "unable to get the file")
+	return file
+}
+
+func (suite *deleteTestSuite) TestRequiresAdmin() {
+	response := suite.request(http.MethodDelete, "/base/+api/projects/fuubar/", nil)
+	suite.Require().Equal(http.StatusUnauthorized, response.Code)
+}
+
+func (suite *deleteTestSuite) TestDeleteFile() {
+	require := suite.Require()
+	file := suite.file("fuubar-1.0-py3-none-any.whl")
+	response := suite.send(http.MethodDelete, "/base/+api/projects/fuubar/files/fuubar-1.0-py3-none-any.whl", "")
+	require.Equal(http.StatusNoContent, response.Code, response.Body.String())
+	_, err := file.Open()
+	require.True(os.IsNotExist(err), "the file has not been removed from the disk")
+
+	body := suite.request(http.MethodGet, "/base/fuubar/", nil).Body.String()
+	require.NotContains(body, "fuubar-1.0-py3-none-any.whl")
+	require.Contains(body, "fuubar-2.0-py3-none-any.whl")
+
+	response = suite.send(http.MethodDelete, "/base/+api/projects/fuubar/files/fuubar-1.0-py3-none-any.whl", "")
+	require.Equal(http.StatusNotFound, response.Code)
+}
+
+func (suite *deleteTestSuite) TestDeleteRelease() {
+	require := suite.Require()
+	file := suite.file("fuubar-2.0-py3-none-any.whl")
+	response := suite.send(http.MethodDelete, "/base/+api/projects/fuubar/releases/2.0", "")
+	require.Equal(http.StatusNoContent, response.Code, response.Body.String())
+	_, err := file.Open()
+	require.True(os.IsNotExist(err), "the file has not been removed from the disk")
+
+	body := suite.request(http.MethodGet, "/base/fuubar/", nil).Body.String()
+	require.Contains(body, "fuubar-1.0-py3-none-any.whl")
+	require.NotContains(body, "fuubar-2.0-py3-none-any.whl")
+
+	// The release can be uploaded again
+	response = suite.upload("base", map[string]string{"name": "fuubar"},
+		"fuubar-2.0-py3-none-any.whl", testutil.Wheel("fuubar", "2.0"), nil)
+	require.Equal(http.StatusOK, response.Code, response.Body.String())
+}
+
+func (suite *deleteTestSuite) TestDeleteProject() {
+	require := suite.Require()
+	file := suite.file("fuubar-2.0-py3-none-any.whl")
+	response := suite.send(http.MethodDelete, "/base/+api/projects/fuubar/", "")
+	require.Equal(http.StatusNoContent, response.Code, response.Body.String())
+	_, err := file.Open()
+	require.True(os.IsNotExist(err), "the file has not been removed from the disk")
+	require.NotContains(suite.request(http.MethodGet, "/base/", nil).Body.String(), "fuubar")
+}
+
+func (suite *deleteTestSuite) TestDeleteLocked() {
+	require := suite.Require()
+	repo, err := suite.db.GetRepository("base")
+	require.Nil(err, "unable to get the repository")
+	project, err := repo.GetProject("fuubar")
+	require.Nil(err, "unable to get the project")
+	file, err := project.GetFile("fuubar-1.0-py3-none-any.whl")
+	require.Nil(err, "unable to get the file")
+	require.Nil(file.Lock(), "unable to lock the file")
+
+	response := suite.send(http.MethodDelete, "/base/+api/projects/fuubar/files/fuubar-1.0-py3-none-any.whl", "")
+	require.Equal(http.StatusConflict, response.Code)
+	response = suite.send(http.MethodDelete, "/base/+api/projects/fuubar/releases/1.0", "")
+	require.Equal(http.StatusConflict, response.Code)
+	response = suite.send(http.MethodDelete, "/base/+api/projects/fuubar/", "")
+	require.Equal(http.StatusConflict, response.Code)
+	object, err := file.Open()
+	require.Nil(err, "the locked file has been removed")
+	require.Nil(object.Close(), "unable to close the file")
+}
+
+func (suite *deleteTestSuite) TestImmutable() {
+	require := suite.Require()
+	repo, err := suite.db.GetRepository("base")
+	require.Nil(err, "unable to get the repository")
+	require.Nil(repo.SetVolatile(false), "unable to make the repository immutable")
+	for _, path := range []string{
+		"/base/+api/projects/fuubar/files/fuubar-1.0-py3-none-any.whl",
+		"/base/+api/projects/fuubar/releases/1.0",
+		"/base/+api/projects/fuubar/",
+	} {
+		response := suite.send(http.MethodDelete, path, "")
+		require.Equal(http.StatusForbidden, response.Code, "'%s' has been deleted from an immutable repository", path)
+	}
+	require.NotNil(suite.file("fuubar-1.0-py3-none-any.whl"), "the file has been deleted")
+}
@@ -0,0 +1,171 @@
+package web
+
+import (
+	"github.com/hansingt/GoatCheese/internal/datastore"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strings"
+)
+
+/*
+indexPermissions lists the users granted each permission on an index.
+*/
+type indexPermissions struct {
+	Read   []string `json:"read"`
+	Upload []string `json:"upload"`
+	Admin  []string `json:"admin"`
+}
+
+/*
+indexRequest is the body of requests to create or update an index.
+When updating an index, missing fields are left unchanged. The permissions are only
+applied to new indexes.
+*/
+type indexRequest struct {
+	Name        string            `json:"name"`
+	Bases       []string          `json:"bases"`
+	Permissions *indexPermissions `json:"permissions"`
+}
+
+/*
+indexDescription describes an index in the responses of the index management API.
+*/
+type indexDescription struct {
+	Name  string   `json:"name"`
+	Bases []string `json:"bases"` // Bases are the names of the base indexes followed by the URLs of the remote ones
+}
+
+/*
+managementError converts the errors of the index management into HTTP errors.
+*/
+func managementError(err error) error {
+	if _, invalid := err.(*datastore.ConfigurationError); invalid {
+		return &echo.HTTPError{
+			Code:     http.StatusBadRequest,
+			Message:  err.Error(),
+			Internal: err,
+		}
+	}
+	switch err {
+	case datastore.ErrRepositoryNotFound:
+		return &echo.HTTPError{
+			Code:     http.StatusNotFound,
+			Message:  err.Error(),
+			Internal: err,
+		}
+	case datastore.ErrRepositoryExists, datastore.ErrRepositoryConfigured, datastore.ErrRepositoryInUse, datastore.ErrLocked:
+		return &echo.HTTPError{
+			Code:     http.StatusConflict,
+			Message:  err.Error(),
+			Internal: err,
+		}
+	case datastore.ErrImmutable:
+		return &echo.HTTPError{
+			Code:     http.StatusForbidden,
+			Message:  err.Error(),
+			Internal: err,
+		}
+	default:
+		return &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  err.Error(),
+			Internal: err,
+		}
+	}
+}
+
+/*
+indexName returns the name of the index given in the request path.
+*/
+func indexName(ctx echo.Context) string {
+	return strings.Trim(ctx.Param("*"), "/")
+}
+
+/*
+describeIndex answers a request with the description of the index with the given name.
+*/
+func describeIndex(ctx echo.Context, db datastore.Datastore, repositoryName string, code int) error {
+	repo, err := db.GetRepository(repositoryName)
+	if err != nil {
+		return managementError(err)
+	}
+	bases, err := repo.Bases()
+	if err != nil {
+		return managementError(err)
+	}
+	remotes, err := repo.RemoteBases()
+	if err != nil {
+		return managementError(err)
+	}
+	description := indexDescription{Name: repo.Name(), Bases: make([]string, 0, len(bases)+len(remotes))}
+	for _, base := range bases {
+		description.Bases = append(description.Bases, base.Name())
+	}
+	description.Bases = append(description.Bases, remotes...)
+	return ctx.JSON(code, description)
+}
+
+/*
+indexView describes an index.
+*/
+func indexView(db datastore.Datastore) func(ctx echo.Context) error {
+	return func(ctx echo.Context) error {
+		return describeIndex(ctx, db, indexName(ctx), http.StatusOK)
+	}
+}
+
+/*
+createIndexView creates a new index. Without permissions, the defaults of the configuration file apply.
+*/
+func createIndexView(db datastore.Datastore) func(ctx echo.Context) error {
+	return func(ctx echo.Context) error {
+		var request indexRequest
+		if err := ctx.Bind(&request); err != nil {
+			return err
+		}
+		var permissions map[datastore.Permission][]string
+		if request.Permissions != nil {
+			permissions = map[datastore.Permission][]string{
+				datastore.PermissionRead:   request.Permissions.Read,
+				datastore.PermissionUpload: request.Permissions.Upload,
+				datastore.PermissionAdmin:  request.Permissions.Admin,
+			}
+		}
+		repo, err := db.CreateRepository(request.Name, request.Bases, permissions)
+		if err != nil {
+			return managementError(err)
+		}
+		return describeIndex(ctx, db, repo.Name(), http.StatusCreated)
+	}
+}
+
+/*
+updateIndexView renames an index or replaces its bases.
+*/
+func updateIndexView(db datastore.Datastore) func(ctx echo.Context) error {
+	return func(ctx echo.Context) error {
+		var request indexRequest
+		if err := ctx.Bind(&request); err != nil {
+			return err
+		}
+		repositoryName := indexName(ctx)
+		if err := db.UpdateRepository(repositoryName, request.Name, request.Bases); err != nil {
+			return managementError(err)
+		} else if request.Name != "" {
+			repositoryName = request.Name
+		}
+		return describeIndex(ctx, db, repositoryName, http.StatusOK)
+	}
+}
+
+/*
+deleteIndexView deletes an index including all of its projects.
+*/
+func deleteIndexView(db datastore.Datastore) func(ctx echo.Context) error {
+	return func(ctx echo.Context) error {
+		if err := db.DeleteRepository(indexName(ctx)); err != nil {
+			return managementError(err)
+		}
+		return ctx.NoContent(http.StatusNoContent)
+	}
+}
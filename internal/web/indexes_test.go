@@ -0,0 +1,128 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/hansingt/GoatCheese/internal/testutil"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"testing"
+)
+
+type indexesTestSuite struct {
+	TestSuiteWithAdmin
+}
+
+func TestIndexes(t *testing.T) {
+	suite.Run(t, new(indexesTestSuite))
+}
+
+// requireIndex checks the description of an index returned by the API
+func (suite *indexesTestSuite) requireIndex(code int, name string, bases []string, method string, path string, body string) {
+	require := suite.Require()
+	response := suite.send(method, path, body)
+	require.Equal(code, response.Code, response.Body.String())
+	var description indexDescription
+	require.Nil(json.Unmarshal(response.Body.Bytes(), &description), "unable to decode the description")
+	require.Equal(name, description.Name, "the name of the index differs")
+	require.Equal(bases, description.Bases, "the bases of the index differ")
+}
+
+func (suite *indexesTestSuite) TestCreate() {
+	require := suite.Require()
+	file := suite.addFile("base", "fuubar", "fuubar-1.0.tar.gz")
+	suite.requireIndex(http.StatusCreated, "team/app", []string{"base"},
+		http.MethodPost, "/+api/indexes/", `{"name": "team/app", "bases": ["base"]}`)
+	suite.requireIndex(http.StatusOK, "team/app", []string{"base"}, http.MethodGet, "/+api/indexes/team/app", "")
+
+	// The new index is served without a restart
+	response := suite.request(http.MethodGet, "/team/app/", nil)
+	require.Equal(http.StatusOK, response.Code, response.Body.String())
+	require.Contains(response.Body.String(), "/team/app/fuubar/")
+	response = suite.request(http.MethodGet, "/team/app/fuubar/", nil)
+	require.Equal(http.StatusOK, response.Code, response.Body.String())
+	require.Contains(response.Body.String(), fileURL("base", "fuubar", file))
+	response = suite.upload("team/app", map[string]string{"name": "other"}, "other-1.0-py3-none-any.whl", testutil.Wheel("other", "1.0"), nil)
+	require.Equal(http.StatusOK, response.Code, response.Body.String())
+	response = suite.request(http.MethodGet, "/team/app/other/", nil)
+	require.Equal(http.StatusOK, response.Code, response.Body.String())
+
+	response = suite.send(http.MethodPost, "/+api/indexes/", `{"name": "team/app"}`)
+	require.Equal(http.StatusConflict, response.Code, "an existing index has been created again")
+	response = suite.send(http.MethodPost, "/+api/indexes/", `{"name": "+team"}`)
+	require.Equal(http.StatusBadRequest, response.Code, "an invalid name has been accepted")
+	response = suite.send(http.MethodPost, "/+api/indexes/", `{"name": "team", "bases": ["undefined"]}`)
+	require.Equal(http.StatusBadRequest, response.Code, "an undefined base has been accepted")
+}
+
+func (suite *indexesTestSuite) TestCreateWithPermissions() {
+	require := suite.Require()
+	response := suite.send(http.MethodPost, "/+api/indexes/",
+		`{"name": "private", "permissions": {"read": ["admin"], "upload": ["admin"], "admin": ["admin"]}}`)
+	require.Equal(http.StatusCreated, response.Code, response.Body.String())
+	response = suite.request(http.MethodGet, "/private/", nil)
+	require.Equal(http.StatusUnauthorized, response.Code, "the permissions have not been applied")
+	response = suite.request(http.MethodGet, "/private/", basicAuth("admin", "secret"))
+	require.Equal(http.StatusOK, response.Code, response.Body.String())
+}
+
+func (suite *indexesTestSuite) TestRename() {
+	require := suite.Require()
+	require.Equal(http.StatusCreated, suite.send(http.MethodPost, "/+api/indexes/", `{"name": "app"}`).Code)
+	suite.addFile("app", "fuubar", "fuubar-1.0.tar.gz")
+	suite.requireIndex(http.StatusOK, "apps/app", []string{}, http.MethodPatch, "/+api/indexes/app", `{"name": "apps/app"}`)
+
+	response := suite.request(http.MethodGet, "/app/fuubar/", nil)
+	require.Equal(http.StatusNotFound, response.Code, "the index is still served by its old name")
+	response = suite.request(http.MethodGet, "/apps/app/fuubar/", nil)
+	require.Equal(http.StatusOK, response.Code, "the index is not served by its new name")
+
+	response = suite.send(http.MethodPatch, "/+api/indexes/base", `{"name": "other"}`)
+	require.Equal(http.StatusConflict, response.Code, "an index of the configuration file has been renamed")
+	response = suite.send(http.MethodPatch, "/+api/indexes/app", `{"name": "other"}`)
+	require.Equal(http.StatusNotFound, response.Code, "a missing index has been renamed")
+
+	// The bases are kept, if the index can not be renamed
+	require.Equal(http.StatusCreated, suite.send(http.MethodPost, "/+api/indexes/", `{"name": "team"}`).Code)
+	response = suite.send(http.MethodPatch, "/+api/indexes/apps/app", `{"name": "team", "bases": ["base"]}`)
+	require.Equal(http.StatusConflict, response.Code, "an existing index has been replaced")
+	suite.requireIndex(http.StatusOK, "apps/app", []string{}, http.MethodGet, "/+api/indexes/apps/app", "")
+}
+
+func (suite *indexesTestSuite) TestRebase() {
+	require := suite.Require()
+	suite.addFile("base", "fuubar", "fuubar-1.0.tar.gz")
+	require.Equal(http.StatusCreated, suite.send(http.MethodPost, "/+api/indexes/", `{"name": "app"}`).Code)
+	require.Equal(http.StatusCreated, suite.send(http.MethodPost, "/+api/indexes/", `{"name": "team", "bases": ["app"]}`).Code)
+	response := suite.request(http.MethodGet, "/team/fuubar/", nil)
+	require.Equal(http.StatusMovedPermanently, response.Code, "a project of an unrelated index has been found")
+
+	suite.requireIndex(http.StatusOK, "app", []string{"base"}, http.MethodPatch, "/+api/indexes/app", `{"bases": ["base"]}`)
+	response = suite.request(http.MethodGet, "/team/fuubar/", nil)
+	require.Equal(http.StatusOK, response.Code, "the project of the new base has not been found")
+
+	response = suite.send(http.MethodPatch, "/+api/indexes/app", `{"bases": ["team"]}`)
+	require.Equal(http.StatusBadRequest, response.Code, "an inheritance cycle has been accepted")
+	require.Contains(response.Body.String(), "inheritance cycle")
+}
+
+func (suite *indexesTestSuite) TestDelete() {
+	require := suite.Require()
+	require.Equal(http.StatusCreated, suite.send(http.MethodPost, "/+api/indexes/", `{"name": "app"}`).Code)
+	require.Equal(http.StatusCreated, suite.send(http.MethodPost, "/+api/indexes/", `{"name": "team", "bases": ["app"]}`).Code)
+	suite.addFile("app", "fuubar", "fuubar-1.0.tar.gz")
+
+	require.Equal(http.StatusConflict, suite.send(http.MethodDelete, "/+api/indexes/app", "").Code, "a base has been deleted")
+	require.Equal(http.StatusNoContent, suite.send(http.MethodDelete, "/+api/indexes/team", "").Code)
+	require.Equal(http.StatusNoContent, suite.send(http.MethodDelete, "/+api/indexes/app", "").Code)
+	require.Equal(http.StatusNotFound, suite.request(http.MethodGet, "/app/", nil).Code, "the deleted index is still served")
+	require.Equal(http.StatusNotFound, suite.send(http.MethodDelete, "/+api/indexes/app", "").Code)
+	require.Equal(http.StatusConflict, suite.send(http.MethodDelete, "/+api/indexes/base", "").Code,
+		"an index of the configuration file has been deleted")
+}
+
+func (suite *indexesTestSuite) TestRequiresAdmin() {
+	require := suite.Require()
+	response := suite.request(http.MethodDelete, "/+api/indexes/base", nil)
+	require.Equal(http.StatusUnauthorized, response.Code, "an anonymous user has managed the indexes")
+	require.NotEmpty(response.Header().Get("WWW-Authenticate"), "no authentication has been requested")
+}
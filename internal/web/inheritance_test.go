@@ -0,0 +1,120 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hansingt/GoatCheese/internal/datastore"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"testing"
+)
+
+type inheritanceTestSuite struct {
+	TestSuiteWithServer
+}
+
+func TestInheritance(t *testing.T) {
+	suite.Run(t, new(inheritanceTestSuite))
+}
+
+func (suite *inheritanceTestSuite) SetupTest() {
+	suite.indexes = defaultIndexes + `
+  - name: "team"
+    bases: ["test"]
+  - name: "merged"
+    bases: ["base"]
+    shadowing: "merge"
+  - name: "private"
+    bases: []
+    permissions:
+      read: ["nobody"]
+  - name: "public"
+    bases: ["private"]
+    permissions:
+      read: ["*"]
+`
+	suite.TestSuiteWithServer.SetupTest()
+}
+
+// fileURL returns the path of the file served by the given repository
+func fileURL(repositoryName string, projectName string, file datastore.ProjectFile) string {
+	return fmt.Sprintf("/%s/%s/%s/%s", repositoryName, projectName, file.Checksum(), file.Name())
+}
+
+func (suite *inheritanceTestSuite) TestInheritedProject() {
+	require := suite.Require()
+	file := suite.addFile("base", "fuubar", "fuubar-1.0.tar.gz")
+	for _, repositoryName := range []string{"test", "team"} {
+		response := suite.request(http.MethodGet, fmt.Sprintf("/%s/fuubar/", repositoryName), nil)
+		require.Equal(http.StatusOK, response.Code, "the project of the base has not been found")
+		require.Contains(response.Body.String(), fileURL("base", "fuubar", file),
+			"the file is not served by the repository storing it")
+
+		response = suite.request(http.MethodGet, fileURL("base", "fuubar", file), nil)
+		require.Equal(http.StatusOK, response.Code)
+		// The inheriting repositories serve the files of their bases as well
+		response = suite.request(http.MethodGet, fileURL(repositoryName, "fuubar", file), nil)
+		require.Equal(http.StatusOK, response.Code)
+	}
+
+	response := suite.request(http.MethodGet, "/test/unknown/", nil)
+	require.Equal(http.StatusMovedPermanently, response.Code, "a missing project has not been redirected")
+}
+
+func (suite *inheritanceTestSuite) TestUnreadableBase() {
+	require := suite.Require()
+	file := suite.addFile("private", "fuubar", "fuubar-1.0.tar.gz")
+	response := suite.request(http.MethodGet, "/public/fuubar/", nil)
+	require.Equal(http.StatusOK, response.Code, "the project of the base has not been found")
+	require.NotContains(response.Body.String(), fileURL("private", "fuubar", file),
+		"the file is linked to a repository the user is not allowed to read")
+	require.Contains(response.Body.String(), fileURL("public", "fuubar", file),
+		"the file is not served by the requested repository")
+
+	response = suite.request(http.MethodGet, fileURL("public", "fuubar", file), nil)
+	require.Equal(http.StatusOK, response.Code, "the linked file can not be downloaded")
+	response = suite.request(http.MethodGet, fileURL("private", "fuubar", file), nil)
+	require.Equal(http.StatusUnauthorized, response.Code, "the file has been served by the unreadable repository")
+}
+
+func (suite *inheritanceTestSuite) TestNormalizedName() {
+	require := suite.Require()
+	file := suite.addFile("base", "fuu-bar", "fuu_bar-1.0.tar.gz")
+	response := suite.request(http.MethodGet, "/team/fuu.bar/", nil)
+	require.Equal(http.StatusOK, response.Code, "the project of the base has not been found")
+	require.Contains(response.Body.String(), fileURL("base", "fuu-bar", file))
+}
+
+func (suite *inheritanceTestSuite) TestShadowedProject() {
+	require := suite.Require()
+	suite.addFile("base", "fuubar", "fuubar-1.0.tar.gz")
+	file := suite.addFile("test", "fuubar", "fuubar-2.0.tar.gz")
+	response := suite.request(http.MethodGet, "/team/fuubar/", nil)
+	require.Equal(http.StatusOK, response.Code)
+	require.Contains(response.Body.String(), fileURL("test", "fuubar", file))
+	require.NotContains(response.Body.String(), "fuubar-1.0.tar.gz", "the shadowed file is listed")
+}
+
+func (suite *inheritanceTestSuite) TestMergedProject() {
+	require := suite.Require()
+	baseFile := suite.addFile("base", "fuubar", "fuubar-1.0.tar.gz")
+	file := suite.addFile("merged", "fuubar", "fuubar-2.0.tar.gz")
+	header := http.Header{}
+	header.Set(echo.HeaderAccept, simpleJSONContentType)
+	response := suite.request(http.MethodGet, "/merged/fuubar/", header)
+	require.Equal(http.StatusOK, response.Code)
+	var detail simpleProjectDetail
+	require.Nil(json.Unmarshal(response.Body.Bytes(), &detail), "unable to decode the project")
+	urls := make([]string, len(detail.Files))
+	for i, file := range detail.Files {
+		urls[i] = file.URL
+	}
+	require.ElementsMatch([]string{fileURL("merged", "fuubar", file), fileURL("base", "fuubar", baseFile)}, urls,
+		"the files are not served by the repositories storing them")
+
+	for _, url := range urls {
+		response = suite.request(http.MethodGet, url, nil)
+		require.Equal(http.StatusOK, response.Code)
+	}
+}
@@ -3,6 +3,7 @@ package web
 import (
 	"fmt"
 	"github.com/hansingt/GoatCheese/internal/datastore"
+	"github.com/hansingt/GoatCheese/internal/distribution"
 	"github.com/labstack/echo/v4"
 	"net/http"
 )
@@ -18,7 +19,7 @@ func getProject(repo datastore.Repository, ctx echo.Context) (datastore.Project,
 		}
 	}
 	if project == nil {
-		projectName = packageNameRegExp.ReplaceAllString(projectName, "-")
+		projectName = distribution.NormalizeName(projectName)
 		project, err = repo.GetProject(projectName)
 		if err != nil {
 			return nil, &echo.HTTPError{
@@ -28,7 +29,38 @@ func getProject(repo datastore.Repository, ctx echo.Context) (datastore.Project,
 			}
 		}
 	}
-	if project == nil {
+	if project == nil || project.IsReadOnly() {
+		// Cached upstream projects of a base are refreshed by the base itself
+		proxy := repo
+		if project != nil {
+			owner, err := project.Repository()
+			if err != nil {
+				return nil, &echo.HTTPError{
+					Code:     http.StatusInternalServerError,
+					Message:  err.Error(),
+					Internal: err,
+				}
+			} else if owner != nil {
+				proxy = owner
+			}
+		}
+		proxied, err := proxy.ProxyProject(projectName)
+		if err != nil {
+			return nil, &echo.HTTPError{
+				Code:     http.StatusBadGateway,
+				Message:  err.Error(),
+				Internal: err,
+			}
+		} else if proxied != nil {
+			project = proxied
+		}
+	}
+	if project == nil && repo.Upstream() != "" {
+		return nil, &echo.HTTPError{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("project '%s' not found", projectName),
+		}
+	} else if project == nil {
 		return nil, ctx.Redirect(
 			http.StatusMovedPermanently,
 			fmt.Sprintf("https://pypi.org/simple/%s", projectName))
@@ -36,11 +68,80 @@ func getProject(repo datastore.Repository, ctx echo.Context) (datastore.Project,
 	return project, nil
 }
 
+/*
+apiProject returns the project given in the request path.
+In contrast to getProject, missing projects are neither proxied nor redirected and
+projects of the bases are not returned, as they are administrated in their own repository.
+*/
+func apiProject(repo datastore.Repository, ctx echo.Context) (datastore.Project, error) {
+	projectName := ctx.Param("project")
+	project, err := repo.GetLocalProject(projectName)
+	if err == nil && project == nil {
+		project, err = repo.GetLocalProject(distribution.NormalizeName(projectName))
+	}
+	if err != nil {
+		return nil, &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  err.Error(),
+			Internal: err,
+		}
+	} else if project == nil {
+		return nil, &echo.HTTPError{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("project '%s' not found in '%s'", projectName, repo.Name()),
+		}
+	}
+	return project, nil
+}
+
+/*
+apiRelease returns the release of the project given in the request path.
+*/
+func apiRelease(project datastore.Project, ctx echo.Context) (datastore.Release, error) {
+	version := ctx.Param("version")
+	release, err := project.GetRelease(version)
+	if err != nil {
+		return nil, &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  err.Error(),
+			Internal: err,
+		}
+	} else if release == nil {
+		return nil, &echo.HTTPError{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("release '%s' not found in project '%s'", version, project.Name()),
+		}
+	}
+	return release, nil
+}
+
+/*
+apiFile returns the file of the project given in the request path.
+*/
+func apiFile(project datastore.Project, ctx echo.Context) (datastore.ProjectFile, error) {
+	fileName := ctx.Param("fileName")
+	file, err := project.GetFile(fileName)
+	if err != nil {
+		return nil, &echo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  err.Error(),
+			Internal: err,
+		}
+	} else if file == nil {
+		return nil, &echo.HTTPError{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("file '%s' not found in project '%s'", fileName, project.Name()),
+		}
+	}
+	return file, nil
+}
+
 func projectView(repo datastore.Repository) func(ctx echo.Context) error {
 	return func(ctx echo.Context) error {
 		var projectFiles []datastore.ProjectFile
 		project, err := getProject(repo, ctx)
-		if err != nil {
+		if err != nil || project == nil {
+			// A missing project has been redirected
 			return err
 		}
 
@@ -52,10 +153,31 @@ func projectView(repo datastore.Repository) func(ctx echo.Context) error {
 				Internal: err,
 			}
 		}
-		return ctx.Render(http.StatusOK, "project.html", map[string]interface{}{
+		return renderSimple(ctx, "project.html", map[string]interface{}{
 			"Repository":   repo,
 			"Project":      project,
 			"ProjectFiles": projectFiles,
+		}, func() interface{} {
+			result := simpleProjectDetail{
+				Meta:  simpleMeta{APIVersion: simpleAPIVersion},
+				Name:  project.Name(),
+				Files: make([]simpleFile, len(projectFiles)),
+			}
+			filePath := projectFilePath(ctx)
+			for i, file := range projectFiles {
+				var yanked interface{} = file.IsYanked()
+				if file.IsYanked() && file.YankedReason() != "" {
+					yanked = file.YankedReason()
+				}
+				result.Files[i] = simpleFile{
+					FileName:       file.Name(),
+					URL:            filePath(repo, project, file),
+					Hashes:         map[string]string{"sha256": file.Checksum()},
+					RequiresPython: file.RequiresPython(),
+					Yanked:         yanked,
+				}
+			}
+			return result
 		})
 	}
 }
@@ -4,7 +4,11 @@ import (
 	"fmt"
 	"github.com/hansingt/GoatCheese/internal/datastore"
 	"github.com/labstack/echo/v4"
+	"io"
+	"mime"
 	"net/http"
+	"path"
+	"strconv"
 )
 
 func projectFileView(repo datastore.Repository) func(ctx echo.Context) error {
@@ -12,7 +16,8 @@ func projectFileView(repo datastore.Repository) func(ctx echo.Context) error {
 		fileName := ctx.Param("fileName")
 		fileChecksum := ctx.Param("fileChecksum")
 		project, err := getProject(repo, ctx)
-		if err != nil {
+		if err != nil || project == nil {
+			// A missing project has been redirected
 			return err
 		}
 
@@ -30,6 +35,52 @@ func projectFileView(repo datastore.Repository) func(ctx echo.Context) error {
 				Message: fmt.Sprintf("file not found in project '%s'", project.Name()),
 			}
 		}
-		return ctx.File(file.FilePath())
+		if err = file.Fetch(); err != nil {
+			return &echo.HTTPError{
+				Code:     http.StatusBadGateway,
+				Message:  err.Error(),
+				Internal: err,
+			}
+		}
+		// Let the storage backend serve the content, if configured
+		signedURL, err := file.SignedURL()
+		if err != nil {
+			return &echo.HTTPError{
+				Code:     http.StatusInternalServerError,
+				Message:  err.Error(),
+				Internal: err,
+			}
+		} else if signedURL != "" {
+			return ctx.Redirect(http.StatusFound, signedURL)
+		}
+		content, err := file.Open()
+		if _, failed := err.(*datastore.DownloadError); failed {
+			return &echo.HTTPError{
+				Code:     http.StatusBadGateway,
+				Message:  err.Error(),
+				Internal: err,
+			}
+		} else if err != nil {
+			return err
+		}
+		//noinspection GoUnhandledErrorResult
+		defer content.Close()
+		// The content is stored in the blob store, thus the file name determines the content type
+		if seeker, ok := content.(io.ReadSeeker); ok {
+			http.ServeContent(ctx.Response(), ctx.Request(), file.Name(), content.ModTime(), seeker)
+			return nil
+		}
+		contentType := mime.TypeByExtension(path.Ext(file.Name()))
+		if contentType == "" {
+			contentType = echo.MIMEOctetStream
+		}
+		header := ctx.Response().Header()
+		if content.Size() >= 0 {
+			header.Set(echo.HeaderContentLength, strconv.FormatInt(content.Size(), 10))
+		}
+		if !content.ModTime().IsZero() {
+			header.Set(echo.HeaderLastModified, content.ModTime().UTC().Format(http.TimeFormat))
+		}
+		return ctx.Stream(http.StatusOK, contentType, content)
 	}
 }
@@ -0,0 +1,94 @@
+package web
+
+import (
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// objectStore is a minimal S3 compatible object storage accepting any credentials
+type objectStore struct {
+	sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *objectStore) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	switch request.Method {
+	case http.MethodPut:
+		s.objects[request.URL.Path], _ = ioutil.ReadAll(request.Body)
+	case http.MethodGet:
+		content, found := s.objects[request.URL.Path]
+		if !found {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = writer.Write(content)
+	case http.MethodDelete:
+		delete(s.objects, request.URL.Path)
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
+type redirectTestSuite struct {
+	TestSuiteWithServer
+	objectStore *httptest.Server
+}
+
+func TestRedirect(t *testing.T) {
+	suite.Run(t, new(redirectTestSuite))
+}
+
+func (suite *redirectTestSuite) SetupTest() {
+	suite.objectStore = httptest.NewServer(&objectStore{objects: make(map[string][]byte)})
+	suite.extraConfiguration = `
+storage:
+  type: s3
+  redirect: true
+  redirectLifetime: 60
+  s3:
+    endpoint: "` + suite.objectStore.URL + `"
+    bucket: "packages"
+    accessKey: "access"
+    secretKey: "secret"
+    pathStyle: true
+`
+	suite.TestSuiteWithServer.SetupTest()
+}
+
+func (suite *redirectTestSuite) TearDownTest() {
+	suite.TestSuiteWithServer.TearDownTest()
+	suite.objectStore.Close()
+}
+
+func (suite *redirectTestSuite) TestRedirectToSignedURL() {
+	require := suite.Require()
+	file := suite.addFile("base", "fuubar", "fuubar-1.0.tar.gz")
+	response := suite.request(http.MethodGet, "/base/fuubar/"+file.Checksum()+"/fuubar-1.0.tar.gz", nil)
+	require.Equal(http.StatusFound, response.Code, "the download has not been redirected")
+
+	location, err := url.Parse(response.Header().Get("Location"))
+	require.Nil(err, "the redirect location is invalid")
+	require.Equal(suite.objectStore.URL, location.Scheme+"://"+location.Host, "not redirected to the object storage")
+	require.Equal("60", location.Query().Get("X-Amz-Expires"), "the lifetime of the URL is not configured")
+	require.NotEmpty(location.Query().Get("X-Amz-Signature"), "the URL has not been signed")
+
+	download, err := http.Get(location.String())
+	require.Nil(err, "unable to download the file")
+	//noinspection GoUnhandledErrorResult
+	defer download.Body.Close()
+	content, err := ioutil.ReadAll(download.Body)
+	require.Nil(err, "unable to read the file")
+	require.Len(content, 512, "the downloaded content differs")
+}
+
+func (suite *redirectTestSuite) TestUnknownChecksum() {
+	suite.addFile("base", "fuubar", "fuubar-1.0.tar.gz")
+	response := suite.request(http.MethodGet, "/base/fuubar/unknown/fuubar-1.0.tar.gz", nil)
+	suite.Require().Equal(http.StatusNotFound, response.Code, "a file with a wrong checksum has been redirected")
+}
@@ -0,0 +1,98 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type projectTestSuite struct {
+	TestSuiteWithServer
+	upstream        *httptest.Server
+	upstreamContent []byte
+}
+
+func TestProject(t *testing.T) {
+	suite.Run(t, new(projectTestSuite))
+}
+
+func (suite *projectTestSuite) SetupTest() {
+	suite.upstreamContent = []byte("upstream content")
+	checksum := sha256.Sum256(suite.upstreamContent)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/simple/upstream-app/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `<a href="/files/upstream_app-1.0.tar.gz#sha256=%s">upstream_app-1.0.tar.gz</a>`,
+			hex.EncodeToString(checksum[:]))
+	})
+	mux.HandleFunc("/files/upstream_app-1.0.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(suite.upstreamContent)
+	})
+	suite.upstream = httptest.NewServer(mux)
+	suite.indexes = `
+  - name: "base"
+    bases: []
+  - name: "proxy"
+    bases: []
+    upstream: "` + suite.upstream.URL + `/simple/"
+  - name: "remote"
+    bases: ["base", "` + suite.upstream.URL + `/simple/"]
+`
+	suite.TestSuiteWithServer.SetupTest()
+}
+
+func (suite *projectTestSuite) TearDownTest() {
+	suite.upstream.Close()
+	suite.TestSuiteWithServer.TearDownTest()
+}
+
+func (suite *projectTestSuite) TestRedirectWithoutUpstream() {
+	require := suite.Require()
+	response := suite.request(http.MethodGet, "/base/upstream_app/", nil)
+	require.Equal(http.StatusMovedPermanently, response.Code)
+	require.Equal("https://pypi.org/simple/upstream-app", response.Header().Get("Location"))
+}
+
+func (suite *projectTestSuite) TestUpstreamNotFound() {
+	response := suite.request(http.MethodGet, "/proxy/unknown/", nil)
+	suite.Require().Equal(http.StatusNotFound, response.Code)
+}
+
+func (suite *projectTestSuite) TestUpstreamProject() {
+	require := suite.Require()
+	response := suite.request(http.MethodGet, "/proxy/upstream_app/", nil)
+	require.Equal(http.StatusOK, response.Code)
+	checksum := sha256.Sum256(suite.upstreamContent)
+	fileURL := fmt.Sprintf("/proxy/upstream-app/%s/upstream_app-1.0.tar.gz", hex.EncodeToString(checksum[:]))
+	require.Contains(response.Body.String(), fileURL)
+
+	response = suite.request(http.MethodGet, fileURL, nil)
+	require.Equal(http.StatusOK, response.Code)
+	require.Equal(suite.upstreamContent, response.Body.Bytes())
+
+	// Once cached, the file is served without the upstream
+	suite.upstream.Close()
+	response = suite.request(http.MethodGet, fileURL, nil)
+	require.Equal(http.StatusOK, response.Code)
+	require.Equal(suite.upstreamContent, response.Body.Bytes())
+}
+
+func (suite *projectTestSuite) TestRemoteBase() {
+	require := suite.Require()
+	response := suite.request(http.MethodGet, "/remote/upstream_app/", nil)
+	require.Equal(http.StatusOK, response.Code)
+	checksum := sha256.Sum256(suite.upstreamContent)
+	fileURL := fmt.Sprintf("/remote/upstream-app/%s/upstream_app-1.0.tar.gz", hex.EncodeToString(checksum[:]))
+	require.Contains(response.Body.String(), fileURL)
+
+	response = suite.request(http.MethodGet, fileURL, nil)
+	require.Equal(http.StatusOK, response.Code)
+	require.Equal(suite.upstreamContent, response.Body.Bytes())
+
+	// Projects unknown to the remote are redirected as before
+	response = suite.request(http.MethodGet, "/remote/unknown/", nil)
+	require.Equal(http.StatusMovedPermanently, response.Code)
+}
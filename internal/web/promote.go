@@ -0,0 +1,114 @@
+package web
+
+import (
+	"fmt"
+	"github.com/hansingt/GoatCheese/internal/datastore"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type promoteRequest struct {
+	Target string `json:"target" form:"target" query:"target"` // Target is the name of the repository to promote to
+	Move   bool   `json:"move" form:"move" query:"move"`       // Move deletes the release from the source repository
+}
+
+type promoteResponse struct {
+	Repository string   `json:"repository"`
+	Project    string   `json:"project"`
+	Version    string   `json:"version"`
+	Files      []string `json:"files"`
+}
+
+/*
+promoteReleaseView copies or moves a release into another repository.
+Promoting requires the permission to upload into the target repository,
+moving additionally the permission to administrate the source repository.
+*/
+func promoteReleaseView(db datastore.Datastore) func(repo datastore.Repository) func(ctx echo.Context) error {
+	return func(repo datastore.Repository) func(ctx echo.Context) error {
+		return func(ctx echo.Context) error {
+			var request promoteRequest
+			if err := ctx.Bind(&request); err != nil {
+				return err
+			}
+			target, err := db.GetRepository(request.Target)
+			if err == datastore.ErrRepositoryNotFound {
+				return &echo.HTTPError{
+					Code:    http.StatusBadRequest,
+					Message: fmt.Sprintf("the target repository '%s' does not exist", request.Target),
+				}
+			} else if err != nil {
+				return &echo.HTTPError{
+					Code:     http.StatusInternalServerError,
+					Message:  err.Error(),
+					Internal: err,
+				}
+			}
+			if err = authorize(ctx, target, datastore.PermissionUpload); err != nil {
+				return err
+			} else if request.Move {
+				if err = authorize(ctx, repo, datastore.PermissionAdmin); err != nil {
+					return err
+				}
+			}
+			project, err := apiProject(repo, ctx)
+			if err != nil {
+				return err
+			}
+
+			release, err := repo.Promote(project.Name(), ctx.Param("version"), target, request.Move)
+			if _, copied := err.(*datastore.MoveError); copied {
+				// Moving the release again completes the deletion
+				return &echo.HTTPError{
+					Code:     http.StatusConflict,
+					Message:  err.Error(),
+					Internal: err,
+				}
+			}
+			switch err {
+			case nil:
+			case datastore.ErrReleaseNotFound:
+				return &echo.HTTPError{
+					Code:    http.StatusNotFound,
+					Message: fmt.Sprintf("release '%s' not found in project '%s'", ctx.Param("version"), project.Name()),
+				}
+			case datastore.ErrFileExists, datastore.ErrLocked:
+				return &echo.HTTPError{
+					Code:     http.StatusConflict,
+					Message:  err.Error(),
+					Internal: err,
+				}
+			case datastore.ErrShadowing, datastore.ErrImmutable:
+				return &echo.HTTPError{
+					Code:     http.StatusForbidden,
+					Message:  err.Error(),
+					Internal: err,
+				}
+			default:
+				return &echo.HTTPError{
+					Code:     http.StatusInternalServerError,
+					Message:  err.Error(),
+					Internal: err,
+				}
+			}
+			files, err := release.ProjectFiles()
+			if err != nil {
+				return &echo.HTTPError{
+					Code:     http.StatusInternalServerError,
+					Message:  err.Error(),
+					Internal: err,
+				}
+			}
+			response := promoteResponse{
+				Repository: target.Name(),
+				Project:    project.Name(),
+				Version:    release.Version(),
+				Files:      make([]string, len(files)),
+			}
+			for i, file := range files {
+				response.Files[i] = file.Name()
+			}
+			return ctx.JSON(http.StatusOK, response)
+		}
+	}
+}
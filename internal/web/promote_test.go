@@ -0,0 +1,120 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/hansingt/GoatCheese/internal/testutil"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type promoteTestSuite struct {
+	TestSuiteWithAdmin
+}
+
+func TestPromoteRelease(t *testing.T) {
+	suite.Run(t, new(promoteTestSuite))
+}
+
+func (suite *promoteTestSuite) SetupTest() {
+	suite.indexes = `
+  - name: "base"
+    bases: []
+    permissions:
+      read: ["*"]
+      upload: ["admin"]
+      admin: ["admin"]
+  - name: "staging"
+    bases: ["base"]
+    permissions:
+      read: ["*"]
+      upload: ["*"]
+      admin: ["admin"]
+`
+	suite.TestSuiteWithAdmin.SetupTest()
+	response := suite.upload("staging", map[string]string{"name": "fuubar", "version": "1.0"},
+		"fuubar-1.0-py3-none-any.whl", testutil.Wheel("fuubar", "1.0"), nil)
+	suite.Require().Equal(http.StatusOK, response.Code, response.Body.String())
+}
+
+// promote promotes the release 1.0 of the project "fuubar" from the staging repository anonymously
+func (suite *promoteTestSuite) promote(body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/staging/+api/projects/fuubar/releases/1.0/promote", strings.NewReader(body))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	recorder := httptest.NewRecorder()
+	suite.server.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (suite *promoteTestSuite) TestCopy() {
+	require := suite.Require()
+	response := suite.send(http.MethodPost, "/staging/+api/projects/fuubar/releases/1.0/promote", `{"target": "base"}`)
+	require.Equal(http.StatusOK, response.Code, response.Body.String())
+	var promoted promoteResponse
+	require.Nil(json.Unmarshal(response.Body.Bytes(), &promoted), "unable to decode the response")
+	require.Equal(promoteResponse{
+		Repository: "base",
+		Project:    "fuubar",
+		Version:    "1.0",
+		Files:      []string{"fuubar-1.0-py3-none-any.whl"},
+	}, promoted)
+
+	repo, err := suite.db.GetRepository("base")
+	require.Nil(err, "unable to get the repository")
+	project, err := repo.GetLocalProject("fuubar")
+	require.Nil(err, "unable to get the project")
+	require.NotNil(project, "the project has not been promoted")
+	file, err := project.GetFile("fuubar-1.0-py3-none-any.whl")
+	require.Nil(err, "unable to get the file")
+	response = suite.request(http.MethodGet, fileURL("base", "fuubar", file), nil)
+	require.Equal(http.StatusOK, response.Code, "the promoted file can not be downloaded")
+	require.Equal(testutil.Wheel("fuubar", "1.0"), response.Body.Bytes(), "the content differs")
+	response = suite.request(http.MethodGet, "/staging/fuubar/", nil)
+	require.Equal(http.StatusOK, response.Code, response.Body.String())
+	require.Contains(response.Body.String(), "fuubar-1.0-py3-none-any.whl", "the copied release has been removed")
+}
+
+func (suite *promoteTestSuite) TestMove() {
+	require := suite.Require()
+	response := suite.send(http.MethodPost, "/staging/+api/projects/fuubar/releases/1.0/promote", `{"target": "base", "move": true}`)
+	require.Equal(http.StatusOK, response.Code, response.Body.String())
+	response = suite.request(http.MethodGet, "/base/fuubar/", nil)
+	require.Equal(http.StatusOK, response.Code, response.Body.String())
+	require.Contains(response.Body.String(), "fuubar-1.0-py3-none-any.whl", "the release has not been moved")
+
+	repo, err := suite.db.GetRepository("staging")
+	require.Nil(err, "unable to get the repository")
+	project, err := repo.GetLocalProject("fuubar")
+	require.Nil(err, "unable to get the project")
+	release, err := project.GetRelease("1.0")
+	require.Nil(err, "unable to get the release")
+	require.Nil(release, "the moved release has been kept")
+}
+
+func (suite *promoteTestSuite) TestConflict() {
+	require := suite.Require()
+	suite.addFile("base", "fuubar", "fuubar-1.0-py3-none-any.whl")
+	response := suite.send(http.MethodPost, "/staging/+api/projects/fuubar/releases/1.0/promote", `{"target": "base"}`)
+	require.Equal(http.StatusConflict, response.Code, "a conflicting file has been replaced")
+}
+
+func (suite *promoteTestSuite) TestNotFound() {
+	require := suite.Require()
+	response := suite.send(http.MethodPost, "/staging/+api/projects/fuubar/releases/1.0/promote", `{"target": "undefined"}`)
+	require.Equal(http.StatusBadRequest, response.Code, "an undefined target has been accepted")
+	response = suite.send(http.MethodPost, "/staging/+api/projects/fuubar/releases/2.0/promote", `{"target": "base"}`)
+	require.Equal(http.StatusNotFound, response.Code, "a missing release has been promoted")
+	response = suite.send(http.MethodPost, "/staging/+api/projects/other/releases/1.0/promote", `{"target": "base"}`)
+	require.Equal(http.StatusNotFound, response.Code, "a missing project has been promoted")
+}
+
+func (suite *promoteTestSuite) TestRequiresPermission() {
+	require := suite.Require()
+	response := suite.promote(`{"target": "base"}`)
+	require.Equal(http.StatusUnauthorized, response.Code, "an anonymous user has uploaded into the target")
+	response = suite.promote(`{"target": "staging"}`)
+	require.NotEqual(http.StatusOK, response.Code, "a release has been promoted into its own repository")
+}
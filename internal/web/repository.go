@@ -1,49 +1,333 @@
 package web
 
 import (
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
 	"github.com/hansingt/GoatCheese/internal/datastore"
+	"github.com/hansingt/GoatCheese/internal/distribution"
 	"github.com/labstack/echo/v4"
+	"hash"
+	"io"
+	"io/ioutil"
 	"mime/multipart"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
-func submit(repo datastore.Repository, form *multipart.Form) (datastore.Project, error) {
-	fieldValues := form.Value["name"]
+// maxFieldsSize limits the total size of all metadata fields sent along with an upload
+const maxFieldsSize = 32 << 20 // 32MiB
+
+/*
+formProjectName returns the normalized name of the project given in the metadata of an upload.
+*/
+func formProjectName(values url.Values) (string, error) {
+	fieldValues := values["name"]
 	if len(fieldValues) != 1 {
-		return nil, &echo.HTTPError{
+		return "", &echo.HTTPError{
 			Code:    http.StatusBadRequest,
 			Message: "no (or multiple) field(s) 'name' given in the metadata",
 		}
 	}
-	projectName := packageNameRegExp.ReplaceAllString(fieldValues[0], "-")
-	return repo.AddProject(projectName)
+	return distribution.NormalizeName(fieldValues[0]), nil
+}
+
+func submit(repo datastore.Repository, values url.Values) (datastore.Project, error) {
+	projectName, err := formProjectName(values)
+	if err != nil {
+		return nil, err
+	}
+	project, err := repo.AddProject(projectName)
+	if err == datastore.ErrShadowing {
+		return nil, &echo.HTTPError{
+			Code:     http.StatusForbidden,
+			Message:  fmt.Sprintf("project '%s' exists in a base of '%s' and must not be shadowed", projectName, repo.Name()),
+			Internal: err,
+		}
+	} else if err != nil {
+		return nil, err
+	} else if project.IsReadOnly() {
+		return nil, &echo.HTTPError{
+			Code:    http.StatusForbidden,
+			Message: fmt.Sprintf("project '%s' is a read-only copy of the upstream project", projectName),
+		}
+	}
+	return project, nil
+}
+
+/*
+formMetadata returns the metadata of the distribution sent by the client along with the file.
+*/
+func formMetadata(values url.Values) distribution.Metadata {
+	return distribution.Metadata{
+		Name:           values.Get("name"),
+		Version:        values.Get("version"),
+		Summary:        values.Get("summary"),
+		RequiresPython: values.Get("requires_python"),
+		RequiresDist:   values["requires_dist"],
+		Author:         values.Get("author"),
+		AuthorEmail:    values.Get("author_email"),
+		License:        values.Get("license"),
+		Classifiers:    values["classifiers"],
+	}
+}
+
+/*
+uploadedFile is a distribution file streamed into a project while reading the form.
+*/
+type uploadedFile struct {
+	fileName string
+	upload   datastore.Upload
+	md5      hash.Hash
+}
+
+/*
+uploadForm contains the fields and files of an upload request.
+*/
+type uploadForm struct {
+	values  url.Values
+	project datastore.Project
+	created bool // created is true, if the project has been created by this upload
+	files   []*uploadedFile
+}
+
+/*
+discard removes all files of the form not committed to the project.
+A project created by the upload is removed again, if no file has been added to it.
+*/
+func (f *uploadForm) discard() {
+	for _, file := range f.files {
+		_ = file.upload.Discard()
+	}
+	if f.created {
+		if files, err := f.project.ProjectFiles(); err == nil && len(files) == 0 {
+			_ = f.project.Delete()
+		}
+	}
 }
 
-func fileUpload(repo datastore.Repository, form *multipart.Form) error {
-	prj, err := submit(repo, form)
+/*
+addProject adds the project given in the metadata to the repository and remembers,
+whether it has been created by this upload.
+*/
+func (f *uploadForm) addProject(repo datastore.Repository) error {
+	projectName, err := formProjectName(f.values)
 	if err != nil {
 		return err
 	}
-	files := form.File["content"]
-	if len(files) == 0 {
+	existing, err := repo.GetLocalProject(projectName)
+	if err != nil {
+		return err
+	}
+	if f.project, err = submit(repo, f.values); err != nil {
+		return err
+	}
+	f.created = existing == nil
+	return nil
+}
+
+/*
+readForm streams the multipart form of an upload request.
+
+The file contents are not held in memory, but are streamed into temporary files
+of the project while they are hashed. Therefore, the project needs to be known
+before the first file is read, i.e. the "name" field has to precede the files.
+The project is only added after the name of the first file has been validated.
+On error, all files read so far are discarded.
+*/
+func readForm(repo datastore.Repository, request *http.Request) (*uploadForm, error) {
+	reader, err := request.MultipartReader()
+	if err != nil {
+		return nil, &echo.HTTPError{
+			Code:     http.StatusBadRequest,
+			Message:  err.Error(),
+			Internal: err,
+		}
+	}
+	form := &uploadForm{values: make(url.Values)}
+	remaining := int64(maxFieldsSize)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return form, nil
+		} else if err != nil {
+			form.discard()
+			return nil, &echo.HTTPError{
+				Code:     http.StatusBadRequest,
+				Message:  err.Error(),
+				Internal: err,
+			}
+		}
+		if part.FileName() == "" {
+			value, err := ioutil.ReadAll(io.LimitReader(part, remaining+1))
+			if err != nil {
+				form.discard()
+				return nil, err
+			}
+			if remaining -= int64(len(value)); remaining < 0 {
+				form.discard()
+				return nil, &echo.HTTPError{
+					Code:    http.StatusRequestEntityTooLarge,
+					Message: "the metadata of the upload is too large",
+				}
+			}
+			form.values.Add(part.FormName(), string(value))
+			continue
+		} else if part.FormName() != "content" {
+			// Unknown files are skipped
+			continue
+		}
+		if err = verifyFileName(part.FileName(), form.values); err != nil {
+			form.discard()
+			return nil, err
+		}
+		if form.project == nil {
+			if err = form.addProject(repo); err != nil {
+				form.discard()
+				return nil, err
+			}
+		}
+		file, err := streamFile(form.project, part)
+		if err != nil {
+			form.discard()
+			return nil, err
+		}
+		form.files = append(form.files, file)
+	}
+}
+
+/*
+streamFile streams the contents of an uploaded distribution into a temporary file of the project.
+*/
+func streamFile(prj datastore.Project, part *multipart.Part) (*uploadedFile, error) {
+	fileName := part.FileName()
+	upload, err := prj.NewUpload(fileName)
+	if err != nil {
+		return nil, err
+	}
+	file := &uploadedFile{fileName: fileName, upload: upload, md5: md5.New()}
+	if _, err = io.Copy(io.MultiWriter(upload, file.md5), part); err != nil {
+		_ = upload.Discard()
+		if err == datastore.ErrUploadTooLarge {
+			return nil, &echo.HTTPError{
+				Code:     http.StatusRequestEntityTooLarge,
+				Message:  fmt.Sprintf("'%s' exceeds the maximum upload size", fileName),
+				Internal: err,
+			}
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+/*
+verifyFileName checks that the file name of an uploaded distribution follows the
+wheel or sdist naming conventions and belongs to the project and version the file is uploaded to.
+*/
+func verifyFileName(fileName string, values url.Values) error {
+	projectName, err := formProjectName(values)
+	if err != nil {
+		return err
+	}
+	parsed, err := distribution.ParseFileName(fileName)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusBadRequest,
+			Message:  err.Error(),
+			Internal: err,
+		}
+	}
+	if !parsed.Matches(projectName) {
 		return &echo.HTTPError{
 			Code:    http.StatusBadRequest,
-			Message: "no file content uploaded",
+			Message: fmt.Sprintf("the file name '%s' does not belong to the project '%s'", fileName, projectName),
 		}
 	}
-	for _, fileHeader := range files {
-		file, err := fileHeader.Open()
-		if err != nil {
-			return err
+	if version := values.Get("version"); version != "" && !parsed.MatchesVersion(version) {
+		return &echo.HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("the file name '%s' does not belong to the version '%s'", fileName, version),
 		}
-		err = prj.AddFile(fileHeader.Filename, file)
-		err2 := file.Close()
-		if err != nil {
-			return err
+	}
+	return nil
+}
+
+/*
+verifyDigests compares the digests of the uploaded content to the digests sent
+by the client. Digests not sent by the client are not verified.
+*/
+func verifyDigests(values url.Values, file *uploadedFile) error {
+	for field, computed := range map[string]string{
+		"sha256_digest": file.upload.Checksum(),
+		"md5_digest":    hex.EncodeToString(file.md5.Sum(nil)),
+	} {
+		if expected := values.Get(field); expected != "" && !strings.EqualFold(expected, computed) {
+			return &echo.HTTPError{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("the %s of '%s' does not match the uploaded content", field, file.fileName),
+			}
+		}
+	}
+	return nil
+}
+
+/*
+uploadFile validates an uploaded distribution, verifies its metadata against
+the metadata sent by the client and adds the file to the release in the project.
+*/
+func uploadFile(values url.Values, file *uploadedFile) error {
+	metadata := formMetadata(values)
+	archiveMetadata, err := distribution.ReadMetadata(file.fileName, file.upload, file.upload.Size())
+	if err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusBadRequest,
+			Message:  err.Error(),
+			Internal: err,
 		}
-		if err2 != nil {
-			return err2
+	}
+	if err = metadata.Verify(archiveMetadata); err != nil {
+		return &echo.HTTPError{
+			Code:     http.StatusBadRequest,
+			Message:  fmt.Sprintf("the metadata of '%s' does not match: %s", file.fileName, err),
+			Internal: err,
+		}
+	}
+	// The metadata contained in the distribution takes precedence
+	archiveMetadata.Merge(&metadata)
+	if err = verifyDigests(values, file); err != nil {
+		return err
+	}
+
+	// The file is linked to its release together with storing it, thus a failed upload leaves no
+	// file without its metadata behind. Retrying the identical upload links the metadata again.
+	file.upload.SetMetadata(*archiveMetadata)
+	if err = file.upload.Commit(); err == datastore.ErrFileExists {
+		return &echo.HTTPError{
+			Code:     http.StatusBadRequest,
+			Message:  fmt.Sprintf("File already exists: '%s' has already been uploaded with a different content", file.fileName),
+			Internal: err,
+		}
+	} else if err == datastore.ErrLocked {
+		return &echo.HTTPError{
+			Code:     http.StatusConflict,
+			Message:  fmt.Sprintf("'%s' is currently uploaded by another request", file.fileName),
+			Internal: err,
+		}
+	}
+	return err
+}
+
+func fileUpload(form *uploadForm) error {
+	if len(form.files) == 0 {
+		return &echo.HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "no file content uploaded",
+		}
+	}
+	for _, file := range form.files {
+		if err := uploadFile(form.values, file); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -55,25 +339,32 @@ func repositoryView(repo datastore.Repository) func(ctx echo.Context) error {
 		if err != nil {
 			return err
 		}
-		return ctx.Render(http.StatusOK, "repository.html", map[string]interface{}{
+		return renderSimple(ctx, "repository.html", map[string]interface{}{
 			"Repository": repo,
 			"Projects":   projects,
+		}, func() interface{} {
+			result := simpleRepository{
+				Meta:     simpleMeta{APIVersion: simpleAPIVersion},
+				Projects: make([]simpleProject, len(projects)),
+			}
+			for i, project := range projects {
+				result.Projects[i] = simpleProject{Name: project.Name()}
+			}
+			return result
 		})
 	}
 }
 
 func repositoryPostView(repo datastore.Repository) func(ctx echo.Context) error {
 	return func(ctx echo.Context) error {
-		form, err := ctx.MultipartForm()
+		form, err := readForm(repo, ctx.Request())
 		if err != nil {
-			ctx.Error(err)
-			return &echo.HTTPError{
-				Code:     http.StatusBadRequest,
-				Message:  err.Error(),
-				Internal: err,
-			}
+			return err
 		}
-		actions := form.Value[":action"]
+		// Files not added to the project are removed again
+		defer form.discard()
+
+		actions := form.values[":action"]
 		if len(actions) != 1 {
 			return &echo.HTTPError{
 				Code:    http.StatusBadRequest,
@@ -82,10 +373,10 @@ func repositoryPostView(repo datastore.Repository) func(ctx echo.Context) error
 		}
 		switch actions[0] {
 		case "submit":
-			_, err = submit(repo, form)
+			_, err = submit(repo, form.values)
 			return err
 		case "file_upload":
-			return fileUpload(repo, form)
+			return fileUpload(form)
 		default:
 			return &echo.HTTPError{
 				Code:    http.StatusBadRequest,
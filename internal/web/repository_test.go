@@ -0,0 +1,256 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/hansingt/GoatCheese/internal/testutil"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type repositoryTestSuite struct {
+	TestSuiteWithServer
+}
+
+func TestRepository(t *testing.T) {
+	suite.Run(t, new(repositoryTestSuite))
+}
+
+func (suite *repositoryTestSuite) SetupTest() {
+	suite.indexes = defaultIndexes + `
+  - name: "scratch"
+    bases: []
+    allowOverwrite: true
+  - name: "small"
+    bases: []
+    maxUploadSize: 1024
+  - name: "strict"
+    bases: ["base"]
+    shadowing: "deny"
+`
+	suite.TestSuiteWithServer.SetupTest()
+}
+
+func (suite *repositoryTestSuite) TestUploadMetadata() {
+	require := suite.Require()
+	response := suite.upload("base", map[string]string{
+		"name":            "Fuu.Bar",
+		"version":         "1.0",
+		"requires_python": ">=3.6",
+		"author":          "Alice",
+	}, "Fuu.Bar-1.0-py3-none-any.whl", testutil.Wheel("Fuu.Bar", "1.0",
+		"Summary: A test project",
+		"Requires-Python: >=3.6",
+		"Requires-Dist: requests",
+		"Requires-Dist: six"), nil)
+	require.Equal(http.StatusOK, response.Code, response.Body.String())
+
+	repo, err := suite.db.GetRepository("base")
+	require.Nil(err, "unable to get the repository")
+	project, err := repo.GetProject("fuu-bar")
+	require.Nil(err, "unable to get the project")
+	require.NotNil(project, "the project has not been created by its normalized name")
+	release, err := project.GetRelease("1.0")
+	require.Nil(err, "unable to get the release")
+	require.NotNil(release, "the release has not been created")
+	metadata := release.Metadata()
+	require.Equal("A test project", metadata.Summary)
+	require.Equal(">=3.6", metadata.RequiresPython)
+	require.Equal([]string{"requests", "six"}, metadata.RequiresDist)
+	require.Equal("Alice", metadata.Author, "the metadata sent by the client is missing")
+
+	files, err := release.ProjectFiles()
+	require.Nil(err, "unable to get the release files")
+	require.Equal(1, len(files), "the file has not been added to the release")
+
+	// All spellings of the name refer to the project
+	for _, spelling := range []string{"Fuu.Bar", "FUU_bar", "fuu-bar"} {
+		response = suite.request(http.MethodGet, "/base/"+spelling+"/", nil)
+		require.Equal(http.StatusOK, response.Code, "the project has not been found as '%s'", spelling)
+	}
+}
+
+func (suite *repositoryTestSuite) TestUploadMetadataMismatch() {
+	require := suite.Require()
+	response := suite.upload("base", map[string]string{
+		"name":    "fuubar",
+		"version": "2.0",
+	}, "fuubar-2.0-py3-none-any.whl", testutil.Wheel("fuubar", "1.0"), nil)
+	require.Equal(http.StatusBadRequest, response.Code)
+	require.Contains(response.Body.String(), "the versions '2.0' and '1.0' do not match")
+
+	response = suite.upload("base", map[string]string{
+		"name":    "fuubar",
+		"version": "2.0",
+	}, "fuubar-1.0-py3-none-any.whl", testutil.Wheel("fuubar", "1.0"), nil)
+	require.Equal(http.StatusBadRequest, response.Code)
+	require.Contains(response.Body.String(), "does not belong to the version '2.0'")
+
+	response = suite.upload("base", map[string]string{
+		"name": "asdf",
+	}, "fuubar-1.0-py3-none-any.whl", testutil.Wheel("fuubar", "1.0"), nil)
+	require.Equal(http.StatusBadRequest, response.Code)
+}
+
+func (suite *repositoryTestSuite) TestRejectedUploadKeepsNoProject() {
+	require := suite.Require()
+	for fileName, fields := range map[string]map[string]string{
+		"fuubar-1.0-py2.7.egg":        {"name": "fuubar"},
+		"fuubar-1.0-py3-none-any.whl": {"name": "fuubar", "sha256_digest": "abc"},
+	} {
+		response := suite.upload("base", fields, fileName, testutil.Wheel("fuubar", "1.0"), nil)
+		require.Equal(http.StatusBadRequest, response.Code, "'%s' has been accepted", fileName)
+		response = suite.request(http.MethodGet, "/base/", nil)
+		require.NotContains(response.Body.String(), "fuubar", "the rejected upload of '%s' left a project behind", fileName)
+	}
+
+	// Projects existing before are kept
+	suite.addFile("base", "fuubar", "fuubar-0.9.tar.gz")
+	response := suite.upload("base", map[string]string{"name": "fuubar", "sha256_digest": "abc"},
+		"fuubar-1.0-py3-none-any.whl", testutil.Wheel("fuubar", "1.0"), nil)
+	require.Equal(http.StatusBadRequest, response.Code)
+	response = suite.request(http.MethodGet, "/base/fuubar/", nil)
+	require.Equal(http.StatusOK, response.Code, "an existing project has been removed")
+}
+
+func (suite *repositoryTestSuite) TestUploadWithoutMetadata() {
+	require := suite.Require()
+	response := suite.upload("base", map[string]string{
+		"name": "fuubar",
+	}, "fuubar-1.0-py3-none-any.whl", []byte("no wheel"), nil)
+	require.Equal(http.StatusBadRequest, response.Code)
+}
+
+func (suite *repositoryTestSuite) TestRequiresPython() {
+	require := suite.Require()
+	response := suite.upload("base", map[string]string{"name": "fuubar"}, "fuubar-1.0-py3-none-any.whl",
+		testutil.Wheel("fuubar", "1.0", "Requires-Python: >=3.6, <4"), nil)
+	require.Equal(http.StatusOK, response.Code, response.Body.String())
+
+	response = suite.request(http.MethodGet, "/base/fuubar/", nil)
+	require.Equal(http.StatusOK, response.Code)
+	require.Contains(response.Body.String(), `data-requires-python="&gt;=3.6, &lt;4"`)
+
+	response = suite.request(http.MethodGet, "/base/fuubar/", http.Header{
+		echo.HeaderAccept: []string{simpleJSONContentType},
+	})
+	require.Equal(http.StatusOK, response.Code)
+	require.Contains(response.Body.String(), `"requires-python":"\u003e=3.6, \u003c4"`)
+}
+
+func (suite *repositoryTestSuite) TestUploadExistingFile() {
+	require := suite.Require()
+	fields := map[string]string{"name": "fuubar"}
+	content := testutil.Wheel("fuubar", "1.0")
+	response := suite.upload("base", fields, "fuubar-1.0-py3-none-any.whl", content, nil)
+	require.Equal(http.StatusOK, response.Code, response.Body.String())
+
+	// Retrying the identical upload succeeds
+	response = suite.upload("base", fields, "fuubar-1.0-py3-none-any.whl", content, nil)
+	require.Equal(http.StatusOK, response.Code, response.Body.String())
+
+	response = suite.upload("base", fields, "fuubar-1.0-py3-none-any.whl", testutil.Wheel("fuubar", "1.0", "Summary: changed"), nil)
+	require.Equal(http.StatusBadRequest, response.Code)
+	require.Contains(response.Body.String(), "File already exists")
+}
+
+func (suite *repositoryTestSuite) TestOverwriteFile() {
+	require := suite.Require()
+	fields := map[string]string{"name": "fuubar"}
+	response := suite.upload("scratch", fields, "fuubar-1.0-py3-none-any.whl", testutil.Wheel("fuubar", "1.0"), nil)
+	require.Equal(http.StatusOK, response.Code, response.Body.String())
+	response = suite.upload("scratch", fields, "fuubar-1.0-py3-none-any.whl", testutil.Wheel("fuubar", "1.0", "Summary: changed"), nil)
+	require.Equal(http.StatusOK, response.Code, response.Body.String())
+}
+
+func (suite *repositoryTestSuite) TestUploadInvalidFileName() {
+	require := suite.Require()
+	fields := map[string]string{"name": "fuubar"}
+	for _, fileName := range []string{"fuubar.zip", "fuubar-1.0-py3.whl", "fuubar-1.0-py3.6.egg", "other-1.0-py3-none-any.whl"} {
+		response := suite.upload("base", fields, fileName, testutil.Wheel("fuubar", "1.0"), nil)
+		require.Equal(http.StatusBadRequest, response.Code, "'%s' has been accepted", fileName)
+	}
+	response := suite.upload("base", map[string]string{"name": "Fuu.Bar"}, "fuu_bar-1.0-py3-none-any.whl", testutil.Wheel("Fuu.Bar", "1.0"), nil)
+	require.Equal(http.StatusOK, response.Code, response.Body.String())
+}
+
+func (suite *repositoryTestSuite) TestUploadDigest() {
+	require := suite.Require()
+	content := testutil.Wheel("fuubar", "1.0")
+	checksum := sha256.Sum256(content)
+	response := suite.upload("base", map[string]string{
+		"name":          "fuubar",
+		"sha256_digest": strings.Repeat("0", 64),
+	}, "fuubar-1.0-py3-none-any.whl", content, nil)
+	require.Equal(http.StatusBadRequest, response.Code)
+	require.Contains(response.Body.String(), "sha256_digest")
+	repo, err := suite.db.GetRepository("base")
+	require.Nil(err, "unable to get the repository")
+	project, err := repo.GetProject("fuubar")
+	require.Nil(err, "unable to get the project")
+	require.Nil(project, "the project of the rejected file has been stored")
+
+	response = suite.upload("base", map[string]string{
+		"name":          "fuubar",
+		"sha256_digest": hex.EncodeToString(checksum[:]),
+	}, "fuubar-1.0-py3-none-any.whl", content, nil)
+	require.Equal(http.StatusOK, response.Code, response.Body.String())
+}
+
+func (suite *repositoryTestSuite) TestMaxUploadSize() {
+	require := suite.Require()
+	summary := make([]byte, 2048)
+	_, err := rand.Read(summary)
+	require.Nil(err, "unable to create a random summary")
+	content := testutil.Wheel("fuubar", "1.0", "Summary: "+hex.EncodeToString(summary))
+	response := suite.upload("small", map[string]string{"name": "fuubar"}, "fuubar-1.0-py3-none-any.whl", content, nil)
+	require.Equal(http.StatusRequestEntityTooLarge, response.Code)
+
+	entries, err := ioutil.ReadDir(filepath.Join(suite.storagePath, "tmp"))
+	require.Nil(err, "unable to list the temporary files")
+	require.Empty(entries, "the rejected upload has not been removed")
+
+	response = suite.upload("base", map[string]string{"name": "fuubar"}, "fuubar-1.0-py3-none-any.whl", content, nil)
+	require.Equal(http.StatusOK, response.Code, response.Body.String())
+}
+
+func (suite *repositoryTestSuite) TestDenyShadowing() {
+	require := suite.Require()
+	response := suite.upload("base", map[string]string{"name": "fuubar"}, "fuubar-1.0-py3-none-any.whl", testutil.Wheel("fuubar", "1.0"), nil)
+	require.Equal(http.StatusOK, response.Code, response.Body.String())
+
+	response = suite.upload("strict", map[string]string{"name": "FuuBar"}, "FuuBar-2.0-py3-none-any.whl", testutil.Wheel("FuuBar", "2.0"), nil)
+	require.Equal(http.StatusForbidden, response.Code, "a project of the base has been shadowed")
+
+	response = suite.upload("strict", map[string]string{"name": "other"}, "other-1.0-py3-none-any.whl", testutil.Wheel("other", "1.0"), nil)
+	require.Equal(http.StatusOK, response.Code, response.Body.String())
+}
+
+func (suite *repositoryTestSuite) TestUploadNameAfterContent() {
+	require := suite.Require()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	require.Nil(writer.WriteField(":action", "file_upload"), "unable to write the action")
+	part, err := writer.CreateFormFile("content", "fuubar-1.0-py3-none-any.whl")
+	require.Nil(err, "unable to create the file field")
+	_, err = part.Write(testutil.Wheel("fuubar", "1.0"))
+	require.Nil(err, "unable to write the file content")
+	require.Nil(writer.WriteField("name", "fuubar"), "unable to write the name")
+	require.Nil(writer.Close(), "unable to close the multipart writer")
+
+	request := httptest.NewRequest(http.MethodPost, "/base/", body)
+	request.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	response := httptest.NewRecorder()
+	suite.server.ServeHTTP(response, request)
+	require.Equal(http.StatusBadRequest, response.Code)
+	require.Contains(response.Body.String(), "'name'")
+}
@@ -6,9 +6,9 @@ import (
 	"net/http"
 )
 
-func rootView(datastore datastore.Datastore) func(ctx echo.Context) error {
+func rootView(db datastore.Datastore) func(ctx echo.Context) error {
 	return func(ctx echo.Context) error {
-		repos, err := datastore.AllRepositories()
+		repos, err := db.AllRepositories()
 		if err != nil {
 			return &echo.HTTPError{
 				Code:     http.StatusInternalServerError,
@@ -16,8 +16,22 @@ func rootView(datastore datastore.Datastore) func(ctx echo.Context) error {
 				Internal: err,
 			}
 		}
+		// Only list the repositories the user is allowed to read
+		readable := make([]datastore.Repository, 0, len(repos))
+		for _, repo := range repos {
+			allowed, err := repo.IsAllowed(currentUser(ctx), datastore.PermissionRead)
+			if err != nil {
+				return &echo.HTTPError{
+					Code:     http.StatusInternalServerError,
+					Message:  err.Error(),
+					Internal: err,
+				}
+			} else if allowed {
+				readable = append(readable, repo)
+			}
+		}
 		return ctx.Render(http.StatusOK, "repositories.html", map[string]interface{}{
-			"Repositories": repos,
+			"Repositories": readable,
 		})
 	}
 }
@@ -0,0 +1,120 @@
+package web
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The content types of the simple repository API as defined in PEP 691
+const (
+	simpleJSONContentType   = "application/vnd.pypi.simple.v1+json"
+	simpleHTMLContentType   = "application/vnd.pypi.simple.v1+html"
+	simpleLatestJSONType    = "application/vnd.pypi.simple.latest+json"
+	simpleLatestHTMLType    = "application/vnd.pypi.simple.latest+html"
+	simpleAPIVersion        = "1.0"
+	defaultSimpleRenderType = echo.MIMETextHTML
+)
+
+// simpleContentTypes maps the content types a client might request to the content types served.
+var simpleContentTypes = map[string]string{
+	simpleJSONContentType: simpleJSONContentType,
+	simpleLatestJSONType:  simpleJSONContentType,
+	simpleHTMLContentType: simpleHTMLContentType,
+	simpleLatestHTMLType:  simpleHTMLContentType,
+	echo.MIMETextHTML:     echo.MIMETextHTML,
+}
+
+type simpleMeta struct {
+	APIVersion string `json:"api-version"`
+}
+
+type simpleProject struct {
+	Name string `json:"name"`
+}
+
+type simpleRepository struct {
+	Meta     simpleMeta      `json:"meta"`
+	Projects []simpleProject `json:"projects"`
+}
+
+type simpleFile struct {
+	FileName       string            `json:"filename"`
+	URL            string            `json:"url"`
+	Hashes         map[string]string `json:"hashes"`
+	RequiresPython string            `json:"requires-python,omitempty"`
+	Yanked         interface{}       `json:"yanked"`
+}
+
+type simpleProjectDetail struct {
+	Meta  simpleMeta   `json:"meta"`
+	Name  string       `json:"name"`
+	Files []simpleFile `json:"files"`
+}
+
+type acceptedType struct {
+	mediaType string
+	quality   float64
+}
+
+/*
+negotiateSimpleContentType selects the content type of the simple repository API
+to serve based on the Accept header of the request.
+
+If the client does not accept any of the content types served, it falls back to HTML.
+*/
+func negotiateSimpleContentType(ctx echo.Context) string {
+	header := ctx.Request().Header.Get(echo.HeaderAccept)
+	if header == "" {
+		return defaultSimpleRenderType
+	}
+	var accepted []acceptedType
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if quality > 0 {
+			accepted = append(accepted, acceptedType{mediaType, quality})
+		}
+	}
+	// The sort is stable, thus types with the same quality keep the client's order
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].quality > accepted[j].quality
+	})
+	for _, acceptedType := range accepted {
+		if contentType, served := simpleContentTypes[acceptedType.mediaType]; served {
+			return contentType
+		}
+		if acceptedType.mediaType == "*/*" || acceptedType.mediaType == "text/*" {
+			return defaultSimpleRenderType
+		}
+	}
+	return defaultSimpleRenderType
+}
+
+/*
+renderSimple renders either the given template or the JSON value, depending
+on the content type negotiated with the client.
+*/
+func renderSimple(ctx echo.Context, templateName string, data map[string]interface{}, value func() interface{}) error {
+	contentType := negotiateSimpleContentType(ctx)
+	ctx.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+	if contentType == simpleJSONContentType {
+		ctx.Response().Header().Set(echo.HeaderContentType, simpleJSONContentType)
+		return ctx.JSON(http.StatusOK, value())
+	}
+	if contentType == simpleHTMLContentType {
+		ctx.Response().Header().Set(echo.HeaderContentType, simpleHTMLContentType)
+	}
+	return ctx.Render(http.StatusOK, templateName, data)
+}
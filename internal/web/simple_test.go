@@ -0,0 +1,105 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type simpleTestSuite struct {
+	TestSuiteWithServer
+}
+
+func TestSimple(t *testing.T) {
+	suite.Run(t, new(simpleTestSuite))
+}
+
+func (suite *simpleTestSuite) TestNegotiateContentType() {
+	require := suite.Require()
+	for accept, expected := range map[string]string{
+		"":                    echo.MIMETextHTML,
+		"*/*":                 echo.MIMETextHTML,
+		"text/html":           echo.MIMETextHTML,
+		"application/json":    echo.MIMETextHTML,
+		simpleJSONContentType: simpleJSONContentType,
+		simpleLatestJSONType:  simpleJSONContentType,
+		simpleHTMLContentType: simpleHTMLContentType,
+		"text/html;q=0.01, " + simpleJSONContentType + ", " + simpleHTMLContentType + ";q=0.2": simpleJSONContentType,
+		simpleJSONContentType + ";q=0.1, text/html":                                            echo.MIMETextHTML,
+		simpleJSONContentType + ";q=0, */*":                                                    echo.MIMETextHTML,
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set(echo.HeaderAccept, accept)
+		ctx := suite.server.NewContext(request, httptest.NewRecorder())
+		require.Equal(expected, negotiateSimpleContentType(ctx), "wrong content type for '%s'", accept)
+	}
+}
+
+func (suite *simpleTestSuite) TestRepositoryHTML() {
+	require := suite.Require()
+	suite.addFile("base", "fuubar", "fuubar-1.0.tar.gz")
+
+	response := suite.request(http.MethodGet, "/test/", nil)
+	require.Equal(http.StatusOK, response.Code)
+	require.Contains(response.Header().Get(echo.HeaderContentType), echo.MIMETextHTML)
+	require.Contains(response.Body.String(), `<a href="/test/fuubar/">fuubar</a>`)
+}
+
+func (suite *simpleTestSuite) TestRepositoryJSON() {
+	require := suite.Require()
+	suite.addFile("base", "fuubar", "fuubar-1.0.tar.gz")
+	suite.addFile("test", "asdf", "asdf-1.0.tar.gz")
+
+	response := suite.request(http.MethodGet, "/test/", http.Header{
+		echo.HeaderAccept: []string{simpleJSONContentType},
+	})
+	require.Equal(http.StatusOK, response.Code)
+	require.Equal(simpleJSONContentType, response.Header().Get(echo.HeaderContentType))
+	require.Equal(echo.HeaderAccept, response.Header().Get(echo.HeaderVary))
+
+	var result simpleRepository
+	require.Nil(json.Unmarshal(response.Body.Bytes(), &result), "unable to decode the response")
+	require.Equal(simpleAPIVersion, result.Meta.APIVersion)
+	var names []string
+	for _, project := range result.Projects {
+		names = append(names, project.Name)
+	}
+	require.ElementsMatch([]string{"fuubar", "asdf"}, names, "not all projects have been listed")
+}
+
+func (suite *simpleTestSuite) TestProjectJSON() {
+	require := suite.Require()
+	file := suite.addFile("base", "fuubar", "fuubar-1.0.tar.gz")
+
+	response := suite.request(http.MethodGet, "/base/fuubar/", http.Header{
+		echo.HeaderAccept: []string{simpleJSONContentType},
+	})
+	require.Equal(http.StatusOK, response.Code)
+	require.Equal(simpleJSONContentType, response.Header().Get(echo.HeaderContentType))
+
+	var result map[string]interface{}
+	require.Nil(json.Unmarshal(response.Body.Bytes(), &result), "unable to decode the response")
+	require.Equal("fuubar", result["name"])
+	files := result["files"].([]interface{})
+	require.Equal(1, len(files), "wrong number of files listed")
+	detail := files[0].(map[string]interface{})
+	require.Equal(file.Name(), detail["filename"])
+	require.Equal("/base/fuubar/"+file.Checksum()+"/"+file.Name(), detail["url"])
+	require.Equal(map[string]interface{}{"sha256": file.Checksum()}, detail["hashes"])
+	require.Equal(false, detail["yanked"])
+}
+
+func (suite *simpleTestSuite) TestProjectHTML() {
+	require := suite.Require()
+	file := suite.addFile("base", "fuubar", "fuubar-1.0.tar.gz")
+
+	response := suite.request(http.MethodGet, "/base/fuubar/", http.Header{
+		echo.HeaderAccept: []string{simpleHTMLContentType},
+	})
+	require.Equal(http.StatusOK, response.Code)
+	require.Equal(simpleHTMLContentType, response.Header().Get(echo.HeaderContentType))
+	require.Contains(response.Body.String(), file.Name())
+}
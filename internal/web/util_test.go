@@ -0,0 +1,171 @@
+package web
+
+import (
+	"bytes"
+	"github.com/hansingt/GoatCheese/internal/datastore"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type TestSuiteWithServer struct {
+	suite.Suite
+	storagePath string
+	config      string
+	db          datastore.Datastore
+	server      *echo.Echo
+	// indexes is the YAML list of indexes to configure. Set it before calling SetupTest to change it.
+	indexes string
+	// extraConfiguration is added to the configuration file as is.
+	extraConfiguration string
+}
+
+const defaultIndexes = `
+  - name: "base"
+    bases: []
+  - name: "test"
+    bases: ["base"]
+`
+
+// configuration returns the configuration file contents used to setup the data store
+func (suite *TestSuiteWithServer) configuration() string {
+	indexes := suite.indexes
+	if indexes == "" {
+		indexes = defaultIndexes
+	}
+	return `
+storagePath: "` + suite.storagePath + `"
+database:
+  driver: "sqlite3"
+  connection: ":memory:"
+indexes:` + indexes + suite.extraConfiguration
+}
+
+func (suite *TestSuiteWithServer) SetupTest() {
+	require := suite.Require()
+	var err error
+	suite.storagePath, err = ioutil.TempDir(os.TempDir(), "")
+	require.Nil(err, "unable to create the temporary storage path")
+	suite.config = filepath.Join(suite.storagePath, "config.yaml")
+	require.Nil(
+		ioutil.WriteFile(suite.config, []byte(suite.configuration()), 0640),
+		"unable to write the configuration file")
+	suite.db, err = datastore.New(suite.config)
+	require.Nil(err, "unable to create the data store")
+	suite.server = echo.New()
+	require.Nil(SetupEchoServer(suite.server, suite.db, "../../templates"), "unable to setup the server")
+}
+
+func (suite *TestSuiteWithServer) TearDownTest() {
+	suite.Require().Nil(suite.db.Close(), "unable to close the database connection")
+	suite.Require().Nil(os.RemoveAll(suite.storagePath), "unable to remove the storage path")
+}
+
+// request sends a request to the server and returns the recorded response
+func (suite *TestSuiteWithServer) request(method string, path string, header http.Header) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, nil)
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	recorder := httptest.NewRecorder()
+	suite.server.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// upload uploads a file to the given repository the same way twine does
+func (suite *TestSuiteWithServer) upload(repositoryName string, fields map[string]string, fileName string, content []byte, header http.Header) *httptest.ResponseRecorder {
+	require := suite.Require()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	require.Nil(writer.WriteField(":action", "file_upload"), "unable to write the action")
+	for name, value := range fields {
+		require.Nil(writer.WriteField(name, value), "unable to write the field '%s'", name)
+	}
+	part, err := writer.CreateFormFile("content", fileName)
+	require.Nil(err, "unable to create the file field")
+	_, err = part.Write(content)
+	require.Nil(err, "unable to write the file content")
+	require.Nil(writer.Close(), "unable to close the multipart writer")
+
+	request := httptest.NewRequest(http.MethodPost, "/"+repositoryName+"/", body)
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	request.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	recorder := httptest.NewRecorder()
+	suite.server.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// basicAuth returns the header to authenticate with the given credentials
+func basicAuth(userName string, password string) http.Header {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.SetBasicAuth(userName, password)
+	return request.Header
+}
+
+// addFile adds a file with random content to a project in the given repository
+func (suite *TestSuiteWithServer) addFile(repositoryName string, projectName string, fileName string) datastore.ProjectFile {
+	require := suite.Require()
+	repo, err := suite.db.GetRepository(repositoryName)
+	require.Nil(err, "unable to get the repository")
+	project, err := repo.AddProject(projectName)
+	require.Nil(err, "unable to add the project")
+	content := make([]byte, 512)
+	_, err = rand.Read(content)
+	require.Nil(err, "Error creating random file content")
+	require.Nil(project.AddFile(fileName, bytes.NewReader(content)), "unable to add the file")
+	file, err := project.GetFile(fileName)
+	require.Nil(err, "unable to get the file")
+	require.NotNil(file, "the file has not been found")
+	return file
+}
+
+/*
+TestSuiteWithAdmin sets up a server with a repository "base", which is
+readable and writable by everyone, but administrated by the user "admin" only.
+The user "admin" is allowed to manage the indexes as well.
+*/
+type TestSuiteWithAdmin struct {
+	TestSuiteWithServer
+}
+
+func (suite *TestSuiteWithAdmin) SetupTest() {
+	password, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	suite.Require().Nil(err, "unable to hash the password")
+	suite.extraConfiguration = `
+users:
+  - name: "admin"
+    password: "` + string(password) + `"
+admins: ["admin"]
+`
+	if suite.indexes == "" {
+		suite.indexes = `
+  - name: "base"
+    bases: []
+    permissions:
+      read: ["*"]
+      upload: ["*"]
+      admin: ["admin"]
+`
+	}
+	suite.TestSuiteWithServer.SetupTest()
+}
+
+// send sends a request with a JSON body authenticated as the admin user
+func (suite *TestSuiteWithAdmin) send(method string, path string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	request.SetBasicAuth("admin", "secret")
+	recorder := httptest.NewRecorder()
+	suite.server.ServeHTTP(recorder, request)
+	return recorder
+}
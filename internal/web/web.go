@@ -6,35 +6,76 @@ import (
 	"github.com/labstack/echo/v4"
 	"html/template"
 	"io"
-	"regexp"
+	"net/http"
+	"net/url"
+	"strings"
 )
 
-var packageNameRegExp = regexp.MustCompile("[-_.]+")
-
 type templateRenderer struct {
 	templates *template.Template
 }
 
 func repositoryUrl(c echo.Context) func(repo datastore.Repository) string {
 	return func(repo datastore.Repository) string {
-		return c.Echo().Reverse(repo.Name())
+		return c.Echo().Reverse("repository", repo.Name())
 	}
 }
 
 func projectUrl(c echo.Context) func(repo datastore.Repository, project datastore.Project) string {
 	return func(repository datastore.Repository, project datastore.Project) string {
-		return c.Echo().Reverse(fmt.Sprintf("%s-project", repository.Name()), project.Name())
+		return c.Echo().Reverse("project", repository.Name(), project.Name())
 	}
 }
 
-func projectFileUrl(c echo.Context) func(repo datastore.Repository, project datastore.Project, file datastore.ProjectFile) string {
+/*
+fileOwner returns a function returning the repository and project actually storing a file.
+Files not stored in a local repository, like the files of remote indexes, are served by
+the repository they have been requested from. The same applies if the owner can not be
+determined or the current user is not allowed to read it, as each repository serves the
+files of its bases, too. The owner of each project is resolved only once.
+*/
+func fileOwner(c echo.Context) func(repo datastore.Repository, project datastore.Project, file datastore.ProjectFile) (datastore.Repository, datastore.Project) {
+	owners := make(map[datastore.Project]datastore.Repository)
+	return func(repo datastore.Repository, project datastore.Project, file datastore.ProjectFile) (datastore.Repository, datastore.Project) {
+		ownerProject, err := file.Project()
+		if err != nil || ownerProject == nil {
+			return repo, project
+		}
+		ownerRepo, resolved := owners[ownerProject]
+		if !resolved {
+			if ownerRepo, err = ownerProject.Repository(); err != nil {
+				ownerRepo = nil
+			} else if ownerRepo != nil && ownerRepo.Name() != repo.Name() {
+				if allowed, err := ownerRepo.IsAllowed(currentUser(c), datastore.PermissionRead); err != nil || !allowed {
+					ownerRepo = nil
+				}
+			}
+			owners[ownerProject] = ownerRepo
+		}
+		if ownerRepo == nil {
+			return repo, project
+		}
+		return ownerRepo, ownerProject
+	}
+}
+
+func projectFilePath(c echo.Context) func(repo datastore.Repository, project datastore.Project, file datastore.ProjectFile) string {
+	owner := fileOwner(c)
 	return func(repo datastore.Repository, project datastore.Project, file datastore.ProjectFile) string {
-		url := c.Echo().Reverse(
-			fmt.Sprintf("%s-file", repo.Name()),
+		repo, project = owner(repo, project, file)
+		return c.Echo().Reverse(
+			"file",
+			repo.Name(),
 			project.Name(),
 			file.Checksum(),
 			file.Name())
-		return fmt.Sprintf("%s#sha256=%s", url, file.Checksum())
+	}
+}
+
+func projectFileUrl(c echo.Context) func(repo datastore.Repository, project datastore.Project, file datastore.ProjectFile) string {
+	filePath := projectFilePath(c)
+	return func(repo datastore.Repository, project datastore.Project, file datastore.ProjectFile) string {
+		return fmt.Sprintf("%s#sha256=%s", filePath(repo, project, file), file.Checksum())
 	}
 }
 
@@ -51,32 +92,116 @@ func (t *templateRenderer) Render(w io.Writer, name string, data interface{}, c
 	return t.templates.ExecuteTemplate(w, name, data)
 }
 
+const repositoryContextKey = "repository"
+
+/*
+resolveRepository returns a middleware, which resolves the repository addressed by the request path
+before the request is routed. Repository names might contain slashes, thus the longest name matching
+the beginning of the path is used and the path is rewritten to contain the name as a single segment.
+*/
+func resolveRepository(db datastore.Datastore) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			request := ctx.Request()
+			if request.URL.Path == "/" || strings.HasPrefix(request.URL.Path, "/+") {
+				return next(ctx)
+			}
+			match, err := db.MatchRepository(request.URL.Path)
+			if err != nil {
+				return &echo.HTTPError{
+					Code:     http.StatusInternalServerError,
+					Message:  err.Error(),
+					Internal: err,
+				}
+			}
+			if match != nil {
+				ctx.Set(repositoryContextKey, match)
+				if strings.Contains(match.Name(), "/") {
+					request.URL.Path = "/" + url.PathEscape(match.Name()) + strings.TrimPrefix(request.URL.Path, "/"+match.Name())
+					request.URL.RawPath = ""
+				}
+			}
+			return next(ctx)
+		}
+	}
+}
+
+/*
+contextRepository returns the repository addressed by the request.
+*/
+func contextRepository(ctx echo.Context) (datastore.Repository, error) {
+	repo, ok := ctx.Get(repositoryContextKey).(datastore.Repository)
+	if !ok {
+		return nil, &echo.HTTPError{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("repository '%s' not found", ctx.Param("repository")),
+		}
+	}
+	return repo, nil
+}
+
+/*
+withRepository returns a handler, which passes the repository addressed by the request to the view.
+*/
+func withRepository(view func(repo datastore.Repository) func(ctx echo.Context) error) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		repo, err := contextRepository(ctx)
+		if err != nil {
+			return err
+		}
+		return view(repo)(ctx)
+	}
+}
+
 /*
 SetupEchoServer sets up the Echo web server to process requests to the GoatCheese shop.
 It sets up routes to the endpoints required to be compatible with the python package ecosystem.
 */
-func SetupEchoServer(server *echo.Echo, datastore datastore.Datastore, templatesPath string) error {
+func SetupEchoServer(server *echo.Echo, db datastore.Datastore, templatesPath string) error {
 	templates := &templateRenderer{
 		template.Must(template.ParseGlob(fmt.Sprintf("%s/*.html", templatesPath))),
 	}
 	server.Renderer = templates
+	server.Use(authenticate(db))
 
 	// Root
-	server.GET("/", rootView(datastore)).Name = "root"
+	server.GET("/", rootView(db)).Name = "root"
 
-	// Repositories
-	repos, err := datastore.AllRepositories()
-	if err != nil {
-		return err
-	}
-	for _, repo := range repos {
-		repoPath := fmt.Sprintf("/%s/", repo.Name())
-		projectPath := fmt.Sprintf("%s:project/", repoPath)
-		filePath := fmt.Sprintf("%s:fileChecksum/:fileName", projectPath)
-		server.GET(repoPath, repositoryView(repo)).Name = repo.Name()
-		server.POST(repoPath, repositoryPostView(repo)).Name = fmt.Sprintf("%s-post", repo.Name())
-		server.GET(projectPath, projectView(repo)).Name = fmt.Sprintf("%s-project", repo.Name())
-		server.GET(filePath, projectFileView(repo)).Name = fmt.Sprintf("%s-file", repo.Name())
-	}
+	// Index management
+	isAdmin := requireAdmin(db)
+	server.POST("/+api/indexes/", createIndexView(db), isAdmin)
+	server.GET("/+api/indexes/*", indexView(db), isAdmin)
+	server.PATCH("/+api/indexes/*", updateIndexView(db), isAdmin)
+	server.DELETE("/+api/indexes/*", deleteIndexView(db), isAdmin)
+
+	// Repositories are resolved from the path, as they might be added at any time
+	server.Pre(resolveRepository(db))
+	repoPath := "/:repository/"
+	projectPath := fmt.Sprintf("%s:project/", repoPath)
+	filePath := fmt.Sprintf("%s:fileChecksum/:fileName", projectPath)
+	canRead := requirePermission(datastore.PermissionRead)
+	canUpload := requirePermission(datastore.PermissionUpload)
+	server.GET(repoPath, withRepository(repositoryView), canRead).Name = "repository"
+	server.POST(repoPath, withRepository(repositoryPostView), canUpload).Name = "repository-post"
+	server.GET(projectPath, withRepository(projectView), canRead).Name = "project"
+	server.GET(filePath, withRepository(projectFileView), canRead).Name = "file"
+
+	// Administration API
+	isRepoAdmin := requirePermission(datastore.PermissionAdmin)
+	apiPath := fmt.Sprintf("%s+api/projects/:project/", repoPath)
+	releasePath := fmt.Sprintf("%sreleases/:version", apiPath)
+	releaseYankPath := fmt.Sprintf("%s/yank", releasePath)
+	releasePromotePath := fmt.Sprintf("%s/promote", releasePath)
+	fileAPIPath := fmt.Sprintf("%sfiles/:fileName", apiPath)
+	fileYankPath := fmt.Sprintf("%s/yank", fileAPIPath)
+	server.DELETE(apiPath, withRepository(deleteProjectView), isRepoAdmin)
+	server.DELETE(releasePath, withRepository(deleteReleaseView), isRepoAdmin)
+	server.DELETE(fileAPIPath, withRepository(deleteFileView), isRepoAdmin)
+	server.POST(releaseYankPath, withRepository(yankReleaseView(true)), isRepoAdmin)
+	server.DELETE(releaseYankPath, withRepository(yankReleaseView(false)), isRepoAdmin)
+	// The permissions on the target repository are checked by the view
+	server.POST(releasePromotePath, withRepository(promoteReleaseView(db)), canRead)
+	server.POST(fileYankPath, withRepository(yankFileView(true)), isRepoAdmin)
+	server.DELETE(fileYankPath, withRepository(yankFileView(false)), isRepoAdmin)
 	return nil
 }
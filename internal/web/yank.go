@@ -0,0 +1,73 @@
+package web
+
+import (
+	"github.com/hansingt/GoatCheese/internal/datastore"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type yankRequest struct {
+	Reason string `json:"reason" form:"reason" query:"reason"`
+}
+
+/*
+yankReleaseView yanks or un-yanks all files of a release as defined in PEP 592.
+*/
+func yankReleaseView(yank bool) func(repo datastore.Repository) func(ctx echo.Context) error {
+	return func(repo datastore.Repository) func(ctx echo.Context) error {
+		return func(ctx echo.Context) error {
+			project, err := apiProject(repo, ctx)
+			if err != nil {
+				return err
+			}
+			release, err := apiRelease(project, ctx)
+			if err != nil {
+				return err
+			}
+			if yank {
+				var request yankRequest
+				if err = ctx.Bind(&request); err != nil {
+					return err
+				}
+				err = release.Yank(request.Reason)
+			} else {
+				err = release.Unyank()
+			}
+			if err != nil {
+				return err
+			}
+			return ctx.NoContent(http.StatusNoContent)
+		}
+	}
+}
+
+/*
+yankFileView yanks or un-yanks a single file of a project as defined in PEP 592.
+*/
+func yankFileView(yank bool) func(repo datastore.Repository) func(ctx echo.Context) error {
+	return func(repo datastore.Repository) func(ctx echo.Context) error {
+		return func(ctx echo.Context) error {
+			project, err := apiProject(repo, ctx)
+			if err != nil {
+				return err
+			}
+			file, err := apiFile(project, ctx)
+			if err != nil {
+				return err
+			}
+			if yank {
+				var request yankRequest
+				if err = ctx.Bind(&request); err != nil {
+					return err
+				}
+				err = file.Yank(request.Reason)
+			} else {
+				err = file.Unyank()
+			}
+			if err != nil {
+				return err
+			}
+			return ctx.NoContent(http.StatusNoContent)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/hansingt/GoatCheese/internal/testutil"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"testing"
+)
+
+type yankTestSuite struct {
+	TestSuiteWithAdmin
+}
+
+func TestYank(t *testing.T) {
+	suite.Run(t, new(yankTestSuite))
+}
+
+func (suite *yankTestSuite) SetupTest() {
+	suite.TestSuiteWithAdmin.SetupTest()
+	response := suite.upload("base", map[string]string{"name": "fuubar"},
+		"fuubar-1.0-py3-none-any.whl", testutil.Wheel("fuubar", "1.0"), nil)
+	suite.Require().Equal(http.StatusOK, response.Code, response.Body.String())
+}
+
+func (suite *yankTestSuite) yanked() interface{} {
+	response := suite.request(http.MethodGet, "/base/fuubar/", http.Header{
+		echo.HeaderAccept: []string{simpleJSONContentType},
+	})
+	suite.Require().Equal(http.StatusOK, response.Code)
+	var result simpleProjectDetail
+	suite.Require().Nil(json.Unmarshal(response.Body.Bytes(), &result), "unable to decode the response")
+	return result.Files[0].Yanked
+}
+
+func (suite *yankTestSuite) TestRequiresAdmin() {
+	response := suite.request(http.MethodPost, "/base/+api/projects/fuubar/releases/1.0/yank", nil)
+	suite.Require().Equal(http.StatusUnauthorized, response.Code)
+}
+
+func (suite *yankTestSuite) TestYankRelease() {
+	require := suite.Require()
+	response := suite.send(http.MethodPost, "/base/+api/projects/fuubar/releases/1.0/yank", `{"reason": "broken <build>"}`)
+	require.Equal(http.StatusNoContent, response.Code, response.Body.String())
+	require.Equal("broken <build>", suite.yanked())
+
+	response = suite.request(http.MethodGet, "/base/fuubar/", nil)
+	require.Contains(response.Body.String(), `data-yanked="broken &lt;build&gt;"`)
+
+	response = suite.send(http.MethodDelete, "/base/+api/projects/fuubar/releases/1.0/yank", "")
+	require.Equal(http.StatusNoContent, response.Code, response.Body.String())
+	require.Equal(false, suite.yanked())
+	response = suite.request(http.MethodGet, "/base/fuubar/", nil)
+	require.NotContains(response.Body.String(), "data-yanked")
+}
+
+func (suite *yankTestSuite) TestYankFile() {
+	require := suite.Require()
+	response := suite.send(http.MethodPost, "/base/+api/projects/fuubar/files/fuubar-1.0-py3-none-any.whl/yank", "{}")
+	require.Equal(http.StatusNoContent, response.Code, response.Body.String())
+	require.Equal(true, suite.yanked())
+
+	response = suite.request(http.MethodGet, "/base/fuubar/", nil)
+	require.Contains(response.Body.String(), `data-yanked=""`)
+}
+
+func (suite *yankTestSuite) TestNotFound() {
+	require := suite.Require()
+	response := suite.send(http.MethodPost, "/base/+api/projects/fuubar/releases/2.0/yank", "{}")
+	require.Equal(http.StatusNotFound, response.Code)
+	response = suite.send(http.MethodPost, "/base/+api/projects/unknown/releases/1.0/yank", "{}")
+	require.Equal(http.StatusNotFound, response.Code)
+	response = suite.send(http.MethodPost, "/base/+api/projects/fuubar/files/unknown.whl/yank", "{}")
+	require.Equal(http.StatusNotFound, response.Code)
+}